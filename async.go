@@ -0,0 +1,77 @@
+package bark
+
+import (
+	"io"
+	"os"
+	"sync"
+)
+
+// AsyncWriter hands records to a goroutine that writes them to the
+// underlying writer, so logging does not wait on slow I/O. Up to size
+// records are queued; past that, Write blocks until the goroutine catches
+// up. Close must be called to flush the queue.
+type AsyncWriter struct {
+	w    io.Writer
+	ch   chan *[]byte
+	done chan struct{}
+	pool sync.Pool
+
+	mu     sync.RWMutex // held for writing by Close
+	closed bool
+	err    error // first error from w, set by the goroutine
+}
+
+// NewAsyncWriter starts a goroutine writing to w with room for size queued
+// records.
+func NewAsyncWriter(w io.Writer, size int) *AsyncWriter {
+	a := &AsyncWriter{
+		w:    w,
+		ch:   make(chan *[]byte, size),
+		done: make(chan struct{}),
+	}
+	a.pool.New = func() any {
+		b := make([]byte, 0, 512)
+		return &b
+	}
+	go a.run()
+	return a
+}
+
+// Write queues a copy of p. It reports errors from earlier writes only
+// through Close.
+func (a *AsyncWriter) Write(p []byte) (int, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	if a.closed {
+		return 0, os.ErrClosed
+	}
+	b := a.pool.Get().(*[]byte)
+	*b = append((*b)[:0], p...)
+	a.ch <- b
+	return len(p), nil
+}
+
+func (a *AsyncWriter) run() {
+	defer close(a.done)
+	for b := range a.ch {
+		if _, err := a.w.Write(*b); err != nil && a.err == nil {
+			a.err = err
+		}
+		if cap(*b) <= maxPooledBuf {
+			a.pool.Put(b)
+		}
+	}
+}
+
+// Close writes the queued records and stops the goroutine. It returns the
+// first error the underlying writer returned, and does not close it.
+func (a *AsyncWriter) Close() error {
+	a.mu.Lock()
+	if !a.closed {
+		a.closed = true
+		close(a.ch)
+	}
+	a.mu.Unlock()
+	<-a.done
+	return a.err
+}
@@ -0,0 +1,62 @@
+package bark
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// lockedBuffer is a bytes.Buffer safe for use by the writer goroutine.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func TestAsyncWriter(t *testing.T) {
+	var out lockedBuffer
+	a := NewAsyncWriter(&out, 4)
+	l := NewLogger(a)
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Go(func() {
+			for range 50 {
+				l.Info().Str("k", "v").Msg("queued")
+			}
+		})
+	}
+	wg.Wait()
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(out.buf.String(), "\n"); n != 200 {
+		t.Errorf("flushed %d records, want 200", n)
+	}
+	if _, err := a.Write([]byte("late\n")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("write after close: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Errorf("second close: %v", err)
+	}
+}
+
+type errWriter struct{ err error }
+
+func (w errWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestAsyncWriterError(t *testing.T) {
+	want := errors.New("disk full")
+	a := NewAsyncWriter(errWriter{want}, 1)
+	a.Write([]byte("x\n"))
+	if err := a.Close(); err != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+}
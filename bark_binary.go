@@ -1,15 +1,35 @@
 package bark
 
 import (
+	"bytes"
+	"encoding"
 	"encoding/binary"
+	"encoding/json"
+	"fmt"
 	"io"
 	"math"
+	"net"
+	"net/netip"
+	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
+// Frame types record the level of the record, one above the Level value.
+const (
+	BinTypeDebug = uint16(0)
+	BinTypeInfo  = uint16(1)
+	BinTypeWarn  = uint16(2)
+	BinTypeError = uint16(3)
+
+	// BinTypeCheckpoint marks the checkpoints a ChainWriter writes. No Level
+	// maps to it, so a Logger cannot write one; it reads as LevelInfo.
+	BinTypeCheckpoint = uint16(0x100)
+)
+
 const (
-	BinTypeInfo = uint16(1)
 	BinTagString     = uint8(1)
 	BinTagInt        = uint8(2)
 	BinTagInt8       = uint8(3)
@@ -29,223 +49,588 @@ const (
 	BinTagComplex128 = uint8(17)
 	BinTagUintptr    = uint8(18)
 	BinTagBytes      = uint8(19)
+
+	// Long variants carry a 4-byte length prefix and are used automatically
+	// when a value does not fit the 2-byte prefix of the short tags.
+	BinTagStringLong = uint8(20)
+	BinTagBytesLong  = uint8(21)
+	BinTagErrLong    = uint8(22)
+
+	// Times are stored as nanoseconds since the Unix epoch and durations as
+	// nanoseconds, both as 8-byte signed values.
+	BinTagTime     = uint8(23)
+	BinTagDuration = uint8(24)
+
+	// BinTagAny holds a reflectively encoded value: a 4-byte length followed
+	// by a single [Tag][Value]. Inside it, composite values use BinTagArray
+	// ([Count uint32] then [Tag][Value] per element), BinTagObject ([Count
+	// uint32] then [Key][Tag][Value] per entry) and BinTagNull (no value).
+	BinTagAny    = uint8(25)
+	BinTagNull   = uint8(26)
+	BinTagArray  = uint8(27)
+	BinTagObject = uint8(28)
+
+	// Network identifiers keep their raw form. BinTagHex is [Len uint16][Bytes]
+	// rendered as hex; BinTagIPAddr is [Len 0|4|16][Addr][ZoneLen][Zone];
+	// BinTagIPPrefix is an IPAddr followed by [Bits] (0xFF when invalid);
+	// BinTagMAC is [Len][Bytes] and BinTagUUID is 16 bytes.
+	BinTagHex      = uint8(29)
+	BinTagIPAddr   = uint8(30)
+	BinTagIPPrefix = uint8(31)
+	BinTagMAC      = uint8(32)
+	BinTagUUID     = uint8(33)
+
+	// BinTagRawJSON holds an encoded JSON document as [Len uint32][Bytes].
+	BinTagRawJSON = uint8(34)
+
+	// BinTagEncrypted holds a value encrypted with AES-GCM as [KeyIDLen
+	// uint8][KeyID][Len uint32][Nonce][Sealed], where Len covers the 12-byte
+	// nonce and the sealed bytes, which decrypt to the [Tag][Value] the field
+	// had in clear. The field key is authenticated as additional data, so a
+	// value cannot be moved to another key.
+	BinTagEncrypted = uint8(35)
+)
+
+// maxAnyDepth bounds the nesting followed by the reflective encoder, so
+// cyclic values terminate.
+const maxAnyDepth = 32
+
+// binKeyLong marks a key whose length does not fit in a single byte; the real
+// length follows as a 4-byte value.
+const binKeyLong = 0xFF
+
+// BinaryLogger and BinaryEvent are the Logger and Event types under the names
+// they had before encoders were pluggable.
+type (
+	BinaryLogger = Logger
+	BinaryEvent  = Event
 )
 
-type BinaryLogger struct {
-	pool sync.Pool
-	out  io.Writer
+// NewBinaryLogger returns a Logger writing the binary format. It is short for
+// NewLogger with WithFormat(FormatBinary).
+func NewBinaryLogger(w io.Writer, opts ...Option) *BinaryLogger {
+	return NewLogger(w, append(opts[:len(opts):len(opts)], WithFormat(FormatBinary))...)
 }
 
-type BinaryEvent struct {
-	buf  []byte
-	out  io.Writer
-	pool *sync.Pool
+func binType(level Level) uint16 {
+	return uint16(int(level) + 1)
 }
 
-func NewBinaryLogger(w io.Writer) *BinaryLogger {
-	l := &BinaryLogger{
-		out: w,
-	}
-	l.pool.New = func() any {
-		return &BinaryEvent{
-			buf: make([]byte, 0, 512),
-			out:  w,
-			pool: &l.pool,
-		}
-	}
-	return l
+// binaryEncoder writes each record as a frame of [Type uint16][Length uint32]
+// followed by the timestamp and [Key][Tag][Value] fields.
+type binaryEncoder struct{}
+
+func (binaryEncoder) Begin(dst []byte, t time.Time, level Level) []byte {
+	dst = binary.LittleEndian.AppendUint16(dst, binType(level))
+	dst = append(dst, 0, 0, 0, 0)
+	return binary.LittleEndian.AppendUint64(dst, uint64(t.UnixNano()))
 }
 
-func (l *BinaryLogger) Info() *BinaryEvent {
-	e := l.pool.Get().(*BinaryEvent)
-	e.buf = e.buf[:0]
-	e.buf = append(e.buf, 0, 0, 0, 0, 0, 0)
-	e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(time.Now().UnixNano()))
+// End fills in the frame length. The frame is assumed to start at dst[0].
+func (binaryEncoder) End(dst []byte, n int) []byte {
+	binary.LittleEndian.PutUint32(dst[2:6], uint32(len(dst)-6))
+	return dst
+}
 
-	return e
+// AppendKey writes [KeyLen][KeyBytes], or [0xFF][KeyLen uint32][KeyBytes]
+// for keys of 255 bytes or more.
+func (binaryEncoder) AppendKey(dst []byte, key string) []byte {
+	dst = appendBinKeyLen(dst, len(key))
+	return append(dst, key...)
 }
 
-// appendKey adds [KeyLen][KeyBytes]
-func (e *BinaryEvent) appendKey(key string) {
-	if len(key) > 255 {
-		key = key[:255]
-	}
-	e.buf = append(e.buf, uint8(len(key)))
-	e.buf = append(e.buf, key...)
+func (binaryEncoder) AppendString(dst []byte, val string) []byte {
+	return appendVal(dst, BinTagString, BinTagStringLong, val)
 }
 
-func (e *BinaryEvent) Str(key, val string) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagString)
-	if len(val) > 65535 {
-		val = val[:65535]
-	}
-	e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(len(val)))
-	e.buf = append(e.buf, val...)
-	return e
+func (binaryEncoder) AppendBytes(dst []byte, val []byte) []byte {
+	return appendVal(dst, BinTagBytes, BinTagBytesLong, val)
 }
 
-func (e *BinaryEvent) Bytes(key string, val []byte) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagBytes)
-	vLen := len(val)
-	if vLen > 65535 {
-		vLen = 65535
-	}
-	e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(vLen))
-	e.buf = append(e.buf, val[:vLen]...)
-	return e
+func (binaryEncoder) AppendError(dst []byte, msg string) []byte {
+	return appendVal(dst, BinTagErr, BinTagErrLong, msg)
 }
 
-// Integers
+func (binaryEncoder) AppendInt(dst []byte, val int) []byte {
+	return binary.LittleEndian.AppendUint64(append(dst, BinTagInt), uint64(val))
+}
 
-func (e *BinaryEvent) Int(key string, val int) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagInt)
-	e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(val))
-	return e
+func (binaryEncoder) AppendInt8(dst []byte, val int8) []byte {
+	return append(dst, BinTagInt8, uint8(val))
 }
 
-func (e *BinaryEvent) Int8(key string, val int8) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagInt8)
-	e.buf = append(e.buf, uint8(val))
-	return e
+func (binaryEncoder) AppendInt16(dst []byte, val int16) []byte {
+	return binary.LittleEndian.AppendUint16(append(dst, BinTagInt16), uint16(val))
 }
 
-func (e *BinaryEvent) Int16(key string, val int16) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagInt16)
-	e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(val))
-	return e
+func (binaryEncoder) AppendInt32(dst []byte, val int32) []byte {
+	return binary.LittleEndian.AppendUint32(append(dst, BinTagInt32), uint32(val))
 }
 
-func (e *BinaryEvent) Int32(key string, val int32) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagInt32)
-	e.buf = binary.LittleEndian.AppendUint32(e.buf, uint32(val))
-	return e
+func (binaryEncoder) AppendInt64(dst []byte, val int64) []byte {
+	return binary.LittleEndian.AppendUint64(append(dst, BinTagInt64), uint64(val))
 }
 
-func (e *BinaryEvent) Int64(key string, val int64) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagInt64)
-	e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(val))
-	return e
+func (binaryEncoder) AppendUint(dst []byte, val uint) []byte {
+	return binary.LittleEndian.AppendUint64(append(dst, BinTagUint), uint64(val))
 }
 
-// Unsigned Integers
+func (binaryEncoder) AppendUint8(dst []byte, val uint8) []byte {
+	return append(dst, BinTagUint8, val)
+}
 
-func (e *BinaryEvent) Uint(key string, val uint) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagUint)
-	e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(val))
-	return e
+func (binaryEncoder) AppendUint16(dst []byte, val uint16) []byte {
+	return binary.LittleEndian.AppendUint16(append(dst, BinTagUint16), val)
 }
 
-func (e *BinaryEvent) Uint8(key string, val uint8) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagUint8)
-	e.buf = append(e.buf, val)
-	return e
+func (binaryEncoder) AppendUint32(dst []byte, val uint32) []byte {
+	return binary.LittleEndian.AppendUint32(append(dst, BinTagUint32), val)
 }
 
-func (e *BinaryEvent) Uint16(key string, val uint16) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagUint16)
-	e.buf = binary.LittleEndian.AppendUint16(e.buf, val)
-	return e
+func (binaryEncoder) AppendUint64(dst []byte, val uint64) []byte {
+	return binary.LittleEndian.AppendUint64(append(dst, BinTagUint64), val)
 }
 
-func (e *BinaryEvent) Uint32(key string, val uint32) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagUint32)
-	e.buf = binary.LittleEndian.AppendUint32(e.buf, val)
-	return e
+func (binaryEncoder) AppendUintptr(dst []byte, val uintptr) []byte {
+	return binary.LittleEndian.AppendUint64(append(dst, BinTagUintptr), uint64(val))
 }
 
-func (e *BinaryEvent) Uint64(key string, val uint64) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagUint64)
-	e.buf = binary.LittleEndian.AppendUint64(e.buf, val)
-	return e
+func (binaryEncoder) AppendFloat32(dst []byte, val float32) []byte {
+	return binary.LittleEndian.AppendUint32(append(dst, BinTagFloat32), math.Float32bits(val))
 }
 
-func (e *BinaryEvent) Uintptr(key string, val uintptr) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagUintptr)
-	e.buf = binary.LittleEndian.AppendUint64(e.buf, uint64(val))
-	return e
+func (binaryEncoder) AppendFloat64(dst []byte, val float64) []byte {
+	return binary.LittleEndian.AppendUint64(append(dst, BinTagFloat64), math.Float64bits(val))
 }
 
-// Floats
+func (binaryEncoder) AppendComplex64(dst []byte, val complex64) []byte {
+	dst = binary.LittleEndian.AppendUint32(append(dst, BinTagComplex64), math.Float32bits(real(val)))
+	return binary.LittleEndian.AppendUint32(dst, math.Float32bits(imag(val)))
+}
 
-func (e *BinaryEvent) Float32(key string, val float32) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagFloat32)
-	e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(val))
-	return e
+func (binaryEncoder) AppendComplex128(dst []byte, val complex128) []byte {
+	dst = binary.LittleEndian.AppendUint64(append(dst, BinTagComplex128), math.Float64bits(real(val)))
+	return binary.LittleEndian.AppendUint64(dst, math.Float64bits(imag(val)))
 }
 
-func (e *BinaryEvent) Float64(key string, val float64) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagFloat64)
-	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(val))
-	return e
+func (binaryEncoder) AppendBool(dst []byte, val bool) []byte {
+	if val {
+		return append(dst, BinTagBool, 1)
+	}
+	return append(dst, BinTagBool, 0)
 }
 
-// Complex
+func (binaryEncoder) AppendTime(dst []byte, val time.Time) []byte {
+	return binary.LittleEndian.AppendUint64(append(dst, BinTagTime), uint64(val.UnixNano()))
+}
 
-func (e *BinaryEvent) Complex64(key string, val complex64) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagComplex64)
-	e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(real(val)))
-	e.buf = binary.LittleEndian.AppendUint32(e.buf, math.Float32bits(imag(val)))
-	return e
+func (binaryEncoder) AppendDuration(dst []byte, val time.Duration) []byte {
+	return binary.LittleEndian.AppendUint64(append(dst, BinTagDuration), uint64(val))
 }
 
-func (e *BinaryEvent) Complex128(key string, val complex128) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagComplex128)
-	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(real(val)))
-	e.buf = binary.LittleEndian.AppendUint64(e.buf, math.Float64bits(imag(val)))
-	return e
+func (binaryEncoder) AppendNull(dst []byte) []byte {
+	return append(dst, BinTagNull)
 }
 
-// Others
+// AppendHex writes val under BinTagHex. Values over 65535 bytes fall back to
+// BinTagBytesLong.
+func (binaryEncoder) AppendHex(dst []byte, val []byte) []byte {
+	return appendVal(dst, BinTagHex, BinTagBytesLong, val)
+}
 
-func (e *BinaryEvent) Bool(key string, val bool) *BinaryEvent {
-	e.appendKey(key)
-	e.buf = append(e.buf, BinTagBool)
-	if val {
-		e.buf = append(e.buf, 1)
+func (binaryEncoder) AppendIPAddr(dst []byte, val netip.Addr) []byte {
+	return appendBinAddr(append(dst, BinTagIPAddr), val)
+}
+
+func (binaryEncoder) AppendIPPrefix(dst []byte, val netip.Prefix) []byte {
+	dst = appendBinAddr(append(dst, BinTagIPPrefix), val.Addr())
+	return append(dst, uint8(val.Bits()))
+}
+
+// AppendMAC writes val with a 1-byte length, cut to 255 bytes; real hardware
+// addresses are 20 bytes at most.
+func (binaryEncoder) AppendMAC(dst []byte, val net.HardwareAddr) []byte {
+	val = val[:min(len(val), math.MaxUint8)]
+	dst = append(dst, BinTagMAC, uint8(len(val)))
+	return append(dst, val...)
+}
+
+func (binaryEncoder) AppendUUID(dst []byte, val [16]byte) []byte {
+	dst = append(dst, BinTagUUID)
+	return append(dst, val[:]...)
+}
+
+// AppendRawJSON stores val under BinTagRawJSON so decoders render it as
+// nested JSON.
+func (binaryEncoder) AppendRawJSON(dst []byte, val []byte) []byte {
+	dst = binary.LittleEndian.AppendUint32(append(dst, BinTagRawJSON), uint32(len(val)))
+	return append(dst, val...)
+}
+
+// AppendAny encodes val reflectively under BinTagAny, keeping the fields and
+// names encoding/json would write: json tags, omitempty and omitzero, promoted
+// fields of embedded structs, and json.Marshaler and encoding.TextMarshaler
+// values, the first as BinTagRawJSON. It differs from encoding/json in that
+// times and durations keep their tags, byte arrays are written as bytes like
+// byte slices, the ",string" option is ignored, and values nested deeper than
+// maxAnyDepth are written as null.
+func (binaryEncoder) AppendAny(dst []byte, val any) []byte {
+	mark := len(dst)
+	dst = append(dst, BinTagAny, 0, 0, 0, 0)
+	dst = appendBinAny(dst, reflect.ValueOf(val), 0)
+	binary.LittleEndian.PutUint32(dst[mark+1:], uint32(len(dst)-mark-5))
+	return dst
+}
+
+func appendBinKeyLen(dst []byte, n int) []byte {
+	if n < binKeyLong {
+		return append(dst, uint8(n))
+	}
+	dst = append(dst, binKeyLong)
+	return binary.LittleEndian.AppendUint32(dst, uint32(n))
+}
+
+// appendVal writes [Tag][Len][Bytes], picking longTag and a 4-byte length
+// when val does not fit a 2-byte one.
+func appendVal[T string | []byte](dst []byte, tag, longTag uint8, val T) []byte {
+	if len(val) > math.MaxUint16 {
+		dst = append(dst, longTag)
+		dst = binary.LittleEndian.AppendUint32(dst, uint32(len(val)))
 	} else {
-		e.buf = append(e.buf, 0)
+		dst = append(dst, tag)
+		dst = binary.LittleEndian.AppendUint16(dst, uint16(len(val)))
+	}
+	return append(dst, val...)
+}
+
+func appendBinAddr(dst []byte, a netip.Addr) []byte {
+	switch {
+	case a.Is4():
+		b := a.As4()
+		dst = append(dst, 4)
+		dst = append(dst, b[:]...)
+	case a.Is6():
+		b := a.As16()
+		dst = append(dst, 16)
+		dst = append(dst, b[:]...)
+	default:
+		return append(dst, 0, 0)
 	}
-	return e
+	// The zone has a 1-byte length, and is cut to fit.
+	zone := cutValue(a.Zone(), math.MaxUint8, true)
+	dst = append(dst, uint8(len(zone)))
+	return append(dst, zone...)
 }
 
-func (e *BinaryEvent) Error(err error) *BinaryEvent {
-	if err == nil {
-		return e
+var (
+	timeType     = reflect.TypeFor[time.Time]()
+	durationType = reflect.TypeFor[time.Duration]()
+)
+
+// appendBinAny writes v as [Tag][Value].
+func appendBinAny(dst []byte, v reflect.Value, depth int) []byte {
+	le := binary.LittleEndian
+	if !v.IsValid() || depth > maxAnyDepth {
+		return append(dst, BinTagNull)
 	}
-	e.appendKey("error")
-	e.buf = append(e.buf, BinTagErr)
-	msg := err.Error()
-	if len(msg) > 65535 {
-		msg = msg[:65535]
+
+	switch v.Type() {
+	case timeType:
+		dst = append(dst, BinTagTime)
+		return le.AppendUint64(dst, uint64(v.Interface().(time.Time).UnixNano()))
+	case durationType:
+		dst = append(dst, BinTagDuration)
+		return le.AppendUint64(dst, uint64(v.Int()))
+	}
+
+	if v.Kind() == reflect.Pointer && v.IsNil() {
+		return append(dst, BinTagNull)
+	}
+	if m, ok := marshaler(v, jsonMarshalerType); ok {
+		b, err := m.(json.Marshaler).MarshalJSON()
+		var buf bytes.Buffer
+		if err == nil {
+			err = json.Compact(&buf, b)
+		}
+		if err != nil {
+			return appendVal(dst, BinTagString, BinTagStringLong, err.Error())
+		}
+		dst = le.AppendUint32(append(dst, BinTagRawJSON), uint32(buf.Len()))
+		return append(dst, buf.Bytes()...)
+	}
+	if m, ok := marshaler(v, textMarshalerType); ok {
+		b, err := m.(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return appendVal(dst, BinTagString, BinTagStringLong, err.Error())
+		}
+		return appendVal(dst, BinTagString, BinTagStringLong, b)
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return append(dst, BinTagNull)
+		}
+		return appendBinAny(dst, v.Elem(), depth+1)
+	case reflect.Bool:
+		if v.Bool() {
+			return append(dst, BinTagBool, 1)
+		}
+		return append(dst, BinTagBool, 0)
+	case reflect.Int:
+		return le.AppendUint64(append(dst, BinTagInt), uint64(v.Int()))
+	case reflect.Int8:
+		return append(dst, BinTagInt8, uint8(v.Int()))
+	case reflect.Int16:
+		return le.AppendUint16(append(dst, BinTagInt16), uint16(v.Int()))
+	case reflect.Int32:
+		return le.AppendUint32(append(dst, BinTagInt32), uint32(v.Int()))
+	case reflect.Int64:
+		return le.AppendUint64(append(dst, BinTagInt64), uint64(v.Int()))
+	case reflect.Uint:
+		return le.AppendUint64(append(dst, BinTagUint), v.Uint())
+	case reflect.Uint8:
+		return append(dst, BinTagUint8, uint8(v.Uint()))
+	case reflect.Uint16:
+		return le.AppendUint16(append(dst, BinTagUint16), uint16(v.Uint()))
+	case reflect.Uint32:
+		return le.AppendUint32(append(dst, BinTagUint32), uint32(v.Uint()))
+	case reflect.Uint64:
+		return le.AppendUint64(append(dst, BinTagUint64), v.Uint())
+	case reflect.Uintptr:
+		return le.AppendUint64(append(dst, BinTagUintptr), v.Uint())
+	case reflect.Float32:
+		return le.AppendUint32(append(dst, BinTagFloat32), math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		return le.AppendUint64(append(dst, BinTagFloat64), math.Float64bits(v.Float()))
+	case reflect.Complex64:
+		c := v.Complex()
+		dst = le.AppendUint32(append(dst, BinTagComplex64), math.Float32bits(float32(real(c))))
+		return le.AppendUint32(dst, math.Float32bits(float32(imag(c))))
+	case reflect.Complex128:
+		c := v.Complex()
+		dst = le.AppendUint64(append(dst, BinTagComplex128), math.Float64bits(real(c)))
+		return le.AppendUint64(dst, math.Float64bits(imag(c)))
+	case reflect.String:
+		return appendVal(dst, BinTagString, BinTagStringLong, v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return append(dst, BinTagNull)
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if v.Kind() == reflect.Array && !v.CanAddr() {
+				b := make([]byte, v.Len())
+				reflect.Copy(reflect.ValueOf(b), v)
+				return appendVal(dst, BinTagBytes, BinTagBytesLong, b)
+			}
+			return appendVal(dst, BinTagBytes, BinTagBytesLong, v.Bytes())
+		}
+		dst = le.AppendUint32(append(dst, BinTagArray), uint32(v.Len()))
+		for i := range v.Len() {
+			dst = appendBinAny(dst, v.Index(i), depth+1)
+		}
+		return dst
+	case reflect.Map:
+		if v.IsNil() {
+			return append(dst, BinTagNull)
+		}
+		keys := v.MapKeys()
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = mapKeyName(k)
+		}
+		order := make([]int, len(keys))
+		for i := range order {
+			order[i] = i
+		}
+		sort.Slice(order, func(a, b int) bool { return names[order[a]] < names[order[b]] })
+
+		dst = le.AppendUint32(append(dst, BinTagObject), uint32(len(keys)))
+		for _, i := range order {
+			dst = appendBinKeyLen(dst, len(names[i]))
+			dst = append(dst, names[i]...)
+			dst = appendBinAny(dst, v.MapIndex(keys[i]), depth+1)
+		}
+		return dst
+	case reflect.Struct:
+		mark := len(dst)
+		dst = append(dst, BinTagObject, 0, 0, 0, 0)
+		n := 0
+		for _, sf := range typeFields(v.Type()) {
+			fv, ok := fieldByIndex(v, sf.index)
+			if !ok || (sf.omitEmpty && isEmptyValue(fv)) || (sf.omitZero && isZeroValue(fv)) {
+				continue
+			}
+			dst = appendBinKeyLen(dst, len(sf.name))
+			dst = append(dst, sf.name...)
+			dst = appendBinAny(dst, fv, depth+1)
+			n++
+		}
+		le.PutUint32(dst[mark+1:], uint32(n))
+		return dst
+	}
+	// Channels, functions and unsafe pointers have no meaningful encoding.
+	return append(dst, BinTagNull)
+}
+
+var (
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+)
+
+// marshaler returns v as an implementation of the interface iface, taking
+// its address for pointer methods as encoding/json does.
+func marshaler(v reflect.Value, iface reflect.Type) (any, bool) {
+	if v.Kind() != reflect.Interface && v.Type().Implements(iface) && v.CanInterface() {
+		return v.Interface(), true
+	}
+	if v.CanAddr() && reflect.PointerTo(v.Type()).Implements(iface) && v.Addr().CanInterface() {
+		return v.Addr().Interface(), true
+	}
+	return nil, false
+}
+
+// mapKeyName returns the name a map key is encoded under, as encoding/json
+// writes it.
+func mapKeyName(k reflect.Value) string {
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	if m, ok := marshaler(k, textMarshalerType); ok {
+		if b, err := m.(encoding.TextMarshaler).MarshalText(); err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(k.Interface())
+}
+
+// structField is a struct field as encoding/json sees it.
+type structField struct {
+	name      string
+	index     []int
+	depth     int
+	tagged    bool
+	omitEmpty bool
+	omitZero  bool
+}
+
+// fieldCache maps struct types to their []structField.
+var fieldCache sync.Map
+
+// typeFields returns the fields of the struct type t that are encoded, in
+// order, following the rules of encoding/json: json tags name or skip fields,
+// the fields of untagged embedded structs are promoted, and of several fields
+// of the same name the least nested one wins, or the tagged one among equals.
+func typeFields(t reflect.Type) []structField {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.([]structField)
+	}
+	var all []structField
+	collectFields(&all, t, nil, map[reflect.Type]bool{})
+
+	var fields []structField
+	for i, f := range all {
+		keep := true
+		for j, g := range all {
+			if i == j || g.name != f.name {
+				continue
+			}
+			if g.depth < f.depth || (g.depth == f.depth && (g.tagged && !f.tagged || g.tagged == f.tagged)) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			fields = append(fields, f)
+		}
+	}
+	f, _ := fieldCache.LoadOrStore(t, fields)
+	return f.([]structField)
+}
+
+func collectFields(all *[]structField, t reflect.Type, index []int, seen map[reflect.Type]bool) {
+	if seen[t] {
+		return
+	}
+	seen[t] = true
+	defer delete(seen, t)
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		ft := sf.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		idx := append(index[:len(index):len(index)], i)
+		if sf.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			collectFields(all, ft, idx, seen)
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		f := structField{name: name, index: idx, depth: len(index), tagged: name != ""}
+		if name == "" {
+			f.name = sf.Name
+		}
+		for opt := range strings.SplitSeq(opts, ",") {
+			f.omitEmpty = f.omitEmpty || opt == "omitempty"
+			f.omitZero = f.omitZero || opt == "omitzero"
+		}
+		*all = append(*all, f)
 	}
-	e.buf = binary.LittleEndian.AppendUint16(e.buf, uint16(len(msg)))
-	e.buf = append(e.buf, msg...)
-	return e
 }
 
-func (e *BinaryEvent) Msg(msg string) {
-	e.Str("message", msg)
-	payloadSize := len(e.buf) - 6
-	binary.LittleEndian.PutUint16(e.buf[0:2], BinTypeInfo)
-	binary.LittleEndian.PutUint32(e.buf[2:6], uint32(payloadSize))
+// fieldByIndex returns the field of v at index, or false if it is behind a
+// nil embedded pointer.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
 
-	e.out.Write(e.buf)
-	e.pool.Put(e)
-}
\ No newline at end of file
+// isEmptyValue reports whether v is empty as omitempty means it.
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+// isZeroValue reports whether v is zero as omitzero means it: by its IsZero
+// method if it has one.
+func isZeroValue(v reflect.Value) bool {
+	if z, ok := v.Interface().(interface{ IsZero() bool }); ok {
+		return (v.Kind() == reflect.Pointer && v.IsNil()) || z.IsZero()
+	}
+	return v.IsZero()
+}
+
+// isNilPointer reports whether v holds a nil pointer, whose methods may not be
+// safe to call.
+func isNilPointer(v any) bool {
+	rv := reflect.ValueOf(v)
+	return rv.Kind() == reflect.Pointer && rv.IsNil()
+}
@@ -0,0 +1,574 @@
+package bark
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// ErrMalformed is returned when a binary frame cannot be decoded.
+var ErrMalformed = errors.New("bark: malformed binary record")
+
+// ErrFrameHeader is returned by BinaryReader for a frame header no Logger
+// writes, as when the input is not a binary log. Unlike ErrMalformed, the
+// stream cannot be read past it.
+var ErrFrameHeader = errors.New("bark: bad frame header")
+
+// frameChunk is how far the frame buffer grows ahead of the bytes read, so
+// that a corrupt length does not allocate more than the input holds.
+const frameChunk = 1 << 20
+
+// BinaryField is a decoded key/value pair. Value holds the Go type the field
+// was written with: string for strings and errors, []byte, the sized integer,
+// float and complex types, bool, time.Time, time.Duration, netip.Addr,
+// netip.Prefix, net.HardwareAddr, [16]byte for UUIDs and json.RawMessage for
+// raw JSON. Values written with Any decode to nil, []any and map[string]any
+// for their composite parts, and encrypted values to EncryptedValue until
+// BinaryRecord.Decrypt is called.
+type BinaryField struct {
+	Key   string
+	Tag   uint8
+	Value any
+}
+
+// BinaryRecord is a decoded binary frame.
+type BinaryRecord struct {
+	Type   uint16
+	Time   time.Time
+	Fields []BinaryField
+
+	// Size is the number of bytes the record took in its stream, and Sizes
+	// the number each of its fields took, key included.
+	Size  int
+	Sizes []int
+}
+
+// Get returns the value of the first field named key.
+func (r *BinaryRecord) Get(key string) (any, bool) {
+	for _, f := range r.Fields {
+		if f.Key == key {
+			return f.Value, true
+		}
+	}
+	return nil, false
+}
+
+// Level returns the level recorded in the frame type.
+func (r *BinaryRecord) Level() Level {
+	if r.Type == BinTypeCheckpoint {
+		return LevelInfo
+	}
+	return Level(int(r.Type) - 1)
+}
+
+// Message returns the record message, the field named "message". Readers
+// given the FieldNames of a logger store its message under that name.
+func (r *BinaryRecord) Message() string {
+	v, _ := r.Get("message")
+	s, _ := v.(string)
+	return s
+}
+
+// AppendJSON renders the record as a JSON object in the layout Logger writes,
+// with raw JSON fields nested as documents and Any values as their JSON
+// encoding.
+func (r *BinaryRecord) AppendJSON(dst []byte) []byte {
+	dst = append(dst, `{"level":"`...)
+	dst = append(dst, r.Level().String()...)
+	dst = append(dst, `","time":`...)
+	dst = appendTimeValue(dst, r.Time, TimeRFC3339)
+	for _, f := range r.Fields {
+		dst = append(dst, ',')
+		dst = appendString(dst, f.Key)
+		dst = append(dst, ':')
+		dst = appendJSONValue(dst, f)
+	}
+	return append(dst, '}')
+}
+
+// appendJSONValue writes a decoded field value the way the matching Event
+// method would.
+func appendJSONValue(dst []byte, f BinaryField) []byte {
+	switch v := f.Value.(type) {
+	case nil:
+		return append(dst, "null"...)
+	case string:
+		return appendString(dst, v)
+	case []byte:
+		dst = append(dst, '"')
+		if f.Tag == BinTagHex {
+			dst = appendHex(dst, v)
+		} else {
+			dst = base64.StdEncoding.AppendEncode(dst, v)
+		}
+		return append(dst, '"')
+	case int:
+		return strconv.AppendInt(dst, int64(v), 10)
+	case int8:
+		return strconv.AppendInt(dst, int64(v), 10)
+	case int16:
+		return strconv.AppendInt(dst, int64(v), 10)
+	case int32:
+		return strconv.AppendInt(dst, int64(v), 10)
+	case int64:
+		return strconv.AppendInt(dst, v, 10)
+	case uint:
+		return strconv.AppendUint(dst, uint64(v), 10)
+	case uint8:
+		return strconv.AppendUint(dst, uint64(v), 10)
+	case uint16:
+		return strconv.AppendUint(dst, uint64(v), 10)
+	case uint32:
+		return strconv.AppendUint(dst, uint64(v), 10)
+	case uint64:
+		return strconv.AppendUint(dst, v, 10)
+	case uintptr:
+		return strconv.AppendUint(dst, uint64(v), 10)
+	case float32:
+		return appendFloat(dst, float64(v), 32, &defaultOptions)
+	case float64:
+		return appendFloat(dst, v, 64, &defaultOptions)
+	case complex64:
+		return appendComplex(dst, complex128(v), 32, &defaultOptions)
+	case complex128:
+		return appendComplex(dst, v, 64, &defaultOptions)
+	case bool:
+		return strconv.AppendBool(dst, v)
+	case time.Time:
+		return appendTimeField(dst, v, TimeRFC3339)
+	case time.Duration:
+		return strconv.AppendFloat(dst, float64(v)/float64(time.Millisecond), 'f', -1, 64)
+	case netip.Addr:
+		if !v.IsValid() {
+			return append(dst, "null"...)
+		}
+		if v.Zone() != "" {
+			return appendString(dst, v.String())
+		}
+		return append(v.AppendTo(append(dst, '"')), '"')
+	case netip.Prefix:
+		if !v.IsValid() {
+			return append(dst, "null"...)
+		}
+		return append(v.AppendTo(append(dst, '"')), '"')
+	case net.HardwareAddr:
+		return appendString(dst, v.String())
+	case [16]byte:
+		return append(appendUUID(append(dst, '"'), v), '"')
+	case EncryptedValue:
+		return appendString(dst, v.String())
+	case json.RawMessage:
+		b := bytes.NewBuffer(dst)
+		if err := json.Compact(b, v); err != nil {
+			return appendString(dst, string(v))
+		}
+		return b.Bytes()
+	}
+	b, err := json.Marshal(f.Value)
+	if err != nil {
+		return appendString(dst, err.Error())
+	}
+	return append(dst, b...)
+}
+
+// DecodeBinary decodes one frame as written by BinaryLogger, header included.
+func DecodeBinary(frame []byte) (*BinaryRecord, error) {
+	return decodeBinary(frame, true)
+}
+
+// decodeBinary decodes frame, recording the field sizes if sizes is set.
+func decodeBinary(frame []byte, sizes bool) (*BinaryRecord, error) {
+	r := new(BinaryRecord)
+	if err := decodeBinaryTo(r, frame, sizes); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// decodeBinaryTo decodes frame into r, reusing its slices.
+func decodeBinaryTo(r *BinaryRecord, frame []byte, sizes bool) error {
+	if len(frame) < 14 {
+		return fmt.Errorf("%w: frame of %d bytes", ErrMalformed, len(frame))
+	}
+	size := int(binary.LittleEndian.Uint32(frame[2:6]))
+	if size != len(frame)-6 {
+		return fmt.Errorf("%w: payload length %d, have %d", ErrMalformed, size, len(frame)-6)
+	}
+
+	*r = BinaryRecord{
+		Type:   binary.LittleEndian.Uint16(frame[0:2]),
+		Time:   time.Unix(0, int64(binary.LittleEndian.Uint64(frame[6:14]))).UTC(),
+		Fields: r.Fields[:0],
+		Size:   len(frame),
+		Sizes:  r.Sizes[:0],
+	}
+	p := frame[14:]
+	for len(p) > 0 {
+		f, n, err := decodeField(p, 0)
+		if err != nil {
+			return err
+		}
+		r.Fields = append(r.Fields, f)
+		if sizes {
+			r.Sizes = append(r.Sizes, n)
+		}
+		p = p[n:]
+	}
+	return nil
+}
+
+// decodeField decodes the field at the start of p and returns it with the
+// number of bytes it occupied. depth is the nesting of the field in a value.
+func decodeField(p []byte, depth int) (BinaryField, int, error) {
+	var f BinaryField
+	if len(p) < 1 {
+		return f, 0, fmt.Errorf("%w: missing key", ErrMalformed)
+	}
+	kLen, off := int(p[0]), 1
+	if kLen == binKeyLong {
+		if len(p) < 5 {
+			return f, 0, fmt.Errorf("%w: truncated key length", ErrMalformed)
+		}
+		kLen, off = int(binary.LittleEndian.Uint32(p[1:5])), 5
+	}
+	if len(p) < off+kLen+1 {
+		return f, 0, fmt.Errorf("%w: truncated key", ErrMalformed)
+	}
+	f.Key = string(p[off : off+kLen])
+	off += kLen
+	f.Tag = p[off]
+	off++
+
+	v, n, err := decodeValue(f.Tag, p[off:], depth)
+	if err != nil {
+		return f, 0, fmt.Errorf("key %q: %w", f.Key, err)
+	}
+	f.Value = v
+	return f, off + n, nil
+}
+
+// decodeValue decodes a value of the given tag from the start of p. depth is
+// the nesting of the value in arrays and objects, which appendBinAny stops
+// one level past maxAnyDepth.
+func decodeValue(tag uint8, p []byte, depth int) (any, int, error) {
+	if depth > maxAnyDepth+1 {
+		return nil, 0, fmt.Errorf("%w: values nested over %d deep", ErrMalformed, maxAnyDepth)
+	}
+	need := func(n int) error {
+		if len(p) < n {
+			return fmt.Errorf("%w: tag %d needs %d bytes, have %d", ErrMalformed, tag, n, len(p))
+		}
+		return nil
+	}
+	le := binary.LittleEndian
+
+	switch tag {
+	case BinTagString, BinTagErr, BinTagBytes, BinTagStringLong, BinTagErrLong, BinTagBytesLong:
+		hdr := 2
+		if tag == BinTagStringLong || tag == BinTagErrLong || tag == BinTagBytesLong {
+			hdr = 4
+		}
+		if err := need(hdr); err != nil {
+			return nil, 0, err
+		}
+		var n int
+		if hdr == 2 {
+			n = int(le.Uint16(p))
+		} else {
+			n = int(le.Uint32(p))
+		}
+		if err := need(hdr + n); err != nil {
+			return nil, 0, err
+		}
+		val := p[hdr : hdr+n]
+		if tag == BinTagBytes || tag == BinTagBytesLong {
+			return append([]byte(nil), val...), hdr + n, nil
+		}
+		return string(val), hdr + n, nil
+	case BinTagInt8, BinTagUint8, BinTagBool:
+		if err := need(1); err != nil {
+			return nil, 0, err
+		}
+		switch tag {
+		case BinTagInt8:
+			return int8(p[0]), 1, nil
+		case BinTagUint8:
+			return p[0], 1, nil
+		}
+		return p[0] != 0, 1, nil
+	case BinTagInt16, BinTagUint16:
+		if err := need(2); err != nil {
+			return nil, 0, err
+		}
+		if tag == BinTagInt16 {
+			return int16(le.Uint16(p)), 2, nil
+		}
+		return le.Uint16(p), 2, nil
+	case BinTagInt32, BinTagUint32, BinTagFloat32:
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		v := le.Uint32(p)
+		switch tag {
+		case BinTagInt32:
+			return int32(v), 4, nil
+		case BinTagUint32:
+			return v, 4, nil
+		}
+		return math.Float32frombits(v), 4, nil
+	case BinTagInt, BinTagInt64, BinTagUint, BinTagUint64, BinTagUintptr, BinTagFloat64, BinTagTime, BinTagDuration, BinTagComplex64:
+		if err := need(8); err != nil {
+			return nil, 0, err
+		}
+		v := le.Uint64(p)
+		switch tag {
+		case BinTagInt:
+			return int(v), 8, nil
+		case BinTagInt64:
+			return int64(v), 8, nil
+		case BinTagUint:
+			return uint(v), 8, nil
+		case BinTagUint64:
+			return v, 8, nil
+		case BinTagUintptr:
+			return uintptr(v), 8, nil
+		case BinTagFloat64:
+			return math.Float64frombits(v), 8, nil
+		case BinTagTime:
+			return time.Unix(0, int64(v)).UTC(), 8, nil
+		case BinTagDuration:
+			return time.Duration(v), 8, nil
+		}
+		re := math.Float32frombits(le.Uint32(p[0:4]))
+		im := math.Float32frombits(le.Uint32(p[4:8]))
+		return complex(re, im), 8, nil
+	case BinTagComplex128:
+		if err := need(16); err != nil {
+			return nil, 0, err
+		}
+		re := math.Float64frombits(le.Uint64(p[0:8]))
+		im := math.Float64frombits(le.Uint64(p[8:16]))
+		return complex(re, im), 16, nil
+	case BinTagNull:
+		return nil, 0, nil
+	case BinTagHex:
+		if err := need(2); err != nil {
+			return nil, 0, err
+		}
+		n := int(le.Uint16(p))
+		if err := need(2 + n); err != nil {
+			return nil, 0, err
+		}
+		return append([]byte(nil), p[2:2+n]...), 2 + n, nil
+	case BinTagIPAddr, BinTagIPPrefix:
+		a, n, err := decodeAddr(p)
+		if err != nil {
+			return nil, 0, err
+		}
+		if tag == BinTagIPAddr {
+			return a, n, nil
+		}
+		if len(p) < n+1 {
+			return nil, 0, fmt.Errorf("%w: truncated prefix", ErrMalformed)
+		}
+		return netip.PrefixFrom(a, int(int8(p[n]))), n + 1, nil
+	case BinTagMAC:
+		if err := need(1); err != nil {
+			return nil, 0, err
+		}
+		n := int(p[0])
+		if err := need(1 + n); err != nil {
+			return nil, 0, err
+		}
+		return net.HardwareAddr(append([]byte(nil), p[1:1+n]...)), 1 + n, nil
+	case BinTagUUID:
+		if err := need(16); err != nil {
+			return nil, 0, err
+		}
+		return [16]byte(p[:16]), 16, nil
+	case BinTagRawJSON:
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		n := int(le.Uint32(p))
+		if err := need(4 + n); err != nil {
+			return nil, 0, err
+		}
+		return json.RawMessage(append([]byte(nil), p[4:4+n]...)), 4 + n, nil
+	case BinTagEncrypted:
+		return decodeEncrypted(p)
+	case BinTagAny:
+		if err := need(5); err != nil {
+			return nil, 0, err
+		}
+		n := int(le.Uint32(p))
+		if n < 1 {
+			return nil, 0, fmt.Errorf("%w: empty value", ErrMalformed)
+		}
+		if err := need(4 + n); err != nil {
+			return nil, 0, err
+		}
+		if p[4] == BinTagAny {
+			return nil, 0, fmt.Errorf("%w: nested tag %d", ErrMalformed, tag)
+		}
+		v, m, err := decodeValue(p[4], p[5:4+n], depth)
+		if err == nil && m != n-1 {
+			err = fmt.Errorf("%w: %d trailing bytes in value", ErrMalformed, n-1-m)
+		}
+		return v, 4 + n, err
+	case BinTagArray, BinTagObject:
+		if err := need(4); err != nil {
+			return nil, 0, err
+		}
+		count, off := int(le.Uint32(p)), 4
+		if tag == BinTagArray {
+			arr := make([]any, 0, min(count, len(p)))
+			for range count {
+				if err := need(off + 1); err != nil {
+					return nil, 0, err
+				}
+				v, n, err := decodeValue(p[off], p[off+1:], depth+1)
+				if err != nil {
+					return nil, 0, err
+				}
+				arr = append(arr, v)
+				off += 1 + n
+			}
+			return arr, off, nil
+		}
+		obj := make(map[string]any, min(count, len(p)))
+		for range count {
+			f, n, err := decodeField(p[off:], depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			obj[f.Key] = f.Value
+			off += n
+		}
+		return obj, off, nil
+	}
+	return nil, 0, fmt.Errorf("%w: unknown tag %d", ErrMalformed, tag)
+}
+
+// decodeAddr decodes the [Len][Addr][ZoneLen][Zone] form of an IP address.
+func decodeAddr(p []byte) (netip.Addr, int, error) {
+	if len(p) < 1 || len(p) < 2+int(p[0]) {
+		return netip.Addr{}, 0, fmt.Errorf("%w: truncated address", ErrMalformed)
+	}
+	n := int(p[0])
+	var a netip.Addr
+	switch n {
+	case 0:
+	case 4:
+		a = netip.AddrFrom4([4]byte(p[1:5]))
+	case 16:
+		a = netip.AddrFrom16([16]byte(p[1:17]))
+	default:
+		return a, 0, fmt.Errorf("%w: address of %d bytes", ErrMalformed, n)
+	}
+	zLen := int(p[1+n])
+	if len(p) < 2+n+zLen {
+		return a, 0, fmt.Errorf("%w: truncated zone", ErrMalformed)
+	}
+	if zLen > 0 {
+		a = a.WithZone(string(p[2+n : 2+n+zLen]))
+	}
+	return a, 2 + n + zLen, nil
+}
+
+// BinaryReader reads consecutive frames from a stream written by
+// BinaryLogger.
+type BinaryReader struct {
+	// Keyring, if set, decrypts the encrypted fields of the records returned
+	// by Next.
+	Keyring Keyring
+	// FieldNames must match the names the logger was configured with by
+	// WithFieldNames, if any. Only the message name is used: the message is
+	// read back under "message", as JSONReader does.
+	FieldNames FieldNames
+
+	r       *bufio.Reader
+	buf     []byte
+	started bool
+}
+
+// NewBinaryReader returns a reader of the frames in r. A block stream written
+// by BlockWriter with a built-in codec is recognized and decompressed.
+func NewBinaryReader(r io.Reader) *BinaryReader {
+	return &BinaryReader{r: bufio.NewReader(r)}
+}
+
+// NextFrame returns the raw bytes of the next frame, header included. The
+// slice is only valid until the next call. It returns io.EOF at a clean end
+// of stream, io.ErrUnexpectedEOF inside a partial frame and ErrFrameHeader
+// for a header that cannot start a frame.
+func (r *BinaryReader) NextFrame() ([]byte, error) {
+	if !r.started {
+		r.started = true
+		if magic, _ := r.r.Peek(len(BlockMagic)); string(magic) == BlockMagic {
+			r.r = bufio.NewReader(NewBlockReader(r.r))
+		}
+	}
+	if cap(r.buf) < 6 {
+		r.buf = make([]byte, 6, 512)
+	}
+	r.buf = r.buf[:6]
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		return nil, err
+	}
+	typ := binary.LittleEndian.Uint16(r.buf[0:2])
+	size := int(binary.LittleEndian.Uint32(r.buf[2:6]))
+	// Types are one above an int8 Level, and every frame has a timestamp.
+	if (typ > binType(math.MaxInt8) && typ < binType(math.MinInt8) && typ != BinTypeCheckpoint) || size < 8 {
+		return nil, fmt.Errorf("%w: type %d, length %d", ErrFrameHeader, typ, size)
+	}
+	for len(r.buf) < 6+size {
+		n := len(r.buf)
+		r.buf = slices.Grow(r.buf, min(6+size-n, frameChunk))[:min(6+size, n+frameChunk)]
+		if _, err := io.ReadFull(r.r, r.buf[n:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	return r.buf, nil
+}
+
+// Next decodes the next frame, decrypting its fields if a Keyring is set.
+// When a field fails to decrypt, the record is returned along with the
+// error, holding that field still encrypted.
+func (r *BinaryReader) Next() (*BinaryRecord, error) {
+	frame, err := r.NextFrame()
+	if err != nil {
+		return nil, err
+	}
+	rec, err := DecodeBinary(frame)
+	if err != nil {
+		return rec, err
+	}
+	// Encrypted values are bound to the key they were written under, so the
+	// message is renamed after decrypting.
+	if r.Keyring != nil {
+		err = rec.Decrypt(r.Keyring)
+	}
+	if name := r.FieldNames.message(); name != "message" {
+		for i := range rec.Fields {
+			if rec.Fields[i].Key == name {
+				rec.Fields[i].Key = "message"
+			}
+		}
+	}
+	return rec, err
+}
@@ -0,0 +1,468 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBinaryReaderRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewBinaryLogger(&buf)
+
+	ts := time.Date(2024, 2, 29, 23, 59, 58, 123456789, time.UTC)
+	long := strings.Repeat("L", 70000)
+	l.Info().
+		Str("str", "foo").
+		Str(strings.Repeat("k", 300), long).
+		Bytes("bytes", []byte{1, 2}).
+		Int("int", -1).
+		Int8("int8", -8).
+		Int16("int16", -16).
+		Int32("int32", -32).
+		Int64("int64", -64).
+		Uint("uint", 1).
+		Uint8("uint8", 8).
+		Uint16("uint16", 16).
+		Uint32("uint32", 32).
+		Uint64("uint64", 64).
+		Uintptr("uintptr", 128).
+		Float32("float32", 1.5).
+		Float64("float64", 2.5).
+		Complex64("complex64", 1+2i).
+		Complex128("complex128", 3+4i).
+		Bool("bool", true).
+		Time("at", ts).
+		Dur("took", 1500*time.Millisecond).
+		Error(errors.New("boom")).
+		Msg("hello")
+	l.Info().Msg("second")
+
+	r := NewBinaryReader(&buf)
+	rec, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Type != BinTypeInfo {
+		t.Errorf("expected type %d, got %d", BinTypeInfo, rec.Type)
+	}
+	if time.Since(rec.Time) > time.Minute {
+		t.Errorf("unexpected record time %v", rec.Time)
+	}
+
+	expected := []struct {
+		key string
+		tag uint8
+		val any
+	}{
+		{"str", BinTagString, "foo"},
+		{strings.Repeat("k", 300), BinTagStringLong, long},
+		{"bytes", BinTagBytes, []byte{1, 2}},
+		{"int", BinTagInt, -1},
+		{"int8", BinTagInt8, int8(-8)},
+		{"int16", BinTagInt16, int16(-16)},
+		{"int32", BinTagInt32, int32(-32)},
+		{"int64", BinTagInt64, int64(-64)},
+		{"uint", BinTagUint, uint(1)},
+		{"uint8", BinTagUint8, uint8(8)},
+		{"uint16", BinTagUint16, uint16(16)},
+		{"uint32", BinTagUint32, uint32(32)},
+		{"uint64", BinTagUint64, uint64(64)},
+		{"uintptr", BinTagUintptr, uintptr(128)},
+		{"float32", BinTagFloat32, float32(1.5)},
+		{"float64", BinTagFloat64, 2.5},
+		{"complex64", BinTagComplex64, complex64(1 + 2i)},
+		{"complex128", BinTagComplex128, 3 + 4i},
+		{"bool", BinTagBool, true},
+		{"at", BinTagTime, ts},
+		{"took", BinTagDuration, 1500 * time.Millisecond},
+		{"error", BinTagErr, "boom"},
+		{"message", BinTagString, "hello"},
+	}
+	if len(rec.Fields) != len(expected) {
+		t.Fatalf("expected %d fields, got %d", len(expected), len(rec.Fields))
+	}
+	for i, exp := range expected {
+		f := rec.Fields[i]
+		if f.Key != exp.key || f.Tag != exp.tag || !reflect.DeepEqual(f.Value, exp.val) {
+			t.Errorf("field %d: expected %.20s/%d/%.20v, got %.20s/%d/%.20v", i, exp.key, exp.tag, exp.val, f.Key, f.Tag, f.Value)
+		}
+	}
+
+	rec, err = r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Message() != "second" {
+		t.Errorf("expected second message, got %q", rec.Message())
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestBinaryReaderMalformed(t *testing.T) {
+	var buf bytes.Buffer
+	NewBinaryLogger(&buf).Info().Str("k", "v").Msg("m")
+	frame := buf.Bytes()
+
+	if _, err := NewBinaryReader(bytes.NewReader(frame[:len(frame)-1])).Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected io.ErrUnexpectedEOF for a partial frame, got %v", err)
+	}
+
+	bad := bytes.Clone(frame)
+	bad[16] = 0xEE // tag of the first field
+	if _, err := DecodeBinary(bad); !errors.Is(err, ErrMalformed) {
+		t.Errorf("expected ErrMalformed for an unknown tag, got %v", err)
+	}
+}
+
+func TestBinaryAnyRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewBinaryLogger(&buf)
+
+	type inner struct {
+		At   time.Time
+		Skip string `json:"-"`
+		priv int
+	}
+	ts := time.Unix(1700000000, 0).UTC()
+	l.Info().
+		Any("int", 7).
+		Any("err", errors.New("bad")).
+		Any("text", textID(3)).
+		Interface("struct", struct {
+			Name  string `json:"name,omitempty"`
+			Inner *inner
+			IDs   []uint16
+			Raw   [2]byte
+			Map   map[int]bool
+			Nil   []int
+		}{"n", &inner{At: ts, Skip: "x", priv: 1}, []uint16{1, 2}, [2]byte{9, 8}, map[int]bool{2: true, 1: false}, nil}).
+		Msg("any")
+
+	rec, err := NewBinaryReader(&buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []BinaryField{
+		{"int", BinTagInt, 7},
+		{"err", BinTagErr, "bad"},
+		{"text", BinTagString, "id-3"},
+		{"struct", BinTagAny, map[string]any{
+			"name":  "n",
+			"Inner": map[string]any{"At": ts},
+			"IDs":   []any{uint16(1), uint16(2)},
+			"Raw":   []byte{9, 8},
+			"Map":   map[string]any{"1": false, "2": true},
+			"Nil":   nil,
+		}},
+		{"message", BinTagString, "any"},
+	}
+	if !reflect.DeepEqual(rec.Fields, expected) {
+		t.Errorf("decoded fields mismatch:\n got %#v\nwant %#v", rec.Fields, expected)
+	}
+}
+
+func TestBinaryNetworkRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewBinaryLogger(&buf)
+
+	mac := net.HardwareAddr{0, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}
+	uuid := [16]byte{0x12, 0x3e, 0x45, 0x67}
+	l.Info().
+		Stringer("dur", time.Second).
+		Stringer("nil", nil).
+		Hex("hex", []byte{0xde, 0xad}).
+		IPAddr("v4", netip.MustParseAddr("192.168.0.1")).
+		IPAddr("v6", netip.MustParseAddr("fe80::1%eth0")).
+		IPAddr("zero", netip.Addr{}).
+		IPPrefix("net", netip.MustParsePrefix("2001:db8::/32")).
+		MACAddr("mac", mac).
+		UUID("uuid", uuid).
+		Msg("net")
+
+	rec, err := NewBinaryReader(&buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []BinaryField{
+		{"dur", BinTagString, "1s"},
+		{"nil", BinTagNull, nil},
+		{"hex", BinTagHex, []byte{0xde, 0xad}},
+		{"v4", BinTagIPAddr, netip.MustParseAddr("192.168.0.1")},
+		{"v6", BinTagIPAddr, netip.MustParseAddr("fe80::1%eth0")},
+		{"zero", BinTagIPAddr, netip.Addr{}},
+		{"net", BinTagIPPrefix, netip.MustParsePrefix("2001:db8::/32")},
+		{"mac", BinTagMAC, mac},
+		{"uuid", BinTagUUID, uuid},
+		{"message", BinTagString, "net"},
+	}
+	if !reflect.DeepEqual(rec.Fields, expected) {
+		t.Errorf("decoded fields mismatch:\n got %#v\nwant %#v", rec.Fields, expected)
+	}
+}
+
+func TestNetworkLongValues(t *testing.T) {
+	// The cut at 255 bytes falls inside the é.
+	zone := "a\"b\n" + strings.Repeat("z", 250) + "é" + strings.Repeat("z", 50)
+	addr := netip.MustParseAddr("fe80::1").WithZone(zone)
+	mac := net.HardwareAddr(bytes.Repeat([]byte{0xab}, 300))
+
+	var buf bytes.Buffer
+	NewBinaryLogger(&buf).Info().IPAddr("ip", addr).MACAddr("mac", mac).Str("after", "ok").Msg("long")
+	rec, err := NewBinaryReader(&buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip, _ := rec.Get("ip")
+	if got := ip.(netip.Addr).Zone(); got != zone[:254] {
+		t.Errorf("zone cut to %d bytes: %q", len(got), got)
+	}
+	if m, _ := rec.Get("mac"); len(m.(net.HardwareAddr)) != 255 {
+		t.Errorf("MAC of %d bytes", len(m.(net.HardwareAddr)))
+	}
+	if v, _ := rec.Get("after"); v != "ok" {
+		t.Errorf("field after the long values = %v", v)
+	}
+	if out := rec.AppendJSON(nil); !json.Valid(out) {
+		t.Errorf("rendered record is not valid JSON: %s", out)
+	}
+
+	buf.Reset()
+	NewLogger(&buf).Info().IPAddr("ip", addr).Msg("zone")
+	var m map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil || m["ip"] != addr.String() {
+		t.Errorf("JSON zone: %v: %s", err, buf.Bytes())
+	}
+
+	buf.Reset()
+	NewLogger(&buf, WithFormat(FormatLogfmt)).Info().IPAddr("ip", netip.MustParseAddr("fe80::1%a b")).Msg("zone")
+	if !strings.Contains(buf.String(), `ip="fe80::1%a b"`) {
+		t.Errorf("logfmt zone: %s", buf.Bytes())
+	}
+}
+
+func TestBinaryRecordAppendJSON(t *testing.T) {
+	var buf bytes.Buffer
+	NewBinaryLogger(&buf).Info().
+		Str("str", "a\"b").
+		RawJSON("body", []byte("{\"event\": \"push\",\n \"ids\": [1, 2]}")).
+		Any("marshaler", indentedJSON{}).
+		Any("map", map[string]int{"x": 1}).
+		Hex("hex", []byte{0xbe, 0xef}).
+		Bytes("bytes", []byte("bar")).
+		Int8("int8", -8).
+		Dur("took", 1500*time.Microsecond).
+		IPAddr("ip", netip.MustParseAddr("10.0.0.1")).
+		UUID("uuid", [16]byte{0x12, 0x3e}).
+		Msg("rendered")
+
+	rec, err := NewBinaryReader(&buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rec.Get("body"); !reflect.DeepEqual(v, json.RawMessage("{\"event\": \"push\",\n \"ids\": [1, 2]}")) {
+		t.Errorf("raw JSON not decoded as json.RawMessage: %#v", v)
+	}
+
+	out := rec.AppendJSON(nil)
+	expected := []string{
+		`{"level":"info","time":"`,
+		`"str":"a\"b"`,
+		`"body":{"event":"push","ids":[1,2]}`,
+		`"marshaler":{"a":1}`,
+		`"map":{"x":1}`,
+		`"hex":"beef"`,
+		`"bytes":"YmFy"`,
+		`"int8":-8`,
+		`"took":1.5`,
+		`"ip":"10.0.0.1"`,
+		`"uuid":"123e0000-0000-0000-0000-000000000000"`,
+		`"message":"rendered"}`,
+	}
+	for _, sub := range expected {
+		if !bytes.Contains(out, []byte(sub)) {
+			t.Errorf("missing %q in output: %s", sub, out)
+		}
+	}
+	var m map[string]any
+	if err := json.Unmarshal(out, &m); err != nil {
+		t.Errorf("rendered record is not valid JSON: %v: %s", err, out)
+	}
+}
+
+func TestBinaryRecordSizes(t *testing.T) {
+	var buf bytes.Buffer
+	NewBinaryLogger(&buf).Info().Str("user", "alice").Int64("n", 1).Msg("hi")
+	rec, err := DecodeBinary(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// [KeyLen][Key][Tag] then the value: a 2-byte length and the string, or
+	// eight bytes.
+	want := []int{1 + 4 + 1 + 2 + 5, 1 + 1 + 1 + 8, 1 + 7 + 1 + 2 + 2}
+	if rec.Size != buf.Len() || !reflect.DeepEqual(rec.Sizes, want) {
+		t.Errorf("size %d of %d, field sizes %v, want %v", rec.Size, buf.Len(), rec.Sizes, want)
+	}
+}
+
+func TestBinaryAnyMalformed(t *testing.T) {
+	// frame wraps a BinTagAny value of the given bytes in a record.
+	frame := func(val ...byte) []byte {
+		f := []byte{1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1, 'k', BinTagAny}
+		f = append(f, val...)
+		binary.LittleEndian.PutUint32(f[2:6], uint32(len(f)-6))
+		return f
+	}
+	// deep nests a null in depth arrays, with the length of the value.
+	deep := func(depth int) []byte {
+		var v []byte
+		for range depth {
+			v = append(v, BinTagArray, 1, 0, 0, 0)
+		}
+		v = append(v, BinTagNull)
+		return append(binary.LittleEndian.AppendUint32(nil, uint32(len(v))), v...)
+	}
+
+	tests := []struct {
+		name string
+		val  []byte
+	}{
+		{"no length", nil},
+		{"truncated length", []byte{1, 0}},
+		{"zero length", []byte{0, 0, 0, 0}},
+		{"zero length with tag", []byte{0, 0, 0, 0, BinTagNull}},
+		{"truncated value", []byte{5, 0, 0, 0, BinTagInt64, 1}},
+		{"short length", []byte{1, 0, 0, 0, BinTagInt64, 1, 2, 3, 4, 5, 6, 7, 8}},
+		{"trailing bytes", []byte{3, 0, 0, 0, BinTagNull, 0, 0}},
+		{"truncated array", []byte{5, 0, 0, 0, BinTagArray, 2, 0, 0, 0}},
+		{"nested any", []byte{6, 0, 0, 0, BinTagAny, 1, 0, 0, 0, BinTagNull}},
+		{"too deep", deep(maxAnyDepth + 2)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeBinary(frame(tt.val...)); !errors.Is(err, ErrMalformed) {
+				t.Errorf("expected ErrMalformed, got %v", err)
+			}
+		})
+	}
+
+	if _, err := DecodeBinary(frame(deep(maxAnyDepth + 1)...)); err != nil {
+		t.Errorf("nesting the encoder writes: %v", err)
+	}
+}
+
+type anyBase struct {
+	ID   int    `json:"id"`
+	Kind string `json:"kind,omitempty"`
+}
+
+type anyMeta struct {
+	Kind  string
+	Owner string
+}
+
+type anyTagged struct {
+	Kind  string `json:"Kind"`
+	Owner string
+}
+
+func TestBinaryAnyMatchesJSON(t *testing.T) {
+	type doc struct {
+		anyBase
+		*anyMeta
+		anyTagged
+		Name    string            `json:"name,omitempty"`
+		Empty   []int             `json:"empty,omitempty"`
+		Zero    time.Time         `json:"zero,omitzero"`
+		At      time.Time         `json:"at"`
+		Took    time.Duration     `json:"took"`
+		Text    textID            `json:"text"`
+		TextPtr *textID           `json:"text_ptr"`
+		Raw     indentedJSON      `json:"raw"`
+		Keys    map[textID]string `json:"keys"`
+		List    []any             `json:"list"`
+	}
+	id := textID(5)
+	val := doc{
+		anyBase:   anyBase{ID: 1, Kind: "base"},
+		anyMeta:   &anyMeta{Kind: "meta", Owner: "ops"},
+		anyTagged: anyTagged{Kind: "tagged", Owner: "dev"},
+		At:        time.Unix(1700000000, 5).UTC(),
+		Took:      time.Second,
+		Text:      4,
+		TextPtr:   &id,
+		Keys:      map[textID]string{1: "a", 2: "b"},
+		List:      []any{1, "x", nil, textID(6)},
+	}
+
+	var buf bytes.Buffer
+	NewBinaryLogger(&buf).Info().Any("doc", val).Any("nometa", doc{At: val.At}).Msg("m")
+	rec, err := NewBinaryReader(&buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []doc{val, {At: val.At}} {
+		exp, _ := json.Marshal(want)
+		got, _ := json.Marshal(rec.Fields[i].Value)
+		var e, g any
+		json.Unmarshal(exp, &e)
+		json.Unmarshal(got, &g)
+		if !reflect.DeepEqual(e, g) {
+			t.Errorf("field %d differs from encoding/json:\n got %s\nwant %s", i, got, exp)
+		}
+	}
+}
+
+func TestBinaryAnyDifferences(t *testing.T) {
+	var buf bytes.Buffer
+	NewBinaryLogger(&buf).Info().Any("v", struct {
+		At    time.Time
+		Took  time.Duration
+		Array [2]byte
+		N     int `json:",string"`
+		Deep  any
+	}{
+		At:    time.Unix(1, 0).UTC(),
+		Took:  time.Second,
+		Array: [2]byte{1, 2},
+		N:     3,
+		Deep:  nest(maxAnyDepth + 5),
+	}).Msg("m")
+	rec, err := NewBinaryReader(&buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := rec.Fields[0].Value.(map[string]any)
+	if m["At"] != time.Unix(1, 0).UTC() || m["Took"] != time.Second {
+		t.Errorf("times and durations keep their types: %#v, %#v", m["At"], m["Took"])
+	}
+	if !reflect.DeepEqual(m["Array"], []byte{1, 2}) || m["N"] != 3 {
+		t.Errorf("byte arrays are bytes and ,string is ignored: %#v, %#v", m["Array"], m["N"])
+	}
+	depth := 1
+	for v := m["Deep"]; v != nil; v = v.([]any)[0] {
+		depth++
+	}
+	if depth > maxAnyDepth {
+		t.Errorf("nesting not cut: %d levels", depth)
+	}
+}
+
+// nest returns a null in depth nested slices.
+func nest(depth int) any {
+	if depth == 0 {
+		return nil
+	}
+	return []any{nest(depth - 1)}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"math"
 	"strings"
@@ -160,31 +161,81 @@ func TestBinaryLoggerEdgeCases(t *testing.T) {
 	data = buf.Bytes()
 	offset := 14
 
-	kLen := int(data[offset])
-	if kLen != 255 {
-		t.Errorf("expected key truncated to 255, got %d", kLen)
+	if data[offset] != binKeyLong {
+		t.Fatalf("expected long key marker, got %d", data[offset])
 	}
 	offset++
+	kLen := int(binary.LittleEndian.Uint32(data[offset : offset+4]))
+	if kLen != 300 {
+		t.Errorf("expected key length 300, got %d", kLen)
+	}
+	offset += 4
+	if string(data[offset:offset+kLen]) != hugeKey {
+		t.Error("long key mangled")
+	}
 	offset += kLen
 
 	tag := data[offset]
-	if tag != BinTagString {
-		t.Fatal("expected string tag")
+	if tag != BinTagStringLong {
+		t.Fatalf("expected long string tag, got %d", tag)
 	}
 	offset++
 
-	vLen := int(binary.LittleEndian.Uint16(data[offset : offset+2]))
-	if vLen != 65535 {
-		t.Errorf("expected value truncated to 65535, got %d", vLen)
+	vLen := int(binary.LittleEndian.Uint32(data[offset : offset+4]))
+	if vLen != 70000 {
+		t.Errorf("expected value length 70000, got %d", vLen)
+	}
+	offset += 4
+	if string(data[offset:offset+vLen]) != hugeStr {
+		t.Error("long value mangled")
 	}
-	
+
 	buf.Reset()
 	hugeBytes := make([]byte, 70000)
 	l.Info().Bytes("b", hugeBytes).Msg("huge_bytes")
 	data = buf.Bytes()
-	vLen = int(binary.LittleEndian.Uint16(data[17:19]))
-	if vLen != 65535 {
-		t.Errorf("expected bytes truncated to 65535, got %d", vLen)
+	if data[16] != BinTagBytesLong {
+		t.Fatalf("expected long bytes tag, got %d", data[16])
+	}
+	vLen = int(binary.LittleEndian.Uint32(data[17:21]))
+	if vLen != 70000 {
+		t.Errorf("expected bytes length 70000, got %d", vLen)
+	}
+}
+
+func TestBinaryLoggerMaxValueSize(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewBinaryLogger(&buf, WithMaxValueSize(3))
+
+	// The cut at 3 bytes falls inside the first "é", so it backs off to "ab".
+	l.Info().Str("s", "abéé").Msg("m")
+	data := buf.Bytes()
+
+	offset := 14 + 3
+	vLen := int(binary.LittleEndian.Uint16(data[offset : offset+2]))
+	offset += 2
+	if got := string(data[offset : offset+vLen]); got != "ab" {
+		t.Errorf("expected truncated value %q, got %q", "ab", got)
+	}
+	offset += vLen
+
+	marker := "s_truncated"
+	if int(data[offset]) != len(marker) || string(data[offset+1:offset+1+len(marker)]) != marker {
+		t.Fatal("missing truncation marker field")
+	}
+	offset += 1 + len(marker)
+	if data[offset] != BinTagUint64 {
+		t.Fatalf("expected uint64 marker tag, got %d", data[offset])
+	}
+	offset++
+	if n := binary.LittleEndian.Uint64(data[offset : offset+8]); n != 6 {
+		t.Errorf("expected original length 6, got %d", n)
+	}
+
+	buf.Reset()
+	l.Info().Str("s", "abc").Msg("m")
+	if bytes.Contains(buf.Bytes(), []byte("_truncated")) {
+		t.Error("marker written for a value within the limit")
 	}
 }
 
@@ -214,4 +265,94 @@ func BenchmarkBinaryLogger(b *testing.B) {
 			Bool("enabled", true).
 			Msg("benchmark")
 	}
-}
\ No newline at end of file
+}
+func TestBinaryLoggerMaxRecordSize(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewBinaryLogger(&buf, WithMaxRecordSize(64, OverflowTruncate))
+
+	l.Info().Bytes("blob", make([]byte, 4096)).Int("n", 1).Msg(strings.Repeat("m", 100))
+	data := buf.Bytes()
+	if len(data) > 64 {
+		t.Errorf("record exceeds limit: %d bytes", len(data))
+	}
+	if int(binary.LittleEndian.Uint32(data[2:6])) != len(data)-6 {
+		t.Error("header length does not match payload")
+	}
+	if bytes.Contains(data, []byte("blob")) {
+		t.Error("oversized field was not omitted")
+	}
+	if !bytes.Contains(data, []byte{1, 'n', BinTagInt}) {
+		t.Error("field within the limit was dropped")
+	}
+	if !bytes.HasSuffix(data, []byte("_truncated\x0e\x01")) {
+		t.Error("missing truncation marker")
+	}
+
+	buf.Reset()
+	l = NewBinaryLogger(&buf, WithMaxRecordSize(64, OverflowDrop))
+	l.Info().Str("big", strings.Repeat("x", 100)).Msg("dropped")
+	if buf.Len() != 0 {
+		t.Errorf("expected record to be dropped, got %d bytes", buf.Len())
+	}
+
+	l = NewBinaryLogger(&buf, WithMaxRecordSize(64, OverflowReplace))
+	l.Info().Str("big", strings.Repeat("x", 100)).Msg("replaced")
+	data = buf.Bytes()
+	if !bytes.Contains(data, []byte("record exceeded size limit")) || bytes.Contains(data, []byte("replaced")) {
+		t.Error("record was not replaced with a warning")
+	}
+}
+
+func TestBinaryLoggerDuplicateKeys(t *testing.T) {
+	cases := []struct {
+		policy DuplicatePolicy
+		keys   []string
+		vals   []int
+	}{
+		{DuplicateAllow, []string{"a", "b", "a", "a"}, []int{1, 2, 3, 4}},
+		{DuplicateDrop, []string{"a", "b"}, []int{1, 2}},
+		{DuplicateRename, []string{"a", "b", "a_1", "a_2"}, []int{1, 2, 3, 4}},
+		{DuplicateOverwrite, []string{"b", "a"}, []int{2, 4}},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		NewBinaryLogger(&buf, WithDuplicateKeys(c.policy)).Info().
+			Int("a", 1).Int("b", 2).Str("message", "field").Int("a", 3).Int("a", 4).
+			Msg("m")
+
+		rec, err := DecodeBinary(buf.Bytes())
+		if err != nil {
+			t.Fatalf("policy %d: %v", c.policy, err)
+		}
+		var keys []string
+		var vals []int
+		for _, f := range rec.Fields {
+			if f.Key == "message" {
+				continue
+			}
+			keys = append(keys, f.Key)
+			vals = append(vals, f.Value.(int))
+		}
+		if strings.Join(keys, ",") != strings.Join(c.keys, ",") || fmt.Sprint(vals) != fmt.Sprint(c.vals) {
+			t.Errorf("policy %d: got keys %v vals %v, want %v %v", c.policy, keys, vals, c.keys, c.vals)
+		}
+		if c.policy != DuplicateAllow && (rec.Message() != "m" || len(rec.Fields) != len(c.keys)+1) {
+			t.Errorf("policy %d: message field not deduplicated: %v", c.policy, rec.Fields)
+		}
+	}
+
+	// The level and time are not fields of binary records, so fields of those
+	// names are kept.
+	for _, p := range []DuplicatePolicy{DuplicateDrop, DuplicateRename, DuplicateOverwrite} {
+		var buf bytes.Buffer
+		NewBinaryLogger(&buf, WithDuplicateKeys(p)).Info().
+			Str("level", "l").Str("time", "t").Msg("m")
+		rec, err := DecodeBinary(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rec.Fields) != 3 || rec.Fields[0].Key != "level" || rec.Fields[1].Key != "time" {
+			t.Errorf("policy %d: got %v", p, rec.Fields)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"maps"
+	"math"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+	"unicode/utf8"
+)
+
+// CBOR major types, already shifted into the high three bits.
+const (
+	cborUint   = 0 << 5
+	cborNeg    = 1 << 5
+	cborBytes  = 2 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborTag    = 6 << 5
+	cborSimple = 7 << 5
+)
+
+const (
+	cborFalse = cborSimple | 20
+	cborTrue  = cborSimple | 21
+	cborNull  = cborSimple | 22
+
+	// cborMap32 starts a map whose count is patched in once the record is
+	// complete.
+	cborMap32 = cborMap | 26
+
+	cborTagEpoch = 1
+	cborTagUUID  = 37
+)
+
+// CBORLogger and CBOREvent name the Logger and Event types to go with
+// NewCBORLogger.
+type (
+	CBORLogger = Logger
+	CBOREvent  = Event
+)
+
+// NewCBORLogger returns a Logger writing CBOR. It is short for NewLogger with
+// WithFormat(FormatCBOR).
+func NewCBORLogger(w io.Writer, opts ...Option) *CBORLogger {
+	return NewLogger(w, append(opts[:len(opts):len(opts)], WithFormat(FormatCBOR))...)
+}
+
+// cborEncoder writes each record as a CBOR map (RFC 8949), so a log stream is
+// a CBOR sequence (RFC 8742) that any CBOR library can decode:
+//
+//	{"level": "info", "time": 1(1696161600.5), "user_id": "u123", "message": "..."}
+//
+// Values keep their native CBOR types: integers, floats, byte strings, booleans
+// and null. Times are written as epoch-based date/time (tag 1) and UUIDs as
+// tag 37. Durations and complex numbers follow the logger options as for JSON,
+// while floats are always written natively, NaN and infinities included.
+// Values from RawJSON and Any are converted to CBOR maps and arrays.
+type cborEncoder struct {
+	o *options
+}
+
+// Begin starts a map whose count End patches in once the record is complete.
+func (enc cborEncoder) Begin(dst []byte, t time.Time, level Level) []byte {
+	dst = append(dst, cborMap32, 0, 0, 0, 0)
+	dst = appendCBORText(dst, enc.o.names.level())
+	dst = appendCBORText(dst, level.String())
+	dst = appendCBORText(dst, enc.o.names.time())
+	return appendCBORTime(dst, t)
+}
+
+func (cborEncoder) End(dst []byte, n int) []byte {
+	binary.BigEndian.PutUint32(dst[1:5], uint32(n+2))
+	return dst
+}
+
+// AppendKey writes key as a text string, replacing invalid UTF-8.
+func (cborEncoder) AppendKey(dst []byte, key string) []byte {
+	return appendCBORText(dst, key)
+}
+
+func (cborEncoder) AppendString(dst []byte, val string) []byte {
+	return appendCBORText(dst, val)
+}
+
+// AppendBytes writes val as a CBOR byte string.
+func (cborEncoder) AppendBytes(dst []byte, val []byte) []byte {
+	dst = appendCBORHead(dst, cborBytes, uint64(len(val)))
+	return append(dst, val...)
+}
+
+func (cborEncoder) AppendError(dst []byte, msg string) []byte {
+	return appendCBORText(dst, msg)
+}
+
+func (cborEncoder) AppendInt(dst []byte, val int) []byte {
+	return appendCBORInt(dst, int64(val))
+}
+
+func (cborEncoder) AppendInt8(dst []byte, val int8) []byte {
+	return appendCBORInt(dst, int64(val))
+}
+
+func (cborEncoder) AppendInt16(dst []byte, val int16) []byte {
+	return appendCBORInt(dst, int64(val))
+}
+
+func (cborEncoder) AppendInt32(dst []byte, val int32) []byte {
+	return appendCBORInt(dst, int64(val))
+}
+
+func (cborEncoder) AppendInt64(dst []byte, val int64) []byte {
+	return appendCBORInt(dst, val)
+}
+
+func (cborEncoder) AppendUint(dst []byte, val uint) []byte {
+	return appendCBORHead(dst, cborUint, uint64(val))
+}
+
+func (cborEncoder) AppendUint8(dst []byte, val uint8) []byte {
+	return appendCBORHead(dst, cborUint, uint64(val))
+}
+
+func (cborEncoder) AppendUint16(dst []byte, val uint16) []byte {
+	return appendCBORHead(dst, cborUint, uint64(val))
+}
+
+func (cborEncoder) AppendUint32(dst []byte, val uint32) []byte {
+	return appendCBORHead(dst, cborUint, uint64(val))
+}
+
+func (cborEncoder) AppendUint64(dst []byte, val uint64) []byte {
+	return appendCBORHead(dst, cborUint, val)
+}
+
+func (cborEncoder) AppendUintptr(dst []byte, val uintptr) []byte {
+	return appendCBORHead(dst, cborUint, uint64(val))
+}
+
+func (cborEncoder) AppendFloat32(dst []byte, val float32) []byte {
+	return appendCBORFloat(dst, float64(val), 32)
+}
+
+func (cborEncoder) AppendFloat64(dst []byte, val float64) []byte {
+	return appendCBORFloat(dst, val, 64)
+}
+
+func (enc cborEncoder) AppendComplex64(dst []byte, val complex64) []byte {
+	return appendCBORComplex(dst, complex128(val), 32, enc.o)
+}
+
+func (enc cborEncoder) AppendComplex128(dst []byte, val complex128) []byte {
+	return appendCBORComplex(dst, val, 64, enc.o)
+}
+
+func (cborEncoder) AppendBool(dst []byte, val bool) []byte {
+	return appendCBORBool(dst, val)
+}
+
+// AppendTime writes val as an epoch-based date/time (tag 1).
+func (cborEncoder) AppendTime(dst []byte, val time.Time) []byte {
+	return appendCBORTime(dst, val)
+}
+
+func (enc cborEncoder) AppendDuration(dst []byte, val time.Duration) []byte {
+	if enc.o.durFormat == DurationString {
+		var tmp [32]byte
+		return appendCBORASCII(dst, appendDuration(tmp[:0], val))
+	}
+	return appendCBORFloat(dst, float64(val)/float64(time.Millisecond), 64)
+}
+
+func (cborEncoder) AppendNull(dst []byte) []byte {
+	return append(dst, cborNull)
+}
+
+// AppendHex writes val as a lowercase hex text string.
+func (cborEncoder) AppendHex(dst []byte, val []byte) []byte {
+	dst = appendCBORHead(dst, cborText, uint64(2*len(val)))
+	return appendHex(dst, val)
+}
+
+func (cborEncoder) AppendIPAddr(dst []byte, val netip.Addr) []byte {
+	if !val.IsValid() {
+		return append(dst, cborNull)
+	}
+	if val.Zone() != "" {
+		return appendCBORText(dst, val.String())
+	}
+	var tmp [64]byte
+	return appendCBORASCII(dst, val.AppendTo(tmp[:0]))
+}
+
+func (cborEncoder) AppendIPPrefix(dst []byte, val netip.Prefix) []byte {
+	if !val.IsValid() {
+		return append(dst, cborNull)
+	}
+	var tmp [64]byte
+	return appendCBORASCII(dst, val.AppendTo(tmp[:0]))
+}
+
+func (cborEncoder) AppendMAC(dst []byte, val net.HardwareAddr) []byte {
+	dst = appendCBORHead(dst, cborText, uint64(max(3*len(val)-1, 0)))
+	for i, b := range val {
+		if i > 0 {
+			dst = append(dst, ':')
+		}
+		dst = append(dst, hex[b>>4], hex[b&0xF])
+	}
+	return dst
+}
+
+// AppendUUID writes val as a 16-byte string under tag 37.
+func (cborEncoder) AppendUUID(dst []byte, val [16]byte) []byte {
+	dst = appendCBORHead(dst, cborTag, cborTagUUID)
+	dst = append(dst, cborBytes|16)
+	return append(dst, val[:]...)
+}
+
+// AppendRawJSON converts val to the equivalent CBOR value, or writes the
+// decoding error if it is invalid.
+func (cborEncoder) AppendRawJSON(dst []byte, val []byte) []byte {
+	v, err := decodeJSON(val)
+	if err != nil {
+		return appendCBORText(dst, err.Error())
+	}
+	return appendCBORValue(dst, v)
+}
+
+// AppendAny converts val through encoding/json, or writes the marshaling
+// error.
+func (enc cborEncoder) AppendAny(dst []byte, val any) []byte {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return appendCBORText(dst, err.Error())
+	}
+	return enc.AppendRawJSON(dst, b)
+}
+
+// appendCBORHead writes the initial byte of an item of the given major type
+// followed by n in the shortest form.
+func appendCBORHead(dst []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(dst, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(dst, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(dst, major|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(dst, major|27), n)
+}
+
+func appendCBORInt(dst []byte, v int64) []byte {
+	if v < 0 {
+		return appendCBORHead(dst, cborNeg, uint64(^v))
+	}
+	return appendCBORHead(dst, cborUint, uint64(v))
+}
+
+func appendCBORFloat(dst []byte, f float64, bitSize int) []byte {
+	if bitSize == 32 {
+		return binary.BigEndian.AppendUint32(append(dst, cborSimple|26), math.Float32bits(float32(f)))
+	}
+	return binary.BigEndian.AppendUint64(append(dst, cborSimple|27), math.Float64bits(f))
+}
+
+func appendCBORBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, cborTrue)
+	}
+	return append(dst, cborFalse)
+}
+
+// appendCBORText writes s as a text string, replacing invalid UTF-8 with
+// U+FFFD.
+func appendCBORText(dst []byte, s string) []byte {
+	dst = appendCBORHead(dst, cborText, uint64(validUTF8Len(s)))
+	return appendValidUTF8(dst, s)
+}
+
+// appendCBORASCII writes b, known to be valid UTF-8, as a text string.
+func appendCBORASCII(dst, b []byte) []byte {
+	dst = appendCBORHead(dst, cborText, uint64(len(b)))
+	return append(dst, b...)
+}
+
+// appendCBORTime writes t under tag 1 as integer seconds, or as float seconds
+// when it has a fractional part.
+func appendCBORTime(dst []byte, t time.Time) []byte {
+	dst = appendCBORHead(dst, cborTag, cborTagEpoch)
+	if t.Nanosecond() == 0 {
+		return appendCBORInt(dst, t.Unix())
+	}
+	return appendCBORFloat(dst, float64(t.Unix())+float64(t.Nanosecond())/1e9, 64)
+}
+
+// appendCBORComplex writes c as an "(a+bi)" text string, or as a
+// {"real": a, "imag": b} map when configured.
+func appendCBORComplex(dst []byte, c complex128, bitSize int, o *options) []byte {
+	if o.complexObject {
+		dst = append(dst, cborMap|2, 0x64, 'r', 'e', 'a', 'l')
+		dst = appendCBORFloat(dst, real(c), bitSize)
+		dst = append(dst, 0x64, 'i', 'm', 'a', 'g')
+		return appendCBORFloat(dst, imag(c), bitSize)
+	}
+	var tmp [64]byte
+	return appendCBORASCII(dst, appendComplexText(tmp[:0], c, bitSize, o))
+}
+
+// appendCBORValue writes a value decoded by decodeJSON.
+func appendCBORValue(dst []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, cborNull)
+	case bool:
+		return appendCBORBool(dst, v)
+	case string:
+		return appendCBORText(dst, v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendCBORInt(dst, i)
+		}
+		f, _ := v.Float64()
+		return appendCBORFloat(dst, f, 64)
+	case []any:
+		dst = appendCBORHead(dst, cborArray, uint64(len(v)))
+		for _, x := range v {
+			dst = appendCBORValue(dst, x)
+		}
+		return dst
+	case map[string]any:
+		dst = appendCBORHead(dst, cborMap, uint64(len(v)))
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			dst = appendCBORText(dst, k)
+			dst = appendCBORValue(dst, v[k])
+		}
+		return dst
+	}
+	return append(dst, cborNull)
+}
+
+// decodeJSON decodes a single JSON value, keeping numbers as json.Number so
+// integers survive the conversion to a compact format exactly.
+func decodeJSON(b []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("invalid character after top-level value")
+	}
+	return v, nil
+}
+
+// validUTF8Len returns the length of s once appendValidUTF8 has replaced its
+// invalid bytes.
+func validUTF8Len(s string) int {
+	if utf8.ValidString(s) {
+		return len(s)
+	}
+	n := 0
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			n += len(string(utf8.RuneError))
+		} else {
+			n += size
+		}
+		i += size
+	}
+	return n
+}
+
+// appendValidUTF8 writes s with each invalid byte replaced with U+FFFD.
+func appendValidUTF8(dst []byte, s string) []byte {
+	if utf8.ValidString(s) {
+		return append(dst, s...)
+	}
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			dst = utf8.AppendRune(dst, utf8.RuneError)
+		} else {
+			dst = append(dst, s[i:i+size]...)
+		}
+		i += size
+	}
+	return dst
+}
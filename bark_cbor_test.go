@@ -0,0 +1,223 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type taggedItem struct {
+	num uint64
+	val any
+}
+
+// decodeCBOR decodes the subset of CBOR written by CBORLogger, returning the
+// item at the start of p and the bytes after it.
+func decodeCBOR(t *testing.T, p []byte) (any, []byte) {
+	t.Helper()
+	if len(p) == 0 {
+		t.Fatal("unexpected end of input")
+	}
+	major, info := p[0]&0xe0, p[0]&0x1f
+	p = p[1:]
+	var n uint64
+	switch {
+	case info < 24:
+		n = uint64(info)
+	case info == 24:
+		n, p = uint64(p[0]), p[1:]
+	case info == 25:
+		n, p = uint64(binary.BigEndian.Uint16(p)), p[2:]
+	case info == 26:
+		n, p = uint64(binary.BigEndian.Uint32(p)), p[4:]
+	case info == 27:
+		n, p = binary.BigEndian.Uint64(p), p[8:]
+	default:
+		t.Fatalf("unsupported additional info %d", info)
+	}
+
+	switch major {
+	case cborUint:
+		return n, p
+	case cborNeg:
+		return -1 - int64(n), p
+	case cborBytes:
+		return bytes.Clone(p[:n]), p[n:]
+	case cborText:
+		return string(p[:n]), p[n:]
+	case cborArray:
+		a := make([]any, n)
+		for i := range a {
+			a[i], p = decodeCBOR(t, p)
+		}
+		return a, p
+	case cborMap:
+		m := make(map[string]any, n)
+		for range n {
+			var k, v any
+			k, p = decodeCBOR(t, p)
+			v, p = decodeCBOR(t, p)
+			m[k.(string)] = v
+		}
+		return m, p
+	case cborTag:
+		var v any
+		v, p = decodeCBOR(t, p)
+		return taggedItem{n, v}, p
+	}
+	switch info {
+	case 20:
+		return false, p
+	case 21:
+		return true, p
+	case 22:
+		return nil, p
+	case 26:
+		return math.Float32frombits(uint32(n)), p
+	case 27:
+		return math.Float64frombits(n), p
+	}
+	t.Fatalf("unsupported simple value %d", info)
+	return nil, nil
+}
+
+func decodeCBORRecord(t *testing.T, p []byte) map[string]any {
+	t.Helper()
+	v, rest := decodeCBOR(t, p)
+	if len(rest) != 0 {
+		t.Fatalf("%d trailing bytes after record", len(rest))
+	}
+	return v.(map[string]any)
+}
+
+func TestCBORLoggerAllTypes(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewCBORLogger(&buf)
+	ts := time.Date(2023, 10, 1, 12, 0, 0, 500_000_000, time.UTC)
+
+	l.Info().
+		Str("str", "foo").
+		Str("bad", "a\xffb").
+		Bytes("bytes", []byte{1, 2, 3}).
+		Int("int", -1).
+		Int64("big", math.MinInt64).
+		Uint64("uint64", math.MaxUint64).
+		Float32("float32", 1.5).
+		Float64("float64", math.Inf(-1)).
+		Complex128("complex", 3-4i).
+		Bool("bool", true).
+		Time("at", ts).
+		Dur("dur", 1500*time.Microsecond).
+		IPAddr("ip", netip.MustParseAddr("2001:db8::1")).
+		IPAddr("noip", netip.Addr{}).
+		UUID("id", [16]byte{0x12}).
+		Hex("hex", []byte{0xde, 0xad}).
+		RawJSON("body", []byte(`{"b":[1,2.5,"x"],"a":null}`)).
+		Any("list", []string{"x", "y"}).
+		Error(errors.New("oops")).
+		Msg("done")
+
+	rec := decodeCBORRecord(t, buf.Bytes())
+	want := map[string]any{
+		"level":   "info",
+		"str":     "foo",
+		"bad":     "a\ufffdb",
+		"bytes":   []byte{1, 2, 3},
+		"int":     int64(-1),
+		"big":     int64(math.MinInt64),
+		"uint64":  uint64(math.MaxUint64),
+		"float32": float32(1.5),
+		"float64": math.Inf(-1),
+		"complex": "(3-4i)",
+		"bool":    true,
+		"at":      taggedItem{cborTagEpoch, 1696161600.5},
+		"dur":     1.5,
+		"ip":      "2001:db8::1",
+		"noip":    nil,
+		"id":      taggedItem{cborTagUUID, []byte{0x12, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		"hex":     "dead",
+		"body":    map[string]any{"a": nil, "b": []any{uint64(1), 2.5, "x"}},
+		"list":    []any{"x", "y"},
+		"error":   "oops",
+		"message": "done",
+	}
+	if tag, ok := rec["time"].(taggedItem); !ok || tag.num != cborTagEpoch {
+		t.Errorf("unexpected record time: %#v", rec["time"])
+	}
+	delete(rec, "time")
+	for k, v := range want {
+		if !reflect.DeepEqual(rec[k], v) {
+			t.Errorf("%s: got %#v, want %#v", k, rec[k], v)
+		}
+	}
+	if len(rec) != len(want) {
+		t.Errorf("got %d fields, want %d: %v", len(rec), len(want), rec)
+	}
+}
+
+func TestCBORLoggerSequence(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewCBORLogger(&buf, WithDuplicateKeys(DuplicateOverwrite))
+	l.Info().Int("a", 1).Int("b", 2).Int("a", 3).Str("message", "field").Msg("first")
+	l.Info().Msg("second")
+
+	p := buf.Bytes()
+	var recs []map[string]any
+	for len(p) > 0 {
+		var v any
+		v, p = decodeCBOR(t, p)
+		recs = append(recs, v.(map[string]any))
+	}
+	if len(recs) != 2 {
+		t.Fatalf("got %d records, want 2", len(recs))
+	}
+	if r := recs[0]; len(r) != 5 || r["a"] != uint64(3) || r["message"] != "first" {
+		t.Errorf("unexpected first record: %v", r)
+	}
+	if r := recs[1]; len(r) != 3 || r["message"] != "second" {
+		t.Errorf("unexpected second record: %v", r)
+	}
+}
+
+func TestCBORLoggerMaxRecordSize(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewCBORLogger(&buf, WithMaxRecordSize(96, OverflowTruncate))
+
+	l.Info().Str("a", "small").Bytes("blob", make([]byte, 4096)).Int("b", 1).Msg(strings.Repeat("m", 200))
+	if buf.Len() > 96 {
+		t.Errorf("record exceeds limit: %d bytes", buf.Len())
+	}
+	rec := decodeCBORRecord(t, buf.Bytes())
+	if rec["a"] != "small" || rec["b"] != uint64(1) || rec["_truncated"] != true || rec["blob"] != nil {
+		t.Errorf("unexpected record: %v", rec)
+	}
+
+	buf.Reset()
+	l = NewCBORLogger(&buf, WithMaxRecordSize(96, OverflowReplace))
+	l.Info().Str("big", strings.Repeat("x", 200)).Msg("replaced")
+	rec = decodeCBORRecord(t, buf.Bytes())
+	if rec["size_limit"] != uint64(96) || rec["message"] != "record exceeded size limit" || len(rec) != 5 {
+		t.Errorf("unexpected replacement: %v", rec)
+	}
+}
+
+func BenchmarkCBORLogger(b *testing.B) {
+	l := NewCBORLogger(io.Discard)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		l.Info().
+			Str("key", "value").
+			Int("id", 1234).
+			Float64("pi", 3.14).
+			Bool("enabled", true).
+			Msg("benchmark")
+	}
+}
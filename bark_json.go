@@ -1,15 +1,24 @@
 package bark
 
 import (
+	"bytes"
 	"encoding/base64"
-	"io"
+	"encoding/json"
+	"math"
+	"net"
+	"net/netip"
+	"slices"
 	"strconv"
-	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 const hex = "0123456789abcdef"
-var escapeTable [256]uint8
+
+// Escape tables mark bytes that need escaping with 1 and the leading bytes of
+// multi-byte sequences, which are checked for invalid UTF-8 and U+2028/U+2029,
+// with 2.
+var escapeTable, htmlEscapeTable [256]uint8
 
 func init() {
 	for i := range 32 {
@@ -17,188 +26,253 @@ func init() {
 	}
 	escapeTable['"'] = 1
 	escapeTable['\\'] = 1
+	for i := utf8.RuneSelf; i < 256; i++ {
+		escapeTable[i] = 2
+	}
+
+	htmlEscapeTable = escapeTable
+	htmlEscapeTable['<'] = 1
+	htmlEscapeTable['>'] = 1
+	htmlEscapeTable['&'] = 1
 }
 
-type Logger struct {
-	pool sync.Pool
-	out  io.Writer
+// jsonEncoder writes each record as a JSON object on its own line:
+//
+//	{"level":"info","time":"2024-05-01T12:04:05Z","user_id":"u123","message":"..."}
+type jsonEncoder struct {
+	o *options
 }
 
-type Event struct {
-	buf  []byte
-	out  io.Writer
-	pool *sync.Pool
+func (enc jsonEncoder) Begin(dst []byte, t time.Time, level Level) []byte {
+	dst = append(dst, '{')
+	dst = enc.appendStr(dst, enc.o.names.level())
+	dst = append(dst, ':', '"')
+	dst = append(dst, level.String()...)
+	dst = append(dst, '"', ',')
+	dst = enc.appendStr(dst, enc.o.names.time())
+	dst = append(dst, ':')
+	return appendTimeValue(dst, t, enc.o.timeFormat)
 }
 
-func NewLogger(w io.Writer) *Logger {
-	l := &Logger{
-		out: w,
-	}
-	l.pool.New = func() any {
-		return &Event{
-			buf: make([]byte, 0, 512),
-			out:  w,
-			pool: &l.pool,
-		}
-	}
-	return l
+func (jsonEncoder) End(dst []byte, n int) []byte {
+	return append(dst, '}', '\n')
+}
+
+func (enc jsonEncoder) AppendKey(dst []byte, key string) []byte {
+	dst = append(dst, ',')
+	dst = enc.appendStr(dst, key)
+	return append(dst, ':')
 }
 
-func (l *Logger) Info() *Event {
-	e := l.pool.Get().(*Event)
-	e.buf = e.buf[:0]
-	e.buf = append(e.buf, `{"level":"info","time":"`...)
-	e.buf = appendTime(e.buf, time.Now())
-	e.buf = append(e.buf, '"', ',')
-	return e
+func (enc jsonEncoder) appendStr(dst []byte, s string) []byte {
+	if enc.o.htmlSafe {
+		return appendEscaped(dst, s, &htmlEscapeTable)
+	}
+	return appendEscaped(dst, s, &escapeTable)
 }
 
-func (e *Event) appendKey(key string) {
-	e.buf = append(e.buf, '"')
-	e.buf = append(e.buf, key...)
-	e.buf = append(e.buf, '"', ':')
+func (enc jsonEncoder) AppendString(dst []byte, val string) []byte {
+	return enc.appendStr(dst, val)
 }
 
-func (e *Event) Str(key, val string) *Event {
-	e.appendKey(key)
-	e.buf = appendString(e.buf, val)
-	e.buf = append(e.buf, ',')
-	return e
+func (enc jsonEncoder) AppendError(dst []byte, msg string) []byte {
+	return enc.appendStr(dst, msg)
 }
 
-func (e *Event) Bytes(key string, val []byte) *Event {
-	e.appendKey(key)
-	e.buf = append(e.buf, '"')
+// AppendBytes writes val as a standard base64 string.
+func (jsonEncoder) AppendBytes(dst []byte, val []byte) []byte {
 	encodedLen := base64.StdEncoding.EncodedLen(len(val))
-	if cap(e.buf)-len(e.buf) < encodedLen {
-		newBuf := make([]byte, len(e.buf), len(e.buf)+encodedLen+32)
-		copy(newBuf, e.buf)
-		e.buf = newBuf
-	}
-	currentLen := len(e.buf)
-	e.buf = e.buf[:currentLen+encodedLen]
-	base64.StdEncoding.Encode(e.buf[currentLen:], val)
-	e.buf = append(e.buf, '"', ',')
-	return e
+	dst = append(dst, '"')
+	dst = slices.Grow(dst, encodedLen+1)
+	n := len(dst)
+	dst = dst[:n+encodedLen]
+	base64.StdEncoding.Encode(dst[n:], val)
+	return append(dst, '"')
 }
 
-func (e *Event) Int(key string, val int) *Event {
-	return e.Int64(key, int64(val))
+func (jsonEncoder) AppendInt(dst []byte, val int) []byte {
+	return strconv.AppendInt(dst, int64(val), 10)
 }
 
-func (e *Event) Int8(key string, val int8) *Event {
-	return e.Int64(key, int64(val))
+func (jsonEncoder) AppendInt8(dst []byte, val int8) []byte {
+	return strconv.AppendInt(dst, int64(val), 10)
 }
 
-func (e *Event) Int16(key string, val int16) *Event {
-	return e.Int64(key, int64(val))
+func (jsonEncoder) AppendInt16(dst []byte, val int16) []byte {
+	return strconv.AppendInt(dst, int64(val), 10)
 }
 
-func (e *Event) Int32(key string, val int32) *Event {
-	return e.Int64(key, int64(val))
+func (jsonEncoder) AppendInt32(dst []byte, val int32) []byte {
+	return strconv.AppendInt(dst, int64(val), 10)
 }
 
-func (e *Event) Int64(key string, val int64) *Event {
-	e.appendKey(key)
-	e.buf = strconv.AppendInt(e.buf, val, 10)
-	e.buf = append(e.buf, ',')
-	return e
+func (jsonEncoder) AppendInt64(dst []byte, val int64) []byte {
+	return strconv.AppendInt(dst, val, 10)
 }
 
-func (e *Event) Uint(key string, val uint) *Event {
-	return e.Uint64(key, uint64(val))
+func (jsonEncoder) AppendUint(dst []byte, val uint) []byte {
+	return strconv.AppendUint(dst, uint64(val), 10)
 }
 
-func (e *Event) Uint8(key string, val uint8) *Event {
-	return e.Uint64(key, uint64(val))
+func (jsonEncoder) AppendUint8(dst []byte, val uint8) []byte {
+	return strconv.AppendUint(dst, uint64(val), 10)
 }
 
-func (e *Event) Uint16(key string, val uint16) *Event {
-	return e.Uint64(key, uint64(val))
+func (jsonEncoder) AppendUint16(dst []byte, val uint16) []byte {
+	return strconv.AppendUint(dst, uint64(val), 10)
 }
 
-func (e *Event) Uint32(key string, val uint32) *Event {
-	return e.Uint64(key, uint64(val))
+func (jsonEncoder) AppendUint32(dst []byte, val uint32) []byte {
+	return strconv.AppendUint(dst, uint64(val), 10)
 }
 
-func (e *Event) Uint64(key string, val uint64) *Event {
-	e.appendKey(key)
-	e.buf = strconv.AppendUint(e.buf, val, 10)
-	e.buf = append(e.buf, ',')
-	return e
+func (jsonEncoder) AppendUint64(dst []byte, val uint64) []byte {
+	return strconv.AppendUint(dst, val, 10)
 }
 
-func (e *Event) Uintptr(key string, val uintptr) *Event {
-	return e.Uint64(key, uint64(val))
+func (jsonEncoder) AppendUintptr(dst []byte, val uintptr) []byte {
+	return strconv.AppendUint(dst, uint64(val), 10)
 }
 
-func (e *Event) Float32(key string, val float32) *Event {
-	e.appendKey(key)
-	e.buf = strconv.AppendFloat(e.buf, float64(val), 'f', -1, 32)
-	e.buf = append(e.buf, ',')
-	return e
+func (enc jsonEncoder) AppendFloat32(dst []byte, val float32) []byte {
+	return appendFloat(dst, float64(val), 32, enc.o)
 }
 
-func (e *Event) Float64(key string, val float64) *Event {
-	e.appendKey(key)
-	e.buf = strconv.AppendFloat(e.buf, val, 'f', -1, 64)
-	e.buf = append(e.buf, ',')
-	return e
+func (enc jsonEncoder) AppendFloat64(dst []byte, val float64) []byte {
+	return appendFloat(dst, val, 64, enc.o)
 }
 
-func (e *Event) Complex64(key string, val complex64) *Event {
-	e.appendKey(key)
-	e.buf = append(e.buf, '"', '(')
-	e.buf = strconv.AppendFloat(e.buf, float64(real(val)), 'f', -1, 32)
-	e.buf = append(e.buf, '+')
-	e.buf = strconv.AppendFloat(e.buf, float64(imag(val)), 'f', -1, 32)
-	e.buf = append(e.buf, 'i', ')', '"', ',')
-	return e
+func (enc jsonEncoder) AppendComplex64(dst []byte, val complex64) []byte {
+	return appendComplex(dst, complex128(val), 32, enc.o)
 }
 
-func (e *Event) Complex128(key string, val complex128) *Event {
-	e.appendKey(key)
-	e.buf = append(e.buf, '"', '(')
-	e.buf = strconv.AppendFloat(e.buf, real(val), 'f', -1, 64)
-	e.buf = append(e.buf, '+')
-	e.buf = strconv.AppendFloat(e.buf, imag(val), 'f', -1, 64)
-	e.buf = append(e.buf, 'i', ')', '"', ',')
-	return e
+func (enc jsonEncoder) AppendComplex128(dst []byte, val complex128) []byte {
+	return appendComplex(dst, val, 64, enc.o)
 }
 
-func (e *Event) Bool(key string, val bool) *Event {
-	e.appendKey(key)
-	if val {
-		e.buf = append(e.buf, 't', 'r', 'u', 'e', ',')
-	} else {
-		e.buf = append(e.buf, 'f', 'a', 'l', 's', 'e', ',')
+func (jsonEncoder) AppendBool(dst []byte, val bool) []byte {
+	return strconv.AppendBool(dst, val)
+}
+
+func (enc jsonEncoder) AppendTime(dst []byte, val time.Time) []byte {
+	return appendTimeField(dst, val, enc.o.timeFormat)
+}
+
+func (enc jsonEncoder) AppendDuration(dst []byte, val time.Duration) []byte {
+	if enc.o.durFormat == DurationString {
+		dst = append(dst, '"')
+		dst = appendDuration(dst, val)
+		return append(dst, '"')
+	}
+	return strconv.AppendFloat(dst, float64(val)/float64(time.Millisecond), 'f', -1, 64)
+}
+
+func (jsonEncoder) AppendNull(dst []byte) []byte {
+	return append(dst, "null"...)
+}
+
+func (jsonEncoder) AppendHex(dst []byte, val []byte) []byte {
+	dst = append(dst, '"')
+	dst = appendHex(dst, val)
+	return append(dst, '"')
+}
+
+func (enc jsonEncoder) AppendIPAddr(dst []byte, val netip.Addr) []byte {
+	if !val.IsValid() {
+		return append(dst, "null"...)
+	}
+	if val.Zone() != "" {
+		return enc.AppendString(dst, val.String())
+	}
+	dst = append(dst, '"')
+	dst = val.AppendTo(dst)
+	return append(dst, '"')
+}
+
+func (jsonEncoder) AppendIPPrefix(dst []byte, val netip.Prefix) []byte {
+	if !val.IsValid() {
+		return append(dst, "null"...)
+	}
+	dst = append(dst, '"')
+	dst = val.AppendTo(dst)
+	return append(dst, '"')
+}
+
+func (jsonEncoder) AppendMAC(dst []byte, val net.HardwareAddr) []byte {
+	dst = append(dst, '"')
+	for i, b := range val {
+		if i > 0 {
+			dst = append(dst, ':')
+		}
+		dst = append(dst, hex[b>>4], hex[b&0xF])
 	}
-	return e
+	return append(dst, '"')
+}
+
+func (jsonEncoder) AppendUUID(dst []byte, val [16]byte) []byte {
+	dst = append(dst, '"')
+	dst = appendUUID(dst, val)
+	return append(dst, '"')
 }
 
-func (e *Event) Error(err error) *Event {
-	if err == nil {
-		return e
+// AppendRawJSON embeds val as is, or compacted and validated when configured
+// with WithRawJSONValidation or when val spans several lines, which would
+// split the record. Invalid input is written as the validation error instead.
+func (enc jsonEncoder) AppendRawJSON(dst []byte, val []byte) []byte {
+	if !enc.o.validateRaw && bytes.IndexAny(val, "\r\n") < 0 {
+		return append(dst, val...)
 	}
-	e.buf = append(e.buf, `"error":`...)
-	e.buf = appendString(e.buf, err.Error())
-	e.buf = append(e.buf, ',')
-	return e
+	mark := len(dst)
+	b := bytes.NewBuffer(dst)
+	if err := json.Compact(b, val); err != nil {
+		return enc.appendStr(dst[:mark], err.Error())
+	}
+	return b.Bytes()
 }
 
-func (e *Event) Msg(msg string) {
-	e.buf = append(e.buf, `"message":`...)
-	e.buf = appendString(e.buf, msg)
-	e.buf = append(e.buf, '}', '\n')
-	e.out.Write(e.buf)
-	e.pool.Put(e)
+// AppendAny writes val through encoding/json, or the marshaling error as a
+// string.
+func (enc jsonEncoder) AppendAny(dst []byte, val any) []byte {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return enc.appendStr(dst, err.Error())
+	}
+	return append(dst, b...)
 }
 
 func appendString(dst []byte, s string) []byte {
+	return appendEscaped(dst, s, &escapeTable)
+}
+
+// appendEscaped writes s as a quoted JSON string, escaping the bytes marked in
+// table. Invalid UTF-8 is replaced with U+FFFD and U+2028/U+2029, which break
+// JavaScript parsers, are always escaped.
+func appendEscaped(dst []byte, s string, table *[256]uint8) []byte {
 	dst = append(dst, '"')
 	start := 0
 	for i := 0; i < len(s); i++ {
-		if escapeTable[s[i]] != 0 {
+		if esc := table[s[i]]; esc != 0 {
+			if esc == 2 {
+				r, size := utf8.DecodeRuneInString(s[i:])
+				if size > 1 && r != '\u2028' && r != '\u2029' {
+					i += size - 1
+					continue
+				}
+				if start < i {
+					dst = append(dst, s[start:i]...)
+				}
+				switch r {
+				case '\u2028':
+					dst = append(dst, `\u2028`...)
+				case '\u2029':
+					dst = append(dst, `\u2029`...)
+				default:
+					dst = append(dst, `\ufffd`...)
+				}
+				i += size - 1
+				start = i + 1
+				continue
+			}
 			if start < i {
 				dst = append(dst, s[start:i]...)
 			}
@@ -233,6 +307,27 @@ func appendString(dst []byte, s string) []byte {
 // appendTime formats the time in RFC3339 format without using time.AppendFormat
 // to avoid layout string parsing overhead.
 func appendTime(dst []byte, t time.Time) []byte {
+	return appendZone(appendClock(dst, t), t)
+}
+
+// appendTimeNano is appendTime with the fraction of a second, trailing zeros
+// removed, as time.RFC3339Nano writes it.
+func appendTimeNano(dst []byte, t time.Time) []byte {
+	dst = appendClock(dst, t)
+	if ns := t.Nanosecond(); ns != 0 {
+		var frac [10]byte
+		frac[0] = '.'
+		for i := 9; i > 0; i-- {
+			frac[i] = byte(ns%10 + '0')
+			ns /= 10
+		}
+		dst = append(dst, bytes.TrimRight(frac[:], "0")...)
+	}
+	return appendZone(dst, t)
+}
+
+// appendClock writes the date and time of day of t, to the second.
+func appendClock(dst []byte, t time.Time) []byte {
 	year, month, day := t.Date()
 	hour, min, sec := t.Clock()
 
@@ -245,8 +340,11 @@ func appendTime(dst []byte, t time.Time) []byte {
 	dst = append(dst, byte(day/10+'0'), byte(day%10+'0'), 'T')
 	dst = append(dst, byte(hour/10+'0'), byte(hour%10+'0'), ':')
 	dst = append(dst, byte(min/10+'0'), byte(min%10+'0'), ':')
-	dst = append(dst, byte(sec/10+'0'), byte(sec%10+'0'))
+	return append(dst, byte(sec/10+'0'), byte(sec%10+'0'))
+}
 
+// appendZone writes the UTC offset of t, or Z for UTC.
+func appendZone(dst []byte, t time.Time) []byte {
 	_, offset := t.Zone()
 	if offset == 0 {
 		return append(dst, 'Z')
@@ -263,4 +361,217 @@ func appendTime(dst []byte, t time.Time) []byte {
 	dst = append(dst, byte(offset/60/10+'0'), byte(offset/60%10+'0'), ':')
 	dst = append(dst, byte(offset%60/10+'0'), byte(offset%60%10+'0'))
 	return dst
-}
\ No newline at end of file
+}
+
+// appendFloat writes f as a JSON number in the configured format, or as the
+// configured stand-in when it is NaN or infinite.
+func appendFloat(dst []byte, f float64, bitSize int, o *options) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		if o.nonFinite == NonFiniteNull {
+			return append(dst, 'n', 'u', 'l', 'l')
+		}
+		switch {
+		case math.IsNaN(f):
+			return append(dst, `"NaN"`...)
+		case f > 0:
+			return append(dst, `"+Inf"`...)
+		}
+		return append(dst, `"-Inf"`...)
+	}
+	return appendFloatText(dst, f, bitSize, o)
+}
+
+// appendFloatText writes the finite f in the configured format, or as
+// encoding/json would if none was set.
+func appendFloatText(dst []byte, f float64, bitSize int, o *options) []byte {
+	if o.floatFmt != 0 {
+		return strconv.AppendFloat(dst, f, o.floatFmt, o.floatPrec, bitSize)
+	}
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 {
+		if bitSize == 64 && (abs < 1e-6 || abs >= 1e21) ||
+			bitSize == 32 && (float32(abs) < 1e-6 || float32(abs) >= 1e21) {
+			format = 'e'
+		}
+	}
+	dst = strconv.AppendFloat(dst, f, format, -1, bitSize)
+	if format == 'e' {
+		// Shorten e-09 to e-9, as encoding/json does.
+		if n := len(dst); n >= 4 && dst[n-4] == 'e' && dst[n-3] == '-' && dst[n-2] == '0' {
+			dst[n-2] = dst[n-1]
+			dst = dst[:n-1]
+		}
+	}
+	return dst
+}
+
+// appendComplex writes c as a quoted "(a+bi)" string, or as a
+// {"real":a,"imag":b} object when configured, formatting both parts at the
+// given bit size.
+func appendComplex(dst []byte, c complex128, bitSize int, o *options) []byte {
+	re, im := real(c), imag(c)
+	if o.complexObject {
+		dst = append(dst, `{"real":`...)
+		dst = appendFloat(dst, re, bitSize, o)
+		dst = append(dst, `,"imag":`...)
+		dst = appendFloat(dst, im, bitSize, o)
+		return append(dst, '}')
+	}
+	dst = append(dst, '"')
+	dst = appendComplexText(dst, c, bitSize, o)
+	return append(dst, '"')
+}
+
+// appendComplexText writes c in the unquoted "(a+bi)" form.
+func appendComplexText(dst []byte, c complex128, bitSize int, o *options) []byte {
+	re, im := real(c), imag(c)
+	dst = append(dst, '(')
+	dst = appendFloatText(dst, re, bitSize, o)
+	// strconv already signs negative values and +Inf.
+	if math.IsNaN(im) || !math.Signbit(im) && !math.IsInf(im, 1) {
+		dst = append(dst, '+')
+	}
+	dst = appendFloatText(dst, im, bitSize, o)
+	return append(dst, 'i', ')')
+}
+
+func appendHex(dst, src []byte) []byte {
+	for _, b := range src {
+		dst = append(dst, hex[b>>4], hex[b&0xF])
+	}
+	return dst
+}
+
+func appendUUID(dst []byte, u [16]byte) []byte {
+	dst = appendHex(dst, u[0:4])
+	dst = append(dst, '-')
+	dst = appendHex(dst, u[4:6])
+	dst = append(dst, '-')
+	dst = appendHex(dst, u[6:8])
+	dst = append(dst, '-')
+	dst = appendHex(dst, u[8:10])
+	dst = append(dst, '-')
+	return appendHex(dst, u[10:16])
+}
+
+func appendTimeValue(dst []byte, t time.Time, f TimeFormat) []byte {
+	switch f {
+	case TimeUnix:
+		return strconv.AppendInt(dst, t.Unix(), 10)
+	case TimeUnixMs:
+		return strconv.AppendInt(dst, t.UnixMilli(), 10)
+	case TimeUnixNano:
+		return strconv.AppendInt(dst, t.UnixNano(), 10)
+	}
+	dst = append(dst, '"')
+	dst = appendTime(dst, t)
+	return append(dst, '"')
+}
+
+// appendTimeField writes the value of a Time field like appendTimeValue, but
+// keeps the fraction of a second in RFC 3339 form, as binary records do.
+func appendTimeField(dst []byte, t time.Time, f TimeFormat) []byte {
+	if f != TimeRFC3339 {
+		return appendTimeValue(dst, t, f)
+	}
+	dst = append(dst, '"')
+	dst = appendTimeNano(dst, t)
+	return append(dst, '"')
+}
+
+// appendDuration writes d the way time.Duration.String does, without the
+// intermediate string allocation.
+func appendDuration(dst []byte, d time.Duration) []byte {
+	var buf [32]byte
+	w := len(buf)
+
+	u := uint64(d)
+	neg := d < 0
+	if neg {
+		u = -u
+	}
+
+	if u < uint64(time.Second) {
+		var prec int
+		w--
+		buf[w] = 's'
+		w--
+		switch {
+		case u == 0:
+			buf[w] = '0'
+			return append(dst, buf[w:]...)
+		case u < uint64(time.Microsecond):
+			prec = 0
+			buf[w] = 'n'
+		case u < uint64(time.Millisecond):
+			prec = 3
+			w--
+			copy(buf[w:], "µ")
+		default:
+			prec = 6
+			buf[w] = 'm'
+		}
+		w, u = fmtFrac(buf[:w], u, prec)
+		w = fmtInt(buf[:w], u)
+	} else {
+		w--
+		buf[w] = 's'
+		w, u = fmtFrac(buf[:w], u, 9)
+		w = fmtInt(buf[:w], u%60)
+		u /= 60
+		if u > 0 {
+			w--
+			buf[w] = 'm'
+			w = fmtInt(buf[:w], u%60)
+			u /= 60
+			if u > 0 {
+				w--
+				buf[w] = 'h'
+				w = fmtInt(buf[:w], u)
+			}
+		}
+	}
+
+	if neg {
+		w--
+		buf[w] = '-'
+	}
+	return append(dst, buf[w:]...)
+}
+
+// fmtFrac writes the fraction of v/10^prec into the tail of buf, omitting
+// trailing zeros, and returns the new start index and v/10^prec.
+func fmtFrac(buf []byte, v uint64, prec int) (int, uint64) {
+	w := len(buf)
+	print := false
+	for range prec {
+		digit := v % 10
+		print = print || digit != 0
+		if print {
+			w--
+			buf[w] = byte(digit) + '0'
+		}
+		v /= 10
+	}
+	if print {
+		w--
+		buf[w] = '.'
+	}
+	return w, v
+}
+
+// fmtInt writes v into the tail of buf and returns the new start index.
+func fmtInt(buf []byte, v uint64) int {
+	w := len(buf)
+	if v == 0 {
+		w--
+		buf[w] = '0'
+		return w
+	}
+	for v > 0 {
+		w--
+		buf[w] = byte(v%10) + '0'
+		v /= 10
+	}
+	return w
+}
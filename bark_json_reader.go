@@ -0,0 +1,158 @@
+package bark
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// ErrMalformedJSON is returned when a JSON line cannot be decoded.
+var ErrMalformedJSON = errors.New("bark: malformed JSON record")
+
+// DecodeJSON decodes a JSON line written by Logger into the form binary
+// frames decode to, so that both can be handled alike. names must match the
+// names the logger was configured with by WithFieldNames, if any; the message
+// field is renamed "message" in the record.
+//
+// JSON keeps fewer types than the binary format: strings decode with
+// BinTagString, integers with BinTagInt64, or BinTagUint64 when too large,
+// other numbers with BinTagFloat64, booleans with BinTagBool, null with
+// BinTagNull, and objects and arrays as json.RawMessage with BinTagRawJSON.
+// Times and durations are left as the strings or numbers they were written
+// as, except for the record timestamp. Field sizes include the separator
+// before the key.
+func DecodeJSON(line []byte, names FieldNames) (*BinaryRecord, error) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("%w: not an object", ErrMalformedJSON)
+	}
+	rec := &BinaryRecord{Type: binType(LevelInfo), Size: len(line)}
+	for dec.More() {
+		start := dec.InputOffset()
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedJSON, err)
+		}
+		key := tok.(string)
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrMalformedJSON, err)
+		}
+		f := jsonField(key, raw)
+		switch key {
+		case names.level():
+			if s, ok := f.Value.(string); ok {
+				if l, err := ParseLevel(s); err == nil {
+					rec.Type = binType(l)
+					continue
+				}
+			}
+		case names.time():
+			if t, ok := jsonTime(f.Value); ok {
+				rec.Time = t
+				continue
+			}
+		case names.message():
+			f.Key = "message"
+		}
+		rec.Fields = append(rec.Fields, f)
+		rec.Sizes = append(rec.Sizes, int(dec.InputOffset()-start))
+	}
+	return rec, nil
+}
+
+// jsonField decodes the JSON value raw.
+func jsonField(key string, raw json.RawMessage) BinaryField {
+	f := BinaryField{Key: key}
+	switch raw[0] {
+	case '"':
+		var s string
+		json.Unmarshal(raw, &s)
+		f.Tag, f.Value = BinTagString, s
+	case 't', 'f':
+		f.Tag, f.Value = BinTagBool, raw[0] == 't'
+	case 'n':
+		f.Tag = BinTagNull
+	case '{', '[':
+		f.Tag, f.Value = BinTagRawJSON, json.RawMessage(bytes.Clone(raw))
+	default:
+		if n, err := strconv.ParseInt(string(raw), 10, 64); err == nil {
+			f.Tag, f.Value = BinTagInt64, n
+		} else if n, err := strconv.ParseUint(string(raw), 10, 64); err == nil {
+			f.Tag, f.Value = BinTagUint64, n
+		} else {
+			n, _ := strconv.ParseFloat(string(raw), 64)
+			f.Tag, f.Value = BinTagFloat64, n
+		}
+	}
+	return f
+}
+
+// jsonTime reads a timestamp written in any TimeFormat. Numeric timestamps
+// are told apart by magnitude.
+func jsonTime(v any) (time.Time, bool) {
+	var n int64
+	switch v := v.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	case json.Number:
+		var err error
+		if n, err = v.Int64(); err != nil {
+			return time.Time{}, false
+		}
+	case int64:
+		n = v
+	default:
+		return time.Time{}, false
+	}
+	switch {
+	case n > 1e17:
+		return time.Unix(0, n), true
+	case n > 1e11:
+		return time.UnixMilli(n), true
+	}
+	return time.Unix(n, 0), true
+}
+
+// JSONReader reads consecutive records from a stream of JSON lines written by
+// Logger.
+type JSONReader struct {
+	// FieldNames must match the names the logger was configured with by
+	// WithFieldNames, if any.
+	FieldNames FieldNames
+
+	r    *bufio.Reader
+	line int
+}
+
+// NewJSONReader returns a reader of the JSON lines in r.
+func NewJSONReader(r io.Reader) *JSONReader {
+	return &JSONReader{r: bufio.NewReader(r)}
+}
+
+// Next decodes the next line, skipping blank ones. It returns io.EOF at the
+// end of the stream. A line that does not decode is skipped with an error
+// naming it, so reading can go on.
+func (r *JSONReader) Next() (*BinaryRecord, error) {
+	for {
+		line, err := r.r.ReadBytes('\n')
+		if len(line) == 0 && err != nil {
+			return nil, err
+		}
+		r.line++
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		rec, err := DecodeJSON(line, r.FieldNames)
+		if err != nil {
+			return nil, fmt.Errorf("%w (line %d)", err, r.line)
+		}
+		return rec, nil
+	}
+}
@@ -0,0 +1,91 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDecodeJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf, WithTimeFormat(TimeUnixNano))
+	l.Warn().
+		Str("user", "alice").
+		Int("n", -3).
+		Uint64("big", 1<<63).
+		Float64("ratio", 0.5).
+		Bool("ok", true).
+		RawJSON("doc", []byte(`{"a":[1,2]}`)).
+		Any("none", nil).
+		Msg("hello")
+
+	rec, err := DecodeJSON(buf.Bytes(), FieldNames{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Level() != LevelWarn || rec.Message() != "hello" {
+		t.Errorf("level %v, message %q", rec.Level(), rec.Message())
+	}
+	if d := time.Since(rec.Time); d < 0 || d > time.Minute {
+		t.Errorf("time %v", rec.Time)
+	}
+	want := []BinaryField{
+		{"user", BinTagString, "alice"},
+		{"n", BinTagInt64, int64(-3)},
+		{"big", BinTagUint64, uint64(1 << 63)},
+		{"ratio", BinTagFloat64, 0.5},
+		{"ok", BinTagBool, true},
+		{"doc", BinTagRawJSON, json.RawMessage(`{"a":[1,2]}`)},
+		{"none", BinTagNull, nil},
+		{"message", BinTagString, "hello"},
+	}
+	if !reflect.DeepEqual(rec.Fields, want) {
+		t.Errorf("got %+v\nwant %+v", rec.Fields, want)
+	}
+	if rec.Size != buf.Len() || len(rec.Sizes) != len(want) || rec.Sizes[0] != len(`,"user":"alice"`) {
+		t.Errorf("size %d, field sizes %v", rec.Size, rec.Sizes)
+	}
+}
+
+func TestDecodeJSONFieldNames(t *testing.T) {
+	names := FieldNames{Level: "severity", Time: "ts", Message: "msg"}
+	var buf bytes.Buffer
+	NewLogger(&buf, WithFieldNames(names)).Error().Msg("down")
+	rec, err := DecodeJSON(buf.Bytes(), names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Level() != LevelError || rec.Message() != "down" || rec.Time.IsZero() || len(rec.Fields) != 1 {
+		t.Errorf("got %+v", rec)
+	}
+}
+
+func TestJSONReader(t *testing.T) {
+	in := `{"level":"info","time":"2024-05-01T12:00:00Z","message":"one"}
+
+not json
+{"level":"debug","time":"2024-05-01T12:00:01Z","message":"two"}`
+	r := NewJSONReader(strings.NewReader(in))
+	var got []string
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if !errors.Is(err, ErrMalformedJSON) || !strings.Contains(err.Error(), "line 3") {
+				t.Errorf("got %v", err)
+			}
+			continue
+		}
+		got = append(got, rec.Message())
+	}
+	if !reflect.DeepEqual(got, []string{"one", "two"}) {
+		t.Errorf("got %q", got)
+	}
+}
@@ -3,8 +3,14 @@ package bark
 import (
 	"bytes"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"io"
+	"math"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -150,4 +156,476 @@ func TestLoggerConcurrency(t *testing.T) {
 		})
 	}
 	wg.Wait()
-}
\ No newline at end of file
+}
+func TestLoggerMaxRecordSize(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf, WithMaxRecordSize(128, OverflowTruncate))
+
+	l.Info().Str("a", "small").Bytes("blob", make([]byte, 4096)).Int("b", 1).Msg("kept")
+	got := buf.String()
+	if len(got) > 128 {
+		t.Errorf("record exceeds limit: %d bytes", len(got))
+	}
+	for _, sub := range []string{`"a":"small"`, `"b":1`, `"message":"kept"`, `"_truncated":true}`} {
+		if !strings.Contains(got, sub) {
+			t.Errorf("missing %q in output: %s", sub, got)
+		}
+	}
+	if strings.Contains(got, `"blob"`) {
+		t.Errorf("oversized field was not omitted: %s", got)
+	}
+
+	buf.Reset()
+	l.Info().Msg(strings.Repeat("m", 500))
+	got = buf.String()
+	if len(got) > 128 || !strings.HasSuffix(got, `,"_truncated":true}`+"\n") {
+		t.Errorf("long message not shortened to fit: %s", got)
+	}
+
+	buf.Reset()
+	l.Info().Str("a", "small").Msg("fits")
+	if strings.Contains(buf.String(), "_truncated") {
+		t.Errorf("marker written for a record within the limit: %s", buf.String())
+	}
+
+	buf.Reset()
+	l = NewLogger(&buf, WithMaxRecordSize(128, OverflowDrop))
+	l.Info().Str("big", strings.Repeat("x", 200)).Msg("dropped")
+	if buf.Len() != 0 {
+		t.Errorf("expected record to be dropped, got: %s", buf.String())
+	}
+
+	l = NewLogger(&buf, WithMaxRecordSize(128, OverflowReplace))
+	l.Info().Str("big", strings.Repeat("x", 200)).Msg("replaced")
+	got = buf.String()
+	for _, sub := range []string{`"level":"info"`, `"size_limit":128`, `"message":"record exceeded size limit"`} {
+		if !strings.Contains(got, sub) {
+			t.Errorf("missing %q in replacement: %s", sub, got)
+		}
+	}
+	if strings.Contains(got, "replaced") {
+		t.Errorf("replacement kept original content: %s", got)
+	}
+}
+
+func TestLoggerTimeAndDuration(t *testing.T) {
+	ts := time.Date(2023, 10, 1, 12, 0, 0, 500_000_000, time.UTC)
+
+	cases := []struct {
+		opts []Option
+		want []string
+	}{
+		{nil, []string{`"at":"2023-10-01T12:00:00.5Z"`, `"took":1.5`, `"time":"20`}},
+		{[]Option{WithTimeFormat(TimeUnix)}, []string{`"at":1696161600,`}},
+		{[]Option{WithTimeFormat(TimeUnixMs)}, []string{`"at":1696161600500,`}},
+		{[]Option{WithTimeFormat(TimeUnixNano)}, []string{`"at":1696161600500000000,`}},
+		{[]Option{WithDurationFormat(DurationString)}, []string{`"took":"1.5ms"`}},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		NewLogger(&buf, c.opts...).Info().Time("at", ts).Dur("took", 1500*time.Microsecond).Msg("t")
+		got := buf.String()
+		for _, sub := range c.want {
+			if !strings.Contains(got, sub) {
+				t.Errorf("missing %q in output: %s", sub, got)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	NewLogger(&buf, WithTimeFormat(TimeUnix)).Info().Msg("t")
+	if !strings.Contains(buf.String(), `"time":1`) {
+		t.Errorf("record timestamp ignores time format: %s", buf.String())
+	}
+}
+
+func TestAppendTimeNano(t *testing.T) {
+	east := time.FixedZone("", 5*3600+30*60)
+	for _, ts := range []time.Time{
+		time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2023, 10, 1, 12, 0, 0, 1, time.UTC),
+		time.Date(2023, 10, 1, 12, 0, 0, 120_000_000, east),
+		time.Date(1999, 12, 31, 23, 59, 59, 999_999_999, time.FixedZone("", -8*3600)),
+	} {
+		if got, want := string(appendTimeNano(nil, ts)), ts.Format(time.RFC3339Nano); got != want {
+			t.Errorf("appendTimeNano = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestAppendDuration(t *testing.T) {
+	for _, d := range []time.Duration{
+		0, 1, 999, time.Microsecond, 1500 * time.Microsecond, time.Second,
+		90 * time.Minute, -3*time.Hour - 2*time.Millisecond, 1<<63 - 1, -1 << 63,
+	} {
+		if got := string(appendDuration(nil, d)); got != d.String() {
+			t.Errorf("appendDuration(%d) = %q, want %q", int64(d), got, d.String())
+		}
+	}
+}
+
+type textID int
+
+func (id textID) MarshalText() ([]byte, error) {
+	return []byte("id-" + strconv.Itoa(int(id))), nil
+}
+
+type indentedJSON struct{}
+
+func (indentedJSON) MarshalJSON() ([]byte, error) {
+	return []byte("{\n  \"a\": 1\n}"), nil
+}
+
+func TestLoggerAny(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf)
+
+	var nilErr *os.PathError
+	l.Info().
+		Any("nil", nil).
+		Any("str", "s").
+		Any("int", 7).
+		Any("float", 1.5).
+		Any("bool", true).
+		Any("dur", 2*time.Millisecond).
+		Any("err", errors.New("bad")).
+		Any("nil_err", nilErr).
+		Any("text", textID(3)).
+		Any("marshaler", indentedJSON{}).
+		Interface("struct", struct {
+			Name string `json:"name"`
+			Tags []string
+		}{"n", []string{"x"}}).
+		Any("map", map[string]int{"b": 2, "a": 1}).
+		Msg("any")
+
+	got := buf.String()
+	expected := []string{
+		`"nil":null`,
+		`"str":"s"`,
+		`"int":7`,
+		`"float":1.5`,
+		`"bool":true`,
+		`"dur":2`,
+		`"err":"bad"`,
+		`"nil_err":null`,
+		`"text":"id-3"`,
+		`"marshaler":{"a":1}`,
+		`"struct":{"name":"n","Tags":["x"]}`,
+		`"map":{"a":1,"b":2}`,
+	}
+	for _, sub := range expected {
+		if !strings.Contains(got, sub) {
+			t.Errorf("missing %q in output: %s", sub, got)
+		}
+	}
+	if strings.Count(got, "\n") != 1 {
+		t.Errorf("record spans several lines: %s", got)
+	}
+
+	buf.Reset()
+	l.Info().Any("chan", make(chan int)).Msg("unsupported")
+	if !strings.Contains(buf.String(), `"chan":"json: unsupported type: chan int"`) {
+		t.Errorf("marshal error not reported: %s", buf.String())
+	}
+}
+
+func TestLoggerNetworkFields(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf)
+
+	mac, _ := net.ParseMAC("00:1A:2B:3C:4D:5E")
+	uuid := [16]byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+	var nilStringer *net.IPNet
+
+	l.Info().
+		Stringer("dur", time.Second).
+		Stringer("nil", nilStringer).
+		Hex("hex", []byte{0xde, 0xad, 0xbe, 0xef}).
+		IPAddr("v4", netip.MustParseAddr("192.168.0.1")).
+		IPAddr("v6", netip.MustParseAddr("fe80::1%eth0")).
+		IPAddr("zero", netip.Addr{}).
+		IPPrefix("net", netip.MustParsePrefix("10.0.0.0/8")).
+		MACAddr("mac", mac).
+		UUID("uuid", uuid).
+		Msg("net")
+
+	got := buf.String()
+	expected := []string{
+		`"dur":"1s"`,
+		`"nil":null`,
+		`"hex":"deadbeef"`,
+		`"v4":"192.168.0.1"`,
+		`"v6":"fe80::1%eth0"`,
+		`"zero":null`,
+		`"net":"10.0.0.0/8"`,
+		`"mac":"00:1a:2b:3c:4d:5e"`,
+		`"uuid":"123e4567-e89b-12d3-a456-426614174000"`,
+	}
+	for _, sub := range expected {
+		if !strings.Contains(got, sub) {
+			t.Errorf("missing %q in output: %s", sub, got)
+		}
+	}
+}
+
+func BenchmarkLoggerNetworkFields(b *testing.B) {
+	l := NewLogger(io.Discard)
+	addr := netip.MustParseAddr("2001:db8::1")
+	mac := net.HardwareAddr{0, 1, 2, 3, 4, 5}
+	b.ReportAllocs()
+
+	for b.Loop() {
+		l.Info().
+			IPAddr("ip", addr).
+			MACAddr("mac", mac).
+			UUID("id", [16]byte{1}).
+			Hex("h", mac).
+			Msg("benchmark")
+	}
+}
+
+func TestLoggerRawJSON(t *testing.T) {
+	var buf bytes.Buffer
+	NewLogger(&buf).Info().
+		RawJSON("body", []byte(`{"event":"push","ids":[1,2]}`)).
+		RawJSON("empty", nil).
+		Msg("webhook")
+
+	got := buf.String()
+	for _, sub := range []string{`"body":{"event":"push","ids":[1,2]}`, `"empty":null`} {
+		if !strings.Contains(got, sub) {
+			t.Errorf("missing %q in output: %s", sub, got)
+		}
+	}
+
+	// Line breaks would split the record, so multi-line input is compacted
+	// even without validation.
+	buf.Reset()
+	NewLogger(&buf).Info().
+		RawJSON("pretty", []byte("{\n  \"a\": 1\r\n}")).
+		RawJSON("broken", []byte("{\"a\":\n")).
+		Msg("unvalidated")
+	got = buf.String()
+	if strings.Count(got, "\n") != 1 || !strings.Contains(got, `"pretty":{"a":1}`) ||
+		!strings.Contains(got, `"broken":"unexpected end of JSON input"`) {
+		t.Errorf("multi-line raw JSON: %q", got)
+	}
+
+	buf.Reset()
+	NewLogger(&buf, WithRawJSONValidation()).Info().
+		RawJSON("pretty", []byte("{\n  \"a\": [1, 2]\n}")).
+		RawJSON("broken", []byte(`{"a":`)).
+		Msg("validated")
+
+	got = buf.String()
+	if !strings.Contains(got, `"pretty":{"a":[1,2]}`) {
+		t.Errorf("raw JSON not compacted: %s", got)
+	}
+	if !strings.Contains(got, `"broken":"unexpected end of JSON input"`) {
+		t.Errorf("invalid raw JSON not replaced by its error: %s", got)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Errorf("output is not valid JSON: %v: %s", err, got)
+	}
+}
+
+func TestLoggerEscaping(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf)
+
+	l.Info().
+		Str(`k"ey`, "v").
+		Str("bad", "a\xffb\xc3").
+		Str("sep", "x\u2028y\u2029z").
+		Str("utf8", "héllo \U0001F600 \ufffd").
+		Str("html", "<a href=\"x\">&</a>").
+		Msg("esc")
+
+	got := buf.String()
+	expected := []string{
+		`"k\"ey":"v"`,
+		`"bad":"a\ufffdb\ufffd"`,
+		`"sep":"x\u2028y\u2029z"`,
+		`"utf8":"héllo ` + "\U0001F600 \ufffd" + `"`,
+		`"html":"<a href=\"x\">&</a>"`,
+	}
+	for _, sub := range expected {
+		if !strings.Contains(got, sub) {
+			t.Errorf("missing %q in output: %s", sub, got)
+		}
+	}
+
+	buf.Reset()
+	NewLogger(&buf, WithHTMLSafe()).Info().Str("html", "<b>&</b>").Msg("<>")
+	got = buf.String()
+	for _, sub := range []string{`"html":"\u003cb\u003e\u0026\u003c/b\u003e"`, `"message":"\u003c\u003e"`} {
+		if !strings.Contains(got, sub) {
+			t.Errorf("missing %q in output: %s", sub, got)
+		}
+	}
+}
+
+func FuzzLoggerJSON(f *testing.F) {
+	f.Add("key", "value", "msg", false)
+	f.Add(`k"\`, "a\xffb\x00\n", "  ", true)
+	f.Add("\xc3", "<script>&</script>", "\xed\xa0\x80", false)
+
+	f.Fuzz(func(t *testing.T, key, val, msg string, html bool) {
+		var opts []Option
+		if html {
+			opts = append(opts, WithHTMLSafe())
+		}
+		var buf bytes.Buffer
+		NewLogger(&buf, opts...).Info().Str(key, val).Msg(msg)
+
+		line := buf.Bytes()
+		if bytes.Count(line, []byte("\n")) != 1 || line[len(line)-1] != '\n' {
+			t.Fatalf("record is not a single line: %q", line)
+		}
+		var m map[string]any
+		if err := json.Unmarshal(line, &m); err != nil {
+			t.Fatalf("invalid JSON: %v: %q", err, line)
+		}
+
+		// encoding/json applies the same U+FFFD replacement, so its round
+		// trip is the expected decoded value.
+		want := func(s string) string {
+			b, _ := json.Marshal(s)
+			var out string
+			json.Unmarshal(b, &out)
+			return out
+		}
+		if got := m["message"]; got != want(msg) {
+			t.Errorf("message: got %q, want %q", got, want(msg))
+		}
+		if k := want(key); k != "level" && k != "time" && k != "message" {
+			if got := m[k]; got != want(val) {
+				t.Errorf("field %q: got %q, want %q", k, got, want(val))
+			}
+		}
+	})
+}
+
+func TestLoggerFloatFormatting(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+
+	cases := []struct {
+		opts []Option
+		want []string
+	}{
+		{nil, []string{
+			`"nan":"NaN"`, `"inf":"+Inf"`, `"ninf":"-Inf"`, `"f32":"NaN"`,
+			`"big":100000000000000000000`, `"c":"(1-2i)"`, `"cnan":"(NaN+Infi)"`,
+			`"huge":1e+300`, `"tiny":1e-7`, `"f32e":1e+21`,
+		}},
+		{[]Option{WithNonFinite(NonFiniteNull)}, []string{
+			`"nan":null`, `"inf":null`, `"ninf":null`, `"f32":null`,
+		}},
+		{[]Option{WithFloatFormat('g', -1)}, []string{`"big":1e+20`, `"pi":3.14159`}},
+		{[]Option{WithFloatFormat('e', 2)}, []string{`"big":1.00e+20`, `"pi":3.14e+00`}},
+		{[]Option{WithFloatFormat('f', 2)}, []string{`"pi":3.14,`}},
+		{[]Option{WithFloatFormat('x', 2)}, []string{`"pi":3.14,`}},
+		{[]Option{WithComplexObject()}, []string{
+			`"c":{"real":1,"imag":-2}`, `"cnan":{"real":"NaN","imag":"+Inf"}`,
+		}},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		NewLogger(&buf, c.opts...).Info().
+			Float64("nan", nan).
+			Float64("inf", inf).
+			Float64("ninf", -inf).
+			Float32("f32", float32(nan)).
+			Float64("big", 1e20).
+			Float64("pi", 3.14159).
+			Float64("huge", 1e300).
+			Float64("tiny", 1e-7).
+			Float32("f32e", 1e21).
+			Complex128("c", 1-2i).
+			Complex128("cnan", complex(nan, inf)).
+			Msg("floats")
+
+		got := buf.String()
+		for _, sub := range c.want {
+			if !strings.Contains(got, sub) {
+				t.Errorf("missing %q in output: %s", sub, got)
+			}
+		}
+		var m map[string]any
+		if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+			t.Errorf("invalid JSON: %v: %s", err, got)
+		}
+	}
+}
+
+func TestLoggerDuplicateKeys(t *testing.T) {
+	cases := []struct {
+		policy DuplicatePolicy
+		want   string
+	}{
+		{DuplicateAllow, `"a":1,"b":2,"a":3,"a":4,"message":"m"}`},
+		{DuplicateDrop, `"a":1,"b":2,"message":"m"}`},
+		{DuplicateRename, `"a":1,"b":2,"a_1":3,"a_2":4,"message":"m"}`},
+		{DuplicateOverwrite, `"b":2,"a":4,"message":"m"}`},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		NewLogger(&buf, WithDuplicateKeys(c.policy)).Info().
+			Int("a", 1).Int("b", 2).Int("a", 3).Int("a", 4).
+			Msg("m")
+
+		if got := buf.String(); !strings.HasSuffix(got, c.want+"\n") {
+			t.Errorf("policy %d: got %s, want suffix %s", c.policy, got, c.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	NewLogger(&buf, WithDuplicateKeys(DuplicateDrop)).Info().
+		Str("message", "field").
+		Error(errors.New("first")).
+		Error(errors.New("second")).
+		Msg("msg")
+	got := buf.String()
+	if !strings.HasSuffix(got, `"error":"first","message":"msg"}`+"\n") {
+		t.Errorf("unexpected output: %s", got)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Errorf("invalid JSON: %v: %s", err, got)
+	}
+
+	// The level and time keys count as present, and renames skip keys the
+	// record already has.
+	header := []struct {
+		policy DuplicatePolicy
+		want   string
+	}{
+		{DuplicateDrop, `"x":1,"x_1":2,"message":"m"}`},
+		{DuplicateRename, `"level_1":"l","time_1":"t","x":1,"x_1":2,"x_2":3,"message":"m"}`},
+		{DuplicateOverwrite, `"x_1":2,"x":3,"message":"m"}`},
+	}
+	for _, c := range header {
+		buf.Reset()
+		NewLogger(&buf, WithDuplicateKeys(c.policy)).Info().
+			Str("level", "l").Str("time", "t").
+			Int("x", 1).Int("x_1", 2).Int("x", 3).
+			Msg("m")
+		got := buf.String()
+		if !strings.HasSuffix(got, c.want+"\n") || strings.Count(got, `"level":`) != 1 {
+			t.Errorf("policy %d: got %s, want suffix %s", c.policy, got, c.want)
+		}
+		if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+			t.Errorf("invalid JSON: %v: %s", err, got)
+		}
+	}
+
+	buf.Reset()
+	NewLogger(&buf, WithDuplicateKeys(DuplicateRename)).Info().
+		Int("x", 1).Int("x", 2).Int("x_1", 3).
+		Msg("m")
+	if got := buf.String(); !strings.HasSuffix(got, `"x":1,"x_1":2,"x_1_1":3,"message":"m"}`+"\n") {
+		t.Errorf("rename collision: got %s", got)
+	}
+}
@@ -0,0 +1,327 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"math"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// logfmtQuoteTable marks bytes that force a value to be quoted with 1 and the
+// leading bytes of multi-byte sequences, which are checked for invalid UTF-8
+// and U+2028/U+2029, with 2.
+var logfmtQuoteTable [256]uint8
+
+func init() {
+	logfmtQuoteTable = escapeTable
+	logfmtQuoteTable['\\'] = 0
+	logfmtQuoteTable[' '] = 1
+	logfmtQuoteTable['='] = 1
+	logfmtQuoteTable[0x7f] = 1
+}
+
+// LogfmtLogger and LogfmtEvent name the Logger and Event types to go with
+// NewLogfmtLogger.
+type (
+	LogfmtLogger = Logger
+	LogfmtEvent  = Event
+)
+
+// NewLogfmtLogger returns a Logger writing logfmt. It is short for NewLogger
+// with WithFormat(FormatLogfmt).
+func NewLogfmtLogger(w io.Writer, opts ...Option) *LogfmtLogger {
+	return NewLogger(w, append(opts[:len(opts):len(opts)], WithFormat(FormatLogfmt))...)
+}
+
+// logfmtEncoder writes records as logfmt lines:
+//
+//	level=info time=2024-05-01T12:04:05Z user_id=u123 attempt=3 msg="user login attempt"
+//
+// Values are quoted only when they are empty or contain spaces, '=', '"',
+// control characters or invalid UTF-8, using the same escapes as JSON
+// strings. Keys have those characters replaced with '_'.
+//
+// Complex numbers are always written in the (a+bi) form, and values that
+// would be nested JSON, from RawJSON or Any, are written as quoted JSON text.
+type logfmtEncoder struct {
+	o *options
+}
+
+func (logfmtEncoder) messageKey() string {
+	return "msg"
+}
+
+func (enc logfmtEncoder) Begin(dst []byte, t time.Time, level Level) []byte {
+	dst = appendLogfmtKey(dst, enc.o.names.level())
+	dst = append(dst, '=')
+	dst = append(dst, level.String()...)
+	dst = append(dst, ' ')
+	dst = appendLogfmtKey(dst, enc.o.names.time())
+	dst = append(dst, '=')
+	return appendLogfmtTime(dst, t, enc.o.timeFormat)
+}
+
+func (logfmtEncoder) End(dst []byte, n int) []byte {
+	return append(dst, '\n')
+}
+
+func (logfmtEncoder) AppendKey(dst []byte, key string) []byte {
+	dst = append(dst, ' ')
+	dst = appendLogfmtKey(dst, key)
+	return append(dst, '=')
+}
+
+func (logfmtEncoder) AppendString(dst []byte, val string) []byte {
+	return appendLogfmtValue(dst, val)
+}
+
+func (logfmtEncoder) AppendError(dst []byte, msg string) []byte {
+	return appendLogfmtValue(dst, msg)
+}
+
+// AppendBytes writes val as standard base64, quoted when it carries padding.
+func (logfmtEncoder) AppendBytes(dst []byte, val []byte) []byte {
+	quote := len(val) == 0 || len(val)%3 != 0
+	if quote {
+		dst = append(dst, '"')
+	}
+	encodedLen := base64.StdEncoding.EncodedLen(len(val))
+	dst = slices.Grow(dst, encodedLen+1)
+	n := len(dst)
+	dst = dst[:n+encodedLen]
+	base64.StdEncoding.Encode(dst[n:], val)
+	if quote {
+		dst = append(dst, '"')
+	}
+	return dst
+}
+
+func (logfmtEncoder) AppendInt(dst []byte, val int) []byte {
+	return strconv.AppendInt(dst, int64(val), 10)
+}
+
+func (logfmtEncoder) AppendInt8(dst []byte, val int8) []byte {
+	return strconv.AppendInt(dst, int64(val), 10)
+}
+
+func (logfmtEncoder) AppendInt16(dst []byte, val int16) []byte {
+	return strconv.AppendInt(dst, int64(val), 10)
+}
+
+func (logfmtEncoder) AppendInt32(dst []byte, val int32) []byte {
+	return strconv.AppendInt(dst, int64(val), 10)
+}
+
+func (logfmtEncoder) AppendInt64(dst []byte, val int64) []byte {
+	return strconv.AppendInt(dst, val, 10)
+}
+
+func (logfmtEncoder) AppendUint(dst []byte, val uint) []byte {
+	return strconv.AppendUint(dst, uint64(val), 10)
+}
+
+func (logfmtEncoder) AppendUint8(dst []byte, val uint8) []byte {
+	return strconv.AppendUint(dst, uint64(val), 10)
+}
+
+func (logfmtEncoder) AppendUint16(dst []byte, val uint16) []byte {
+	return strconv.AppendUint(dst, uint64(val), 10)
+}
+
+func (logfmtEncoder) AppendUint32(dst []byte, val uint32) []byte {
+	return strconv.AppendUint(dst, uint64(val), 10)
+}
+
+func (logfmtEncoder) AppendUint64(dst []byte, val uint64) []byte {
+	return strconv.AppendUint(dst, val, 10)
+}
+
+func (logfmtEncoder) AppendUintptr(dst []byte, val uintptr) []byte {
+	return strconv.AppendUint(dst, uint64(val), 10)
+}
+
+func (enc logfmtEncoder) AppendFloat32(dst []byte, val float32) []byte {
+	return appendLogfmtFloat(dst, float64(val), 32, enc.o)
+}
+
+func (enc logfmtEncoder) AppendFloat64(dst []byte, val float64) []byte {
+	return appendLogfmtFloat(dst, val, 64, enc.o)
+}
+
+func (enc logfmtEncoder) AppendComplex64(dst []byte, val complex64) []byte {
+	return appendComplexText(dst, complex128(val), 32, enc.o)
+}
+
+func (enc logfmtEncoder) AppendComplex128(dst []byte, val complex128) []byte {
+	return appendComplexText(dst, val, 64, enc.o)
+}
+
+func (logfmtEncoder) AppendBool(dst []byte, val bool) []byte {
+	return strconv.AppendBool(dst, val)
+}
+
+// AppendTime keeps the fraction of a second, as the JSON encoder does.
+func (enc logfmtEncoder) AppendTime(dst []byte, val time.Time) []byte {
+	if enc.o.timeFormat == TimeRFC3339 {
+		return appendTimeNano(dst, val)
+	}
+	return appendTimeValue(dst, val, enc.o.timeFormat)
+}
+
+func (enc logfmtEncoder) AppendDuration(dst []byte, val time.Duration) []byte {
+	if enc.o.durFormat == DurationString {
+		return appendDuration(dst, val)
+	}
+	return strconv.AppendFloat(dst, float64(val)/float64(time.Millisecond), 'f', -1, 64)
+}
+
+func (logfmtEncoder) AppendNull(dst []byte) []byte {
+	return append(dst, "null"...)
+}
+
+func (logfmtEncoder) AppendHex(dst []byte, val []byte) []byte {
+	if len(val) == 0 {
+		return append(dst, '"', '"')
+	}
+	return appendHex(dst, val)
+}
+
+func (logfmtEncoder) AppendIPAddr(dst []byte, val netip.Addr) []byte {
+	if !val.IsValid() {
+		return append(dst, "null"...)
+	}
+	if val.Zone() != "" {
+		return appendLogfmtValue(dst, val.String())
+	}
+	return val.AppendTo(dst)
+}
+
+func (logfmtEncoder) AppendIPPrefix(dst []byte, val netip.Prefix) []byte {
+	if !val.IsValid() {
+		return append(dst, "null"...)
+	}
+	return val.AppendTo(dst)
+}
+
+func (logfmtEncoder) AppendMAC(dst []byte, val net.HardwareAddr) []byte {
+	if len(val) == 0 {
+		return append(dst, '"', '"')
+	}
+	for i, b := range val {
+		if i > 0 {
+			dst = append(dst, ':')
+		}
+		dst = append(dst, hex[b>>4], hex[b&0xF])
+	}
+	return dst
+}
+
+func (logfmtEncoder) AppendUUID(dst []byte, val [16]byte) []byte {
+	return appendUUID(dst, val)
+}
+
+// AppendRawJSON writes val as quoted JSON text, compacted and validated when
+// configured with WithRawJSONValidation.
+func (enc logfmtEncoder) AppendRawJSON(dst []byte, val []byte) []byte {
+	if enc.o.validateRaw {
+		var b bytes.Buffer
+		if err := json.Compact(&b, val); err != nil {
+			return appendLogfmtValue(dst, err.Error())
+		}
+		return appendLogfmtValue(dst, b.String())
+	}
+	return appendLogfmtValue(dst, string(val))
+}
+
+// AppendAny writes val as quoted JSON text from encoding/json, or the
+// marshaling error.
+func (logfmtEncoder) AppendAny(dst []byte, val any) []byte {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return appendLogfmtValue(dst, err.Error())
+	}
+	return appendLogfmtValue(dst, string(b))
+}
+
+// appendLogfmtValue writes s bare, or as a quoted JSON string if it is empty
+// or would otherwise be ambiguous.
+func appendLogfmtValue(dst []byte, s string) []byte {
+	if s == "" {
+		return append(dst, '"', '"')
+	}
+	for i := 0; i < len(s); i++ {
+		switch logfmtQuoteTable[s[i]] {
+		case 0:
+			continue
+		case 2:
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if size > 1 && r != '\u2028' && r != '\u2029' {
+				i += size - 1
+				continue
+			}
+		}
+		return appendEscaped(dst, s, &escapeTable)
+	}
+	return append(dst, s...)
+}
+
+// appendLogfmtKey writes key with the bytes that would end it early, and any
+// invalid UTF-8, replaced with '_'.
+func appendLogfmtKey(dst []byte, key string) []byte {
+	if key == "" {
+		return append(dst, '_')
+	}
+	start := 0
+	for i := 0; i < len(key); i++ {
+		size := 1
+		switch logfmtQuoteTable[key[i]] {
+		case 0:
+			continue
+		case 2:
+			var r rune
+			r, size = utf8.DecodeRuneInString(key[i:])
+			if size > 1 && r != '\u2028' && r != '\u2029' {
+				i += size - 1
+				continue
+			}
+		}
+		dst = append(dst, key[start:i]...)
+		dst = append(dst, '_')
+		i += size - 1
+		start = i + 1
+	}
+	return append(dst, key[start:]...)
+}
+
+// appendLogfmtTime writes t bare in RFC 3339 form or as a Unix number.
+func appendLogfmtTime(dst []byte, t time.Time, f TimeFormat) []byte {
+	if f == TimeRFC3339 {
+		return appendTime(dst, t)
+	}
+	return appendTimeValue(dst, t, f)
+}
+
+// appendLogfmtFloat writes f like appendFloat, with NaN and infinities left
+// unquoted.
+func appendLogfmtFloat(dst []byte, f float64, bitSize int, o *options) []byte {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		if o.nonFinite == NonFiniteNull {
+			return append(dst, "null"...)
+		}
+		switch {
+		case math.IsNaN(f):
+			return append(dst, "NaN"...)
+		case f > 0:
+			return append(dst, "+Inf"...)
+		}
+		return append(dst, "-Inf"...)
+	}
+	return appendFloatText(dst, f, bitSize, o)
+}
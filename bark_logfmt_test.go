@@ -0,0 +1,156 @@
+package bark
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/netip"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogfmtLoggerAllTypes(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogfmtLogger(&buf)
+
+	l.Info().
+		Str("str", "foo").
+		Str("spaced", "foo bar").
+		Str("empty", "").
+		Bytes("bytes", []byte("bar")).
+		Bytes("padded", []byte("ba")).
+		Int("int", -1).
+		Uint64("uint64", 64).
+		Float64("float64", 4.56).
+		Float64("nan", math.NaN()).
+		Complex128("complex128", 3-4i).
+		Bool("bool", true).
+		Dur("dur", 1500*time.Microsecond).
+		Time("at", time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)).
+		IPAddr("ip", netip.MustParseAddr("10.0.0.1")).
+		IPAddr("noip", netip.Addr{}).
+		MACAddr("mac", net.HardwareAddr{0, 0x1a, 0x2b, 0x3c, 0x4d, 0x5e}).
+		UUID("id", [16]byte{0x12, 0x34}).
+		Hex("hex", []byte{0xde, 0xad}).
+		RawJSON("body", []byte(`{"a":1}`)).
+		Any("list", []int{1, 2}).
+		Error(errors.New("oops")).
+		Msg("done")
+
+	got := buf.String()
+	if !regexp.MustCompile(`^level=info time=\d{4}-\d\d-\d\dT\d\d:\d\d:\d\d(Z|[+-]\d\d:\d\d) `).MatchString(got) {
+		t.Errorf("unexpected header: %s", got)
+	}
+	want := ` str=foo spaced="foo bar" empty="" bytes=YmFy padded="YmE=" int=-1 uint64=64` +
+		` float64=4.56 nan=NaN complex128=(3-4i) bool=true dur=1.5 at=2023-10-01T12:00:00Z` +
+		` ip=10.0.0.1 noip=null mac=00:1a:2b:3c:4d:5e id=12340000-0000-0000-0000-000000000000` +
+		` hex=dead body="{\"a\":1}" list=[1,2] error=oops msg=done` + "\n"
+	if !strings.HasSuffix(got, want) {
+		t.Errorf("got %s\nwant suffix %s", got, want)
+	}
+}
+
+func TestLogfmtQuoting(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"plain", `plain`},
+		{`back\slash`, `back\slash`},
+		{"a=b", `"a=b"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"line\nbreak", `"line\nbreak"`},
+		{"tab\there", `"tab\there"`},
+		{"del\x7f", "\"del\x7f\""},
+		{"héllo", `héllo`},
+		{"bad\xff", `"bad\ufffd"`},
+		{"sep\u2028", `"sep\u2028"`},
+	}
+	for _, c := range cases {
+		if got := string(appendLogfmtValue(nil, c.in)); got != c.want {
+			t.Errorf("value %q: got %s, want %s", c.in, got, c.want)
+		}
+	}
+
+	for in, want := range map[string]string{
+		"user id": "user_id",
+		"a=b":     "a_b",
+		`q"`:      "q_",
+		"bad\xff": "bad_",
+		"héllo":   "héllo",
+		"":        "_",
+	} {
+		if got := string(appendLogfmtKey(nil, in)); got != want {
+			t.Errorf("key %q: got %s, want %s", in, got, want)
+		}
+	}
+}
+
+func TestLogfmtLoggerOptions(t *testing.T) {
+	ts := time.Unix(1696161600, 0)
+
+	var buf bytes.Buffer
+	NewLogfmtLogger(&buf,
+		WithTimeFormat(TimeUnix),
+		WithDurationFormat(DurationString),
+		WithNonFinite(NonFiniteNull),
+	).Info().
+		Time("at", ts).
+		Dur("d", 1500*time.Microsecond).
+		Float64("inf", math.Inf(1)).
+		Msg("m")
+	if got := buf.String(); !strings.HasSuffix(got, " at=1696161600 d=1.5ms inf=null msg=m\n") {
+		t.Errorf("unexpected output: %s", got)
+	}
+
+	buf.Reset()
+	NewLogfmtLogger(&buf, WithDuplicateKeys(DuplicateRename)).Info().
+		Int("a", 1).Int("a", 2).Str("msg", "field").
+		Msg("m")
+	if got := buf.String(); !strings.HasSuffix(got, " a=1 a_1=2 msg=m\n") {
+		t.Errorf("unexpected output: %s", got)
+	}
+}
+
+func TestLogfmtLoggerMaxRecordSize(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogfmtLogger(&buf, WithMaxRecordSize(96, OverflowTruncate))
+
+	l.Info().Str("a", "small").Bytes("blob", make([]byte, 4096)).Int("b", 1).Msg("kept")
+	got := buf.String()
+	if len(got) > 96 || !strings.HasSuffix(got, " a=small b=1 msg=kept _truncated=true\n") {
+		t.Errorf("unexpected output (%d bytes): %s", len(got), got)
+	}
+
+	buf.Reset()
+	l.Info().Msg(strings.Repeat("m", 500))
+	if got := buf.String(); len(got) > 96 || !strings.HasSuffix(got, " _truncated=true\n") {
+		t.Errorf("long message not shortened to fit: %s", got)
+	}
+
+	buf.Reset()
+	l = NewLogfmtLogger(&buf, WithMaxRecordSize(96, OverflowReplace))
+	l.Info().Str("big", strings.Repeat("x", 200)).Msg("replaced")
+	got = buf.String()
+	if !strings.Contains(got, " size_limit=96 msg=\"record exceeded size limit\"\n") || strings.Contains(got, "replaced") {
+		t.Errorf("unexpected replacement: %s", got)
+	}
+}
+
+func BenchmarkLogfmtLogger(b *testing.B) {
+	l := NewLogfmtLogger(io.Discard)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		l.Info().
+			Str("user_id", "u123").
+			Str("path", "/api/v1 login").
+			Int("attempt", 3).
+			Bool("success", true).
+			Float64("latency", 12.5).
+			Msg("user login attempt")
+	}
+}
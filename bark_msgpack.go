@@ -0,0 +1,390 @@
+package bark
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"maps"
+	"math"
+	"net"
+	"net/netip"
+	"slices"
+	"time"
+)
+
+const (
+	msgpackNil     = 0xc0
+	msgpackFalse   = 0xc2
+	msgpackTrue    = 0xc3
+	msgpackFloat32 = 0xca
+	msgpackFloat64 = 0xcb
+
+	// msgpackMap32 starts a map whose count is patched in once the record is
+	// complete.
+	msgpackMap32 = 0xdf
+
+	// msgpackExtTime is the extension type of the timestamp extension.
+	msgpackExtTime = 0xff
+)
+
+// MsgpackLogger and MsgpackEvent name the Logger and Event types to go with
+// NewMsgpackLogger.
+type (
+	MsgpackLogger = Logger
+	MsgpackEvent  = Event
+)
+
+// NewMsgpackLogger returns a Logger writing MessagePack. It is short for
+// NewLogger with WithFormat(FormatMsgpack).
+func NewMsgpackLogger(w io.Writer, opts ...Option) *MsgpackLogger {
+	return NewLogger(w, append(opts[:len(opts):len(opts)], WithFormat(FormatMsgpack))...)
+}
+
+// msgpackEncoder writes each record as a MessagePack map, so a log stream is
+// a sequence of maps that any MessagePack library can decode one at a time.
+//
+// Values keep their native MessagePack types: integers in their smallest
+// encoding, floats, bin, booleans and nil. Times use the timestamp extension
+// (type -1). Durations and complex numbers follow the logger options as for
+// JSON, while floats are always written natively, NaN and infinities
+// included. Values from RawJSON and Any are converted to MessagePack maps and
+// arrays.
+type msgpackEncoder struct {
+	o *options
+}
+
+// Begin starts a map whose count End patches in once the record is complete.
+func (enc msgpackEncoder) Begin(dst []byte, t time.Time, level Level) []byte {
+	dst = append(dst, msgpackMap32, 0, 0, 0, 0)
+	dst = appendMsgpackStr(dst, enc.o.names.level())
+	dst = appendMsgpackStr(dst, level.String())
+	dst = appendMsgpackStr(dst, enc.o.names.time())
+	return appendMsgpackTime(dst, t)
+}
+
+func (msgpackEncoder) End(dst []byte, n int) []byte {
+	binary.BigEndian.PutUint32(dst[1:5], uint32(n+2))
+	return dst
+}
+
+// AppendKey writes key as a str, replacing invalid UTF-8.
+func (msgpackEncoder) AppendKey(dst []byte, key string) []byte {
+	return appendMsgpackStr(dst, key)
+}
+
+func (msgpackEncoder) AppendString(dst []byte, val string) []byte {
+	return appendMsgpackStr(dst, val)
+}
+
+// AppendBytes writes val as MessagePack bin.
+func (msgpackEncoder) AppendBytes(dst []byte, val []byte) []byte {
+	dst = appendMsgpackBinHead(dst, len(val))
+	return append(dst, val...)
+}
+
+func (msgpackEncoder) AppendError(dst []byte, msg string) []byte {
+	return appendMsgpackStr(dst, msg)
+}
+
+func (msgpackEncoder) AppendInt(dst []byte, val int) []byte {
+	return appendMsgpackInt(dst, int64(val))
+}
+
+func (msgpackEncoder) AppendInt8(dst []byte, val int8) []byte {
+	return appendMsgpackInt(dst, int64(val))
+}
+
+func (msgpackEncoder) AppendInt16(dst []byte, val int16) []byte {
+	return appendMsgpackInt(dst, int64(val))
+}
+
+func (msgpackEncoder) AppendInt32(dst []byte, val int32) []byte {
+	return appendMsgpackInt(dst, int64(val))
+}
+
+func (msgpackEncoder) AppendInt64(dst []byte, val int64) []byte {
+	return appendMsgpackInt(dst, val)
+}
+
+func (msgpackEncoder) AppendUint(dst []byte, val uint) []byte {
+	return appendMsgpackUint(dst, uint64(val))
+}
+
+func (msgpackEncoder) AppendUint8(dst []byte, val uint8) []byte {
+	return appendMsgpackUint(dst, uint64(val))
+}
+
+func (msgpackEncoder) AppendUint16(dst []byte, val uint16) []byte {
+	return appendMsgpackUint(dst, uint64(val))
+}
+
+func (msgpackEncoder) AppendUint32(dst []byte, val uint32) []byte {
+	return appendMsgpackUint(dst, uint64(val))
+}
+
+func (msgpackEncoder) AppendUint64(dst []byte, val uint64) []byte {
+	return appendMsgpackUint(dst, val)
+}
+
+func (msgpackEncoder) AppendUintptr(dst []byte, val uintptr) []byte {
+	return appendMsgpackUint(dst, uint64(val))
+}
+
+func (msgpackEncoder) AppendFloat32(dst []byte, val float32) []byte {
+	return appendMsgpackFloat(dst, float64(val), 32)
+}
+
+func (msgpackEncoder) AppendFloat64(dst []byte, val float64) []byte {
+	return appendMsgpackFloat(dst, val, 64)
+}
+
+func (enc msgpackEncoder) AppendComplex64(dst []byte, val complex64) []byte {
+	return appendMsgpackComplex(dst, complex128(val), 32, enc.o)
+}
+
+func (enc msgpackEncoder) AppendComplex128(dst []byte, val complex128) []byte {
+	return appendMsgpackComplex(dst, val, 64, enc.o)
+}
+
+func (msgpackEncoder) AppendBool(dst []byte, val bool) []byte {
+	return appendMsgpackBool(dst, val)
+}
+
+// AppendTime writes val with the timestamp extension.
+func (msgpackEncoder) AppendTime(dst []byte, val time.Time) []byte {
+	return appendMsgpackTime(dst, val)
+}
+
+func (enc msgpackEncoder) AppendDuration(dst []byte, val time.Duration) []byte {
+	if enc.o.durFormat == DurationString {
+		var tmp [32]byte
+		return appendMsgpackASCII(dst, appendDuration(tmp[:0], val))
+	}
+	return appendMsgpackFloat(dst, float64(val)/float64(time.Millisecond), 64)
+}
+
+func (msgpackEncoder) AppendNull(dst []byte) []byte {
+	return append(dst, msgpackNil)
+}
+
+// AppendHex writes val as a lowercase hex string.
+func (msgpackEncoder) AppendHex(dst []byte, val []byte) []byte {
+	dst = appendMsgpackStrHead(dst, 2*len(val))
+	return appendHex(dst, val)
+}
+
+func (msgpackEncoder) AppendIPAddr(dst []byte, val netip.Addr) []byte {
+	if !val.IsValid() {
+		return append(dst, msgpackNil)
+	}
+	if val.Zone() != "" {
+		return appendMsgpackStr(dst, val.String())
+	}
+	var tmp [64]byte
+	return appendMsgpackASCII(dst, val.AppendTo(tmp[:0]))
+}
+
+func (msgpackEncoder) AppendIPPrefix(dst []byte, val netip.Prefix) []byte {
+	if !val.IsValid() {
+		return append(dst, msgpackNil)
+	}
+	var tmp [64]byte
+	return appendMsgpackASCII(dst, val.AppendTo(tmp[:0]))
+}
+
+func (msgpackEncoder) AppendMAC(dst []byte, val net.HardwareAddr) []byte {
+	dst = appendMsgpackStrHead(dst, max(3*len(val)-1, 0))
+	for i, b := range val {
+		if i > 0 {
+			dst = append(dst, ':')
+		}
+		dst = append(dst, hex[b>>4], hex[b&0xF])
+	}
+	return dst
+}
+
+// AppendUUID writes val as a string in the canonical 8-4-4-4-12 form.
+func (msgpackEncoder) AppendUUID(dst []byte, val [16]byte) []byte {
+	dst = appendMsgpackStrHead(dst, 36)
+	return appendUUID(dst, val)
+}
+
+// AppendRawJSON converts val to the equivalent MessagePack value, or writes
+// the decoding error if it is invalid.
+func (msgpackEncoder) AppendRawJSON(dst []byte, val []byte) []byte {
+	v, err := decodeJSON(val)
+	if err != nil {
+		return appendMsgpackStr(dst, err.Error())
+	}
+	return appendMsgpackValue(dst, v)
+}
+
+// AppendAny converts val through encoding/json, or writes the marshaling
+// error.
+func (enc msgpackEncoder) AppendAny(dst []byte, val any) []byte {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return appendMsgpackStr(dst, err.Error())
+	}
+	return enc.AppendRawJSON(dst, b)
+}
+
+// appendMsgpackInt writes v in its smallest encoding.
+func appendMsgpackInt(dst []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendMsgpackUint(dst, uint64(v))
+	case v >= -32:
+		return append(dst, byte(v))
+	case v >= math.MinInt8:
+		return append(dst, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xd2), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(dst, 0xd3), uint64(v))
+}
+
+// appendMsgpackUint writes v in its smallest encoding.
+func appendMsgpackUint(dst []byte, v uint64) []byte {
+	switch {
+	case v <= math.MaxInt8:
+		return append(dst, byte(v))
+	case v <= math.MaxUint8:
+		return append(dst, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(dst, 0xce), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(dst, 0xcf), v)
+}
+
+func appendMsgpackFloat(dst []byte, f float64, bitSize int) []byte {
+	if bitSize == 32 {
+		return binary.BigEndian.AppendUint32(append(dst, msgpackFloat32), math.Float32bits(float32(f)))
+	}
+	return binary.BigEndian.AppendUint64(append(dst, msgpackFloat64), math.Float64bits(f))
+}
+
+func appendMsgpackBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, msgpackTrue)
+	}
+	return append(dst, msgpackFalse)
+}
+
+func appendMsgpackStrHead(dst []byte, n int) []byte {
+	switch {
+	case n < 32:
+		return append(dst, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		return append(dst, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xda), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(dst, 0xdb), uint32(n))
+}
+
+func appendMsgpackBinHead(dst []byte, n int) []byte {
+	switch {
+	case n <= math.MaxUint8:
+		return append(dst, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xc5), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(dst, 0xc6), uint32(n))
+}
+
+func appendMsgpackArrayHead(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xdc), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(dst, 0xdd), uint32(n))
+}
+
+func appendMsgpackMapHead(dst []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(dst, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(dst, 0xde), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(dst, msgpackMap32), uint32(n))
+}
+
+// appendMsgpackStr writes s as a str, replacing invalid UTF-8 with U+FFFD.
+func appendMsgpackStr(dst []byte, s string) []byte {
+	dst = appendMsgpackStrHead(dst, validUTF8Len(s))
+	return appendValidUTF8(dst, s)
+}
+
+// appendMsgpackASCII writes b, known to be valid UTF-8, as a str.
+func appendMsgpackASCII(dst, b []byte) []byte {
+	dst = appendMsgpackStrHead(dst, len(b))
+	return append(dst, b...)
+}
+
+// appendMsgpackTime writes t with the timestamp extension in the smallest of
+// its 32, 64 and 96-bit forms.
+func appendMsgpackTime(dst []byte, t time.Time) []byte {
+	sec, nsec := t.Unix(), uint64(t.Nanosecond())
+	if sec >= 0 && sec < 1<<34 {
+		if nsec == 0 && sec <= math.MaxUint32 {
+			return binary.BigEndian.AppendUint32(append(dst, 0xd6, msgpackExtTime), uint32(sec))
+		}
+		return binary.BigEndian.AppendUint64(append(dst, 0xd7, msgpackExtTime), nsec<<34|uint64(sec))
+	}
+	dst = append(dst, 0xc7, 12, msgpackExtTime)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(nsec))
+	return binary.BigEndian.AppendUint64(dst, uint64(sec))
+}
+
+// appendMsgpackComplex writes c as an "(a+bi)" string, or as a
+// {"real": a, "imag": b} map when configured.
+func appendMsgpackComplex(dst []byte, c complex128, bitSize int, o *options) []byte {
+	if o.complexObject {
+		dst = append(dst, 0x82, 0xa4, 'r', 'e', 'a', 'l')
+		dst = appendMsgpackFloat(dst, real(c), bitSize)
+		dst = append(dst, 0xa4, 'i', 'm', 'a', 'g')
+		return appendMsgpackFloat(dst, imag(c), bitSize)
+	}
+	var tmp [64]byte
+	return appendMsgpackASCII(dst, appendComplexText(tmp[:0], c, bitSize, o))
+}
+
+// appendMsgpackValue writes a value decoded by decodeJSON.
+func appendMsgpackValue(dst []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(dst, msgpackNil)
+	case bool:
+		return appendMsgpackBool(dst, v)
+	case string:
+		return appendMsgpackStr(dst, v)
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return appendMsgpackInt(dst, i)
+		}
+		f, _ := v.Float64()
+		return appendMsgpackFloat(dst, f, 64)
+	case []any:
+		dst = appendMsgpackArrayHead(dst, len(v))
+		for _, x := range v {
+			dst = appendMsgpackValue(dst, x)
+		}
+		return dst
+	case map[string]any:
+		dst = appendMsgpackMapHead(dst, len(v))
+		for _, k := range slices.Sorted(maps.Keys(v)) {
+			dst = appendMsgpackStr(dst, k)
+			dst = appendMsgpackValue(dst, v[k])
+		}
+		return dst
+	}
+	return append(dst, msgpackNil)
+}
@@ -0,0 +1,271 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type extItem struct {
+	typ  int8
+	data []byte
+}
+
+// decodeMsgpack decodes the subset of MessagePack written by MsgpackLogger,
+// returning the value at the start of p and the bytes after it.
+func decodeMsgpack(t *testing.T, p []byte) (any, []byte) {
+	t.Helper()
+	if len(p) == 0 {
+		t.Fatal("unexpected end of input")
+	}
+	b := p[0]
+	p = p[1:]
+	str := func(n int) (any, []byte) { return string(p[:n]), p[n:] }
+	bin := func(n int) (any, []byte) { return bytes.Clone(p[:n]), p[n:] }
+	array := func(n int, p []byte) (any, []byte) {
+		a := make([]any, n)
+		for i := range a {
+			a[i], p = decodeMsgpack(t, p)
+		}
+		return a, p
+	}
+	object := func(n int, p []byte) (any, []byte) {
+		m := make(map[string]any, n)
+		for range n {
+			var k, v any
+			k, p = decodeMsgpack(t, p)
+			v, p = decodeMsgpack(t, p)
+			m[k.(string)] = v
+		}
+		return m, p
+	}
+	u16 := func() int { n := int(binary.BigEndian.Uint16(p)); p = p[2:]; return n }
+	u32 := func() int { n := int(binary.BigEndian.Uint32(p)); p = p[4:]; return n }
+
+	switch {
+	case b <= 0x7f:
+		return int64(b), p
+	case b >= 0xe0:
+		return int64(int8(b)), p
+	case b&0xe0 == 0xa0:
+		return str(int(b & 0x1f))
+	case b&0xf0 == 0x90:
+		return array(int(b&0x0f), p)
+	case b&0xf0 == 0x80:
+		return object(int(b&0x0f), p)
+	}
+	switch b {
+	case msgpackNil:
+		return nil, p
+	case msgpackFalse:
+		return false, p
+	case msgpackTrue:
+		return true, p
+	case 0xc4:
+		n := int(p[0])
+		p = p[1:]
+		return bin(n)
+	case 0xc5:
+		return bin(u16())
+	case 0xc6:
+		return bin(u32())
+	case 0xc7:
+		n, typ := int(p[0]), int8(p[1])
+		return extItem{typ, bytes.Clone(p[2 : 2+n])}, p[2+n:]
+	case msgpackFloat32:
+		return math.Float32frombits(binary.BigEndian.Uint32(p)), p[4:]
+	case msgpackFloat64:
+		return math.Float64frombits(binary.BigEndian.Uint64(p)), p[8:]
+	case 0xcc:
+		return int64(p[0]), p[1:]
+	case 0xcd:
+		return int64(binary.BigEndian.Uint16(p)), p[2:]
+	case 0xce:
+		return int64(binary.BigEndian.Uint32(p)), p[4:]
+	case 0xcf:
+		return binary.BigEndian.Uint64(p), p[8:]
+	case 0xd0:
+		return int64(int8(p[0])), p[1:]
+	case 0xd1:
+		return int64(int16(binary.BigEndian.Uint16(p))), p[2:]
+	case 0xd2:
+		return int64(int32(binary.BigEndian.Uint32(p))), p[4:]
+	case 0xd3:
+		return int64(binary.BigEndian.Uint64(p)), p[8:]
+	case 0xd6:
+		return extItem{int8(p[0]), bytes.Clone(p[1:5])}, p[5:]
+	case 0xd7:
+		return extItem{int8(p[0]), bytes.Clone(p[1:9])}, p[9:]
+	case 0xd9:
+		n := int(p[0])
+		p = p[1:]
+		return str(n)
+	case 0xda:
+		return str(u16())
+	case 0xdb:
+		return str(u32())
+	case 0xdc:
+		n := u16()
+		return array(n, p)
+	case 0xdd:
+		n := u32()
+		return array(n, p)
+	case 0xde:
+		n := u16()
+		return object(n, p)
+	case msgpackMap32:
+		n := u32()
+		return object(n, p)
+	}
+	t.Fatalf("unsupported type byte %#x", b)
+	return nil, nil
+}
+
+func decodeMsgpackRecord(t *testing.T, p []byte) map[string]any {
+	t.Helper()
+	v, rest := decodeMsgpack(t, p)
+	if len(rest) != 0 {
+		t.Fatalf("%d trailing bytes after record", len(rest))
+	}
+	return v.(map[string]any)
+}
+
+func TestMsgpackLoggerAllTypes(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewMsgpackLogger(&buf, WithDurationFormat(DurationString), WithComplexObject())
+
+	l.Info().
+		Str("str", "foo").
+		Str("long", strings.Repeat("x", 40)).
+		Bytes("bytes", []byte{1, 2, 3}).
+		Int("small", -5).
+		Int("int", -200).
+		Int64("big", math.MinInt64).
+		Uint64("uint64", math.MaxUint64).
+		Uint("uint", 300).
+		Float32("float32", 1.5).
+		Float64("nan", math.NaN()).
+		Complex64("complex", 3-4i).
+		Bool("bool", false).
+		Time("sec", time.Unix(1696161600, 0)).
+		Time("nano", time.Unix(1696161600, 5)).
+		Time("old", time.Unix(-1, 0)).
+		Dur("dur", 1500*time.Microsecond).
+		IPPrefix("net", netip.MustParsePrefix("10.0.0.0/8")).
+		UUID("id", [16]byte{0x12}).
+		RawJSON("body", []byte(`{"b":[1,-2.5]}`)).
+		Error(errors.New("oops")).
+		Msg("done")
+
+	rec := decodeMsgpackRecord(t, buf.Bytes())
+	nano := binary.BigEndian.AppendUint64(nil, 5<<34|1696161600)
+	old := binary.BigEndian.AppendUint64(make([]byte, 4), math.MaxUint64)
+	want := map[string]any{
+		"level":   "info",
+		"str":     "foo",
+		"long":    strings.Repeat("x", 40),
+		"bytes":   []byte{1, 2, 3},
+		"small":   int64(-5),
+		"int":     int64(-200),
+		"big":     int64(math.MinInt64),
+		"uint64":  uint64(math.MaxUint64),
+		"uint":    int64(300),
+		"float32": float32(1.5),
+		"complex": map[string]any{"real": float32(3), "imag": float32(-4)},
+		"bool":    false,
+		"sec":     extItem{-1, binary.BigEndian.AppendUint32(nil, 1696161600)},
+		"nano":    extItem{-1, nano},
+		"old":     extItem{-1, old},
+		"dur":     "1.5ms",
+		"net":     "10.0.0.0/8",
+		"id":      "12000000-0000-0000-0000-000000000000",
+		"body":    map[string]any{"b": []any{int64(1), -2.5}},
+		"error":   "oops",
+		"message": "done",
+	}
+	if f, ok := rec["nan"].(float64); !ok || !math.IsNaN(f) {
+		t.Errorf("nan: got %#v", rec["nan"])
+	}
+	if ts, ok := rec["time"].(extItem); !ok || ts.typ != -1 {
+		t.Errorf("unexpected record time: %#v", rec["time"])
+	}
+	delete(rec, "nan")
+	delete(rec, "time")
+	for k, v := range want {
+		if !reflect.DeepEqual(rec[k], v) {
+			t.Errorf("%s: got %#v, want %#v", k, rec[k], v)
+		}
+	}
+	if len(rec) != len(want) {
+		t.Errorf("got %d fields, want %d: %v", len(rec), len(want), rec)
+	}
+}
+
+func TestMsgpackLoggerDuplicateKeys(t *testing.T) {
+	cases := []struct {
+		policy DuplicatePolicy
+		want   map[string]any
+	}{
+		{DuplicateDrop, map[string]any{"a": int64(1), "b": int64(2)}},
+		{DuplicateRename, map[string]any{"a": int64(1), "b": int64(2), "a_1": int64(3), "a_2": int64(4)}},
+		{DuplicateOverwrite, map[string]any{"a": int64(4), "b": int64(2)}},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		NewMsgpackLogger(&buf, WithDuplicateKeys(c.policy)).Info().
+			Int("a", 1).Int("b", 2).Int("a", 3).Int("a", 4).Str("message", "field").
+			Msg("m")
+
+		rec := decodeMsgpackRecord(t, buf.Bytes())
+		if len(rec) != len(c.want)+3 || rec["message"] != "m" {
+			t.Errorf("policy %d: unexpected record %v", c.policy, rec)
+		}
+		for k, v := range c.want {
+			if rec[k] != v {
+				t.Errorf("policy %d: %s = %v, want %v", c.policy, k, rec[k], v)
+			}
+		}
+	}
+}
+
+func TestMsgpackLoggerMaxRecordSize(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewMsgpackLogger(&buf, WithMaxRecordSize(96, OverflowTruncate))
+
+	l.Info().Str("a", "small").Bytes("blob", make([]byte, 4096)).Int("b", 1).Msg(strings.Repeat("m", 200))
+	if buf.Len() > 96 {
+		t.Errorf("record exceeds limit: %d bytes", buf.Len())
+	}
+	rec := decodeMsgpackRecord(t, buf.Bytes())
+	if rec["a"] != "small" || rec["b"] != int64(1) || rec["_truncated"] != true || rec["blob"] != nil {
+		t.Errorf("unexpected record: %v", rec)
+	}
+
+	buf.Reset()
+	l = NewMsgpackLogger(&buf, WithMaxRecordSize(96, OverflowDrop))
+	l.Info().Str("big", strings.Repeat("x", 200)).Msg("dropped")
+	if buf.Len() != 0 {
+		t.Errorf("expected record to be dropped, got %d bytes", buf.Len())
+	}
+}
+
+func BenchmarkMsgpackLogger(b *testing.B) {
+	l := NewMsgpackLogger(io.Discard)
+	b.ReportAllocs()
+
+	for b.Loop() {
+		l.Info().
+			Str("key", "value").
+			Int("id", 1234).
+			Float64("pi", 3.14).
+			Bool("enabled", true).
+			Msg("benchmark")
+	}
+}
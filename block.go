@@ -0,0 +1,464 @@
+package bark
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// A block stream is a sequence of blocks, each holding consecutive binary
+// frames compressed together, optionally followed by an index of the blocks:
+//
+//	block:   [Magic "BKB1"][Codec uint8][Frames uint32][RawLen uint32]
+//	         [DataLen uint32][First int64][Last int64][CRC32 uint32][Data]
+//	index:   [Magic "BKI1"][Count uint32] Count × [Offset uint64][Frames uint32]
+//	         [First int64][Last int64]
+//	trailer: [IndexOffset uint64][Magic "BKX1"]
+//
+// First and Last are the earliest and latest frame timestamps in the block,
+// in Unix nanoseconds, and the CRC32 (IEEE) covers Data. RawLen is at most
+// 64 MiB, and DataLen a little more to allow for incompressible data; readers
+// reject larger blocks as corrupt rather than allocate for them. The index lets
+// readers find blocks without reading the others; a stream cut short before
+// its index is still readable.
+const (
+	BlockMagic   = "BKB1"
+	indexMagic   = "BKI1"
+	trailerMagic = "BKX1"
+)
+
+const (
+	blockHeaderSize  = 4 + 1 + 4 + 4 + 4 + 8 + 8 + 4
+	indexEntrySize   = 8 + 4 + 8 + 8
+	trailerSize      = 8 + 4
+	defaultBlockSize = 64 << 10
+	maxBlockSize     = 64 << 20
+	maxBlockData     = maxBlockSize + maxBlockSize/64
+)
+
+// ErrCorruptBlock is returned for blocks whose header or checksum is wrong.
+var ErrCorruptBlock = errors.New("bark: corrupt block")
+
+// BlockInfo describes one block of a stream.
+type BlockInfo struct {
+	Offset int64 // of the block header in the stream
+	Frames int
+	First  time.Time // earliest frame timestamp
+	Last   time.Time // latest frame timestamp
+}
+
+// BlockWriter groups binary frames into blocks compressed with a Codec. Each
+// Write must be one or more complete frames, as a binary Logger writes them.
+// A block is written once it holds blockSize bytes of frames, on Flush and on
+// Close, which also writes the index. Frames not yet flushed are lost if the
+// process dies, so call Flush periodically when the log is read live.
+//
+// The stream starts at the current position of w, which should be the start
+// of a new file for the index offsets to hold.
+type BlockWriter struct {
+	w     io.Writer
+	codec Codec
+	size  int
+
+	mu          sync.Mutex
+	raw         []byte
+	comp        []byte
+	frames      int
+	first, last int64
+	off         int64
+	index       []BlockInfo
+	closed      bool
+}
+
+// NewBlockWriter returns a BlockWriter compressing blocks of about blockSize
+// bytes with codec. A nil codec means CodecFlate and a blockSize of zero
+// means 64 KiB; blocks are never larger than 64 MiB.
+func NewBlockWriter(w io.Writer, codec Codec, blockSize int) *BlockWriter {
+	if codec == nil {
+		codec = CodecFlate
+	}
+	if blockSize <= 0 {
+		blockSize = defaultBlockSize
+	}
+	blockSize = min(blockSize, maxBlockSize)
+	return &BlockWriter{w: w, codec: codec, size: blockSize}
+}
+
+func (b *BlockWriter) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return 0, os.ErrClosed
+	}
+	frames, first, last, err := frameSpan(p)
+	if err != nil {
+		return 0, err
+	}
+	if len(p) > maxBlockSize {
+		return 0, fmt.Errorf("bark: %d bytes of frames do not fit in a block", len(p))
+	}
+	if len(b.raw)+len(p) > maxBlockSize {
+		if err := b.flush(); err != nil {
+			return 0, err
+		}
+	}
+	if b.frames == 0 {
+		b.first, b.last = first, last
+	}
+	b.first, b.last = min(b.first, first), max(b.last, last)
+	b.frames += frames
+	b.raw = append(b.raw, p...)
+	if len(b.raw) >= b.size {
+		if err := b.flush(); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// frameSpan checks that p holds whole frames and returns their number and
+// earliest and latest timestamps.
+func frameSpan(p []byte) (frames int, first, last int64, err error) {
+	first, last = math.MaxInt64, math.MinInt64
+	for len(p) > 0 {
+		if len(p) < 14 || 6+int(binary.LittleEndian.Uint32(p[2:6])) > len(p) {
+			return 0, 0, 0, fmt.Errorf("%w: writes must be whole frames", ErrMalformed)
+		}
+		t := int64(binary.LittleEndian.Uint64(p[6:14]))
+		first, last = min(first, t), max(last, t)
+		p = p[6+binary.LittleEndian.Uint32(p[2:6]):]
+		frames++
+	}
+	return frames, first, last, nil
+}
+
+// Flush writes the frames held so far as a block.
+func (b *BlockWriter) Flush() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.flush()
+}
+
+// Close writes the last block and the index. It does not close the
+// underlying writer.
+func (b *BlockWriter) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	if err := b.flush(); err != nil {
+		return err
+	}
+	buf := append(b.comp[:0], indexMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(b.index)))
+	for _, bi := range b.index {
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(bi.Offset))
+		buf = binary.LittleEndian.AppendUint32(buf, uint32(bi.Frames))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(bi.First.UnixNano()))
+		buf = binary.LittleEndian.AppendUint64(buf, uint64(bi.Last.UnixNano()))
+	}
+	buf = binary.LittleEndian.AppendUint64(buf, uint64(b.off))
+	buf = append(buf, trailerMagic...)
+	_, err := b.w.Write(buf)
+	return err
+}
+
+func (b *BlockWriter) flush() error {
+	if b.frames == 0 {
+		return nil
+	}
+	buf := append(b.comp[:0], BlockMagic...)
+	buf = append(buf, b.codec.ID())
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(b.frames))
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(b.raw)))
+	buf = append(buf, make([]byte, 4+8+8+4)...)
+	buf, err := b.codec.Compress(buf, b.raw)
+	if err != nil {
+		return fmt.Errorf("bark: compressing block: %w", err)
+	}
+	data := buf[blockHeaderSize:]
+	if len(data) > maxBlockData {
+		return fmt.Errorf("bark: block compressed to %d bytes", len(data))
+	}
+	binary.LittleEndian.PutUint32(buf[13:17], uint32(len(data)))
+	binary.LittleEndian.PutUint64(buf[17:25], uint64(b.first))
+	binary.LittleEndian.PutUint64(buf[25:33], uint64(b.last))
+	binary.LittleEndian.PutUint32(buf[33:37], crc32.ChecksumIEEE(data))
+	b.comp = buf
+	if _, err := b.w.Write(buf); err != nil {
+		return err
+	}
+
+	b.index = append(b.index, BlockInfo{
+		Offset: b.off,
+		Frames: b.frames,
+		First:  time.Unix(0, b.first).UTC(),
+		Last:   time.Unix(0, b.last).UTC(),
+	})
+	b.off += int64(len(buf))
+	b.raw, b.frames = b.raw[:0], 0
+	return nil
+}
+
+// blockHeader is a decoded block header.
+type blockHeader struct {
+	codec   uint8
+	frames  int
+	rawLen  int
+	dataLen int
+	first   int64
+	last    int64
+	crc     uint32
+}
+
+func parseBlockHeader(p []byte) (blockHeader, error) {
+	if string(p[:4]) != BlockMagic {
+		return blockHeader{}, fmt.Errorf("%w: bad magic %q", ErrCorruptBlock, p[:4])
+	}
+	le := binary.LittleEndian
+	h := blockHeader{
+		codec:   p[4],
+		frames:  int(le.Uint32(p[5:9])),
+		rawLen:  int(le.Uint32(p[9:13])),
+		dataLen: int(le.Uint32(p[13:17])),
+		first:   int64(le.Uint64(p[17:25])),
+		last:    int64(le.Uint64(p[25:33])),
+		crc:     le.Uint32(p[33:37]),
+	}
+	if h.rawLen > maxBlockSize || h.dataLen > maxBlockData {
+		return blockHeader{}, fmt.Errorf("%w: block of %d bytes, %d compressed", ErrCorruptBlock, h.rawLen, h.dataLen)
+	}
+	return h, nil
+}
+
+// decodeBlock checks and decompresses the data of a block.
+func decodeBlock(dst []byte, h blockHeader, data []byte, codecs []Codec) ([]byte, error) {
+	if crc32.ChecksumIEEE(data) != h.crc {
+		return dst, fmt.Errorf("%w: checksum mismatch", ErrCorruptBlock)
+	}
+	c := builtinCodec(h.codec)
+	for _, extra := range codecs {
+		if extra.ID() == h.codec {
+			c = extra
+		}
+	}
+	if c == nil {
+		return dst, fmt.Errorf("bark: unknown block codec %d", h.codec)
+	}
+	n := len(dst)
+	var err error
+	if lc, ok := c.(limitedCodec); ok {
+		dst, err = lc.decompressLimit(dst, data, h.rawLen)
+	} else {
+		dst, err = c.Decompress(dst, data)
+	}
+	if err != nil {
+		return dst, fmt.Errorf("%w: %v", ErrCorruptBlock, err)
+	}
+	if len(dst)-n != h.rawLen {
+		return dst, fmt.Errorf("%w: %d bytes decompressed, want %d", ErrCorruptBlock, len(dst)-n, h.rawLen)
+	}
+	return dst, nil
+}
+
+// BlockReader reads the frames of a block stream in order, as an io.Reader
+// suitable for NewBinaryReader. It skips indexes, so concatenated streams
+// read as one.
+type BlockReader struct {
+	r      *bufio.Reader
+	codecs []Codec
+	hdr    [blockHeaderSize]byte
+	data   []byte
+	raw    []byte
+	pos    int
+}
+
+// NewBlockReader returns a reader of the stream r. Blocks written with codecs
+// other than the built-in ones need their codec among codecs.
+func NewBlockReader(r io.Reader, codecs ...Codec) *BlockReader {
+	return &BlockReader{r: bufio.NewReader(r), codecs: codecs}
+}
+
+func (b *BlockReader) Read(p []byte) (int, error) {
+	for b.pos == len(b.raw) {
+		if err := b.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, b.raw[b.pos:])
+	b.pos += n
+	return n, nil
+}
+
+// next reads and decompresses the next block.
+func (b *BlockReader) next() error {
+	for {
+		magic, err := b.r.Peek(4)
+		if err == io.EOF && len(magic) == 0 {
+			return io.EOF
+		}
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		if string(magic) != indexMagic {
+			break
+		}
+		if err := b.skipIndex(); err != nil {
+			return err
+		}
+	}
+	if _, err := io.ReadFull(b.r, b.hdr[:]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	h, err := parseBlockHeader(b.hdr[:])
+	if err != nil {
+		return err
+	}
+	b.data = growLen(b.data, h.dataLen)
+	if _, err := io.ReadFull(b.r, b.data); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	b.raw, err = decodeBlock(b.raw[:0], h, b.data, b.codecs)
+	b.pos = 0
+	return err
+}
+
+func (b *BlockReader) skipIndex() error {
+	var hdr [8]byte
+	if _, err := io.ReadFull(b.r, hdr[:]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	n := int64(binary.LittleEndian.Uint32(hdr[4:])) * indexEntrySize
+	if _, err := b.r.Discard(int(min(n+trailerSize, math.MaxInt32))); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// growLen returns b resized to n bytes, reusing its storage if it can.
+func growLen(b []byte, n int) []byte {
+	if cap(b) < n {
+		return make([]byte, n)
+	}
+	return b[:n]
+}
+
+// BlockFile gives random access to the blocks of a stream stored in a file.
+type BlockFile struct {
+	r      io.ReaderAt
+	codecs []Codec
+	blocks []BlockInfo
+}
+
+// OpenBlockFile reads the index of the size-byte stream r. If the stream has
+// no index, as when its writer was not closed, it is rebuilt from the block
+// headers.
+func OpenBlockFile(r io.ReaderAt, size int64, codecs ...Codec) (*BlockFile, error) {
+	f := &BlockFile{r: r, codecs: codecs}
+	if err := f.readIndex(size); err == nil {
+		return f, nil
+	}
+	if err := f.scan(size); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *BlockFile) readIndex(size int64) error {
+	if size < trailerSize+8 {
+		return ErrCorruptBlock
+	}
+	var tr [trailerSize]byte
+	if _, err := f.r.ReadAt(tr[:], size-trailerSize); err != nil {
+		return err
+	}
+	off := int64(binary.LittleEndian.Uint64(tr[:8]))
+	if string(tr[8:]) != trailerMagic || off < 0 || off > size-trailerSize-8 {
+		return ErrCorruptBlock
+	}
+	buf := make([]byte, size-trailerSize-off)
+	if _, err := f.r.ReadAt(buf, off); err != nil {
+		return err
+	}
+	n := int(binary.LittleEndian.Uint32(buf[4:8]))
+	if string(buf[:4]) != indexMagic || len(buf) != 8+n*indexEntrySize {
+		return ErrCorruptBlock
+	}
+	le := binary.LittleEndian
+	f.blocks = make([]BlockInfo, n)
+	for i := range f.blocks {
+		e := buf[8+i*indexEntrySize:]
+		f.blocks[i] = BlockInfo{
+			Offset: int64(le.Uint64(e[0:8])),
+			Frames: int(le.Uint32(e[8:12])),
+			First:  time.Unix(0, int64(le.Uint64(e[12:20]))).UTC(),
+			Last:   time.Unix(0, int64(le.Uint64(e[20:28]))).UTC(),
+		}
+	}
+	return nil
+}
+
+// scan rebuilds the index from the block headers, stopping at the first
+// incomplete block.
+func (f *BlockFile) scan(size int64) error {
+	var hdr [blockHeaderSize]byte
+	for off := int64(0); off+blockHeaderSize <= size; {
+		if _, err := f.r.ReadAt(hdr[:], off); err != nil {
+			return err
+		}
+		if string(hdr[:4]) == indexMagic {
+			break
+		}
+		h, err := parseBlockHeader(hdr[:])
+		if err != nil {
+			return err
+		}
+		if off+blockHeaderSize+int64(h.dataLen) > size {
+			break
+		}
+		f.blocks = append(f.blocks, BlockInfo{
+			Offset: off,
+			Frames: h.frames,
+			First:  time.Unix(0, h.first).UTC(),
+			Last:   time.Unix(0, h.last).UTC(),
+		})
+		off += blockHeaderSize + int64(h.dataLen)
+	}
+	return nil
+}
+
+// Blocks returns the blocks of the stream in order.
+func (f *BlockFile) Blocks() []BlockInfo {
+	return f.blocks
+}
+
+// ReadBlock returns the frames of block i, decompressed and checked,
+// appended to dst. Pass them to NewBinaryReader, wrapped in a bytes.Reader,
+// to decode them.
+func (f *BlockFile) ReadBlock(dst []byte, i int) ([]byte, error) {
+	if i < 0 || i >= len(f.blocks) {
+		return dst, fmt.Errorf("bark: block %d of %d", i, len(f.blocks))
+	}
+	var hdr [blockHeaderSize]byte
+	if _, err := f.r.ReadAt(hdr[:], f.blocks[i].Offset); err != nil {
+		return dst, err
+	}
+	h, err := parseBlockHeader(hdr[:])
+	if err != nil {
+		return dst, err
+	}
+	data := make([]byte, h.dataLen)
+	if _, err := f.r.ReadAt(data, f.blocks[i].Offset+blockHeaderSize); err != nil {
+		return dst, err
+	}
+	return decodeBlock(dst, h, data, f.codecs)
+}
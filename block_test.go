@@ -0,0 +1,194 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"testing"
+)
+
+// writeBlocks logs n records to a block stream and to a plain binary stream.
+func writeBlocks(t *testing.T, codec Codec, n int) (blocks, plain []byte) {
+	t.Helper()
+	var bb, pb bytes.Buffer
+	bw := NewBlockWriter(&bb, codec, 4096)
+	l := NewFanoutLogger([]Sink{
+		{Writer: bw, Format: FormatBinary},
+		{Writer: &pb, Format: FormatBinary},
+	})
+	for i := range n {
+		l.Info().Int("i", i).Str("user", "alice").Str("path", "/api/v1/items").Msg("request handled")
+	}
+	if err := bw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bb.Bytes(), pb.Bytes()
+}
+
+func TestBlockRoundTrip(t *testing.T) {
+	for _, codec := range []Codec{CodecNone, CodecFlate, CodecGzip} {
+		blocks, plain := writeBlocks(t, codec, 500)
+		if codec != CodecNone && len(blocks)*3 > len(plain) {
+			t.Errorf("codec %d: %d bytes compressed from %d", codec.ID(), len(blocks), len(plain))
+		}
+		got, err := io.ReadAll(NewBlockReader(bytes.NewReader(blocks)))
+		if err != nil {
+			t.Fatalf("codec %d: %v", codec.ID(), err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("codec %d: frames differ after a round trip", codec.ID())
+		}
+	}
+}
+
+func TestBlockFile(t *testing.T) {
+	blocks, plain := writeBlocks(t, CodecFlate, 500)
+	for name, data := range map[string][]byte{
+		"indexed":  blocks,
+		"no index": blocks[:bytes.LastIndex(blocks, []byte(indexMagic))],
+	} {
+		f, err := OpenBlockFile(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(f.Blocks()) < 2 {
+			t.Fatalf("%s: %d blocks", name, len(f.Blocks()))
+		}
+		var all []byte
+		frames := 0
+		for i, bi := range f.Blocks() {
+			if bi.Last.Before(bi.First) || (i > 0 && bi.Offset <= f.Blocks()[i-1].Offset) {
+				t.Errorf("%s: block %d = %+v", name, i, bi)
+			}
+			if all, err = f.ReadBlock(all, i); err != nil {
+				t.Fatalf("%s: block %d: %v", name, i, err)
+			}
+			frames += bi.Frames
+		}
+		if frames != 500 || !bytes.Equal(all, plain) {
+			t.Errorf("%s: %d frames, equal %v", name, frames, bytes.Equal(all, plain))
+		}
+	}
+}
+
+func TestBlockCorrupt(t *testing.T) {
+	blocks, _ := writeBlocks(t, CodecFlate, 100)
+	blocks[blockHeaderSize+10] ^= 0xFF
+	if _, err := io.ReadAll(NewBlockReader(bytes.NewReader(blocks))); !errors.Is(err, ErrCorruptBlock) {
+		t.Errorf("got %v", err)
+	}
+	f, err := OpenBlockFile(bytes.NewReader(blocks), int64(len(blocks)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.ReadBlock(nil, 0); !errors.Is(err, ErrCorruptBlock) {
+		t.Errorf("got %v", err)
+	}
+	if _, err := io.ReadAll(NewBlockReader(bytes.NewReader(blocks[:50]))); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("truncated stream: %v", err)
+	}
+}
+
+func TestBlockCorruptHeader(t *testing.T) {
+	blocks, _ := writeBlocks(t, CodecFlate, 100)
+	for name, field := range map[string]int{"raw length": 9, "data length": 13} {
+		bad := bytes.Clone(blocks)
+		binary.LittleEndian.PutUint32(bad[field:], math.MaxUint32)
+		if _, err := io.ReadAll(NewBlockReader(bytes.NewReader(bad))); !errors.Is(err, ErrCorruptBlock) {
+			t.Errorf("%s: got %v", name, err)
+		}
+		noIndex := bad[:bytes.LastIndex(bad, []byte(indexMagic))]
+		if _, err := OpenBlockFile(bytes.NewReader(noIndex), int64(len(noIndex))); !errors.Is(err, ErrCorruptBlock) {
+			t.Errorf("%s: scan got %v", name, err)
+		}
+		f, err := OpenBlockFile(bytes.NewReader(bad), int64(len(bad)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.ReadBlock(nil, 0); !errors.Is(err, ErrCorruptBlock) {
+			t.Errorf("%s: ReadBlock got %v", name, err)
+		}
+	}
+}
+
+func TestBlockInflation(t *testing.T) {
+	// A block claiming 100 bytes that inflates to 1 MiB.
+	for _, codec := range []Codec{CodecFlate, CodecGzip} {
+		block := append([]byte(BlockMagic), codec.ID(), 1, 0, 0, 0, 100, 0, 0, 0)
+		block = append(block, make([]byte, 4+8+8+4)...)
+		block, err := codec.Compress(block, make([]byte, 1<<20))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := block[blockHeaderSize:]
+		binary.LittleEndian.PutUint32(block[13:17], uint32(len(data)))
+		binary.LittleEndian.PutUint32(block[33:37], crc32.ChecksumIEEE(data))
+
+		if _, err := io.ReadAll(NewBlockReader(bytes.NewReader(block))); !errors.Is(err, ErrCorruptBlock) {
+			t.Errorf("codec %d: got %v", codec.ID(), err)
+		}
+		out, err := codec.(limitedCodec).decompressLimit(nil, data, 100)
+		if err == nil || len(out) > 101 {
+			t.Errorf("codec %d: inflated to %d bytes, error %v", codec.ID(), len(out), err)
+		}
+	}
+}
+
+// reverseCodec is a custom codec that reverses its input.
+type reverseCodec struct{}
+
+func (reverseCodec) ID() uint8 { return 200 }
+
+func (reverseCodec) Compress(dst, src []byte) ([]byte, error) {
+	for i := len(src) - 1; i >= 0; i-- {
+		dst = append(dst, src[i])
+	}
+	return dst, nil
+}
+
+func (c reverseCodec) Decompress(dst, src []byte) ([]byte, error) {
+	return c.Compress(dst, src)
+}
+
+func TestBlockCustomCodec(t *testing.T) {
+	blocks, plain := writeBlocks(t, reverseCodec{}, 50)
+	if _, err := io.ReadAll(NewBlockReader(bytes.NewReader(blocks))); err == nil {
+		t.Error("expected an error without the codec")
+	}
+	got, err := io.ReadAll(NewBlockReader(bytes.NewReader(blocks), reverseCodec{}))
+	if err != nil || !bytes.Equal(got, plain) {
+		t.Errorf("got %d bytes, %v", len(got), err)
+	}
+}
+
+func TestBlockWriterPartialFrame(t *testing.T) {
+	bw := NewBlockWriter(io.Discard, nil, 0)
+	var buf bytes.Buffer
+	NewBinaryLogger(&buf).Info().Msg("x")
+	if _, err := bw.Write(buf.Bytes()[:buf.Len()-1]); !errors.Is(err, ErrMalformed) {
+		t.Errorf("got %v", err)
+	}
+	if _, err := NewFlateCodec(42); err == nil {
+		t.Error("expected an error for a bad level")
+	}
+}
+
+func TestBinaryReaderDetectsBlocks(t *testing.T) {
+	blocks, _ := writeBlocks(t, CodecGzip, 20)
+	r := NewBinaryReader(bytes.NewReader(blocks))
+	for i := range 20 {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := rec.Get("i"); v != i {
+			t.Fatalf("record %d has i = %v", i, v)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("got %v, want EOF", err)
+	}
+}
@@ -0,0 +1,254 @@
+package bark
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Chain fields are added to the frames written through a ChainWriter.
+const (
+	// ChainKey is the last field of every chained frame, holding the SHA-256
+	// of the previous frame's hash, the frame type and the frame payload up
+	// to this field.
+	ChainKey = "_chain"
+	// CheckpointSeqKey and CheckpointSigKey are the fields of a checkpoint
+	// record, a frame of type BinTypeCheckpoint: the number of frames before
+	// it and an Ed25519 signature over that number and the hash of the frame
+	// before it.
+	CheckpointSeqKey = "_seq"
+	CheckpointSigKey = "_sig"
+)
+
+// CheckpointMessage is the message of checkpoint records.
+const CheckpointMessage = "chain checkpoint"
+
+// chainFieldSize is the encoded size of the ChainKey field.
+const chainFieldSize = 1 + len(ChainKey) + 1 + 2 + sha256.Size
+
+// checkpointDomain prefixes the signed checkpoint data so that the signature
+// cannot be mistaken for one over something else.
+const checkpointDomain = "bark chain checkpoint\x00"
+
+// ChainWriter makes a stream of binary frames tamper-evident. It adds a field
+// to each frame holding a hash over the previous frame's hash and the frame
+// itself, so changing, removing or reordering frames breaks every later
+// link. Every so many frames, and on Close, it also writes a checkpoint
+// record signed with an Ed25519 key: without the key, a stream cannot be
+// rewritten from scratch with fresh hashes either.
+//
+// Each Write must be one complete frame, as a binary Logger writes them, and
+// not of type BinTypeCheckpoint. The chain starts at the beginning of the
+// stream; use Resume to continue one.
+type ChainWriter struct {
+	w     io.Writer
+	key   ed25519.PrivateKey
+	every int
+
+	mu    sync.Mutex
+	prev  [sha256.Size]byte
+	seq   uint64 // frames written, checkpoints included
+	since int    // frames since the last checkpoint
+	buf   []byte
+}
+
+// NewChainWriter returns a ChainWriter writing to w. If key is not nil, a
+// checkpoint is written after every frames frames, or only on Close and
+// Checkpoint if every is zero.
+func NewChainWriter(w io.Writer, key ed25519.PrivateKey, every int) *ChainWriter {
+	return &ChainWriter{w: w, key: key, every: every}
+}
+
+// Resume continues a chain that already holds frames frames ending with the
+// hash last, as reported by VerifyChain for the existing stream.
+func (c *ChainWriter) Resume(last [sha256.Size]byte, frames uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prev, c.seq, c.since = last, frames, 0
+}
+
+// Write chains and writes the frame p.
+func (c *ChainWriter) Write(p []byte) (int, error) {
+	if len(p) < 14 || int(binary.LittleEndian.Uint32(p[2:6])) != len(p)-6 {
+		return 0, fmt.Errorf("%w: chained writes must be whole frames", ErrMalformed)
+	}
+	if binary.LittleEndian.Uint16(p[0:2]) == BinTypeCheckpoint {
+		return 0, errors.New("bark: only a ChainWriter writes checkpoints")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.write(p); err != nil {
+		return 0, err
+	}
+	if c.key != nil && c.every > 0 && c.since >= c.every {
+		if err := c.checkpoint(); err != nil {
+			return len(p), err
+		}
+	}
+	return len(p), nil
+}
+
+// Checkpoint writes a signed checkpoint now. It does nothing without a key.
+func (c *ChainWriter) Checkpoint() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.key == nil {
+		return nil
+	}
+	return c.checkpoint()
+}
+
+// Close writes a final checkpoint if frames were written since the last one.
+// It does not close the underlying writer.
+func (c *ChainWriter) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.key == nil || c.since == 0 {
+		return nil
+	}
+	return c.checkpoint()
+}
+
+// write appends the chain field to the frame p and writes it.
+func (c *ChainWriter) write(p []byte) error {
+	c.buf = append(c.buf[:0], p...)
+	sum := chainHash(c.prev, c.buf)
+	c.buf = binaryEncoder{}.AppendKey(c.buf, ChainKey)
+	c.buf = binaryEncoder{}.AppendHex(c.buf, sum[:])
+	c.buf = binaryEncoder{}.End(c.buf, 0)
+	if _, err := c.w.Write(c.buf); err != nil {
+		return err
+	}
+	c.prev = sum
+	c.seq++
+	c.since++
+	return nil
+}
+
+func (c *ChainWriter) checkpoint() error {
+	enc := binaryEncoder{}
+	frame := enc.Begin(nil, time.Now(), LevelInfo)
+	binary.LittleEndian.PutUint16(frame, BinTypeCheckpoint)
+	frame = enc.AppendString(enc.AppendKey(frame, "message"), CheckpointMessage)
+	frame = enc.AppendUint64(enc.AppendKey(frame, CheckpointSeqKey), c.seq)
+	sig := ed25519.Sign(c.key, checkpointData(c.seq, c.prev))
+	frame = enc.AppendHex(enc.AppendKey(frame, CheckpointSigKey), sig)
+	if err := c.write(enc.End(frame, 0)); err != nil {
+		return err
+	}
+	c.since = 0
+	return nil
+}
+
+// chainHash returns the link of frame, without its chain field, following
+// the link prev. The frame length is left out since the chain field changes
+// it.
+func chainHash(prev [sha256.Size]byte, frame []byte) [sha256.Size]byte {
+	h := sha256.New()
+	h.Write(prev[:])
+	h.Write(frame[:2])
+	h.Write(frame[6:])
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+func checkpointData(seq uint64, prev [sha256.Size]byte) []byte {
+	b := append([]byte(checkpointDomain), 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint64(b[len(checkpointDomain):], seq)
+	return append(b, prev[:]...)
+}
+
+// ChainReport describes the part of a chained stream that verified.
+type ChainReport struct {
+	Frames      uint64 // frames whose links hold, checkpoints included
+	Checkpoints int    // valid checkpoints among them
+	Signed      uint64 // frames up to and including the last valid checkpoint
+	Last        [sha256.Size]byte
+}
+
+// ChainError reports the first broken link of a stream.
+type ChainError struct {
+	Frame  uint64 // index of the frame, from 0
+	Offset int64  // byte offset of the frame, after decompression for block streams
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("bark: chain broken at frame %d (offset %d): %s", e.Frame, e.Offset, e.Reason)
+}
+
+// VerifyChain checks the links of a stream written through a ChainWriter
+// and, if pub is not nil, the signatures of its checkpoints, the frames of
+// type BinTypeCheckpoint. It stops at the first broken link, returning a
+// *ChainError along with the report of what verified before it. Frames after
+// the last checkpoint are only as safe as the chain: the report's Signed
+// tells how many are covered by a signature.
+func VerifyChain(r io.Reader, pub ed25519.PublicKey) (ChainReport, error) {
+	var rep ChainReport
+	br := NewBinaryReader(r)
+	var off int64
+	for ; ; rep.Frames++ {
+		frame, err := br.NextFrame()
+		if err == io.EOF {
+			return rep, nil
+		}
+		fail := func(format string, args ...any) (ChainReport, error) {
+			return rep, &ChainError{Frame: rep.Frames, Offset: off, Reason: fmt.Sprintf(format, args...)}
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return fail("stream ends inside a frame")
+		}
+		if err != nil {
+			return rep, err
+		}
+		if len(frame) < 14+chainFieldSize {
+			return fail("frame has no chain field")
+		}
+		body, link := frame[:len(frame)-chainFieldSize], frame[len(frame)-chainFieldSize:]
+		want := chainHash(rep.Last, body)
+		field := binaryEncoder{}.AppendHex(binaryEncoder{}.AppendKey(nil, ChainKey), want[:])
+		if !bytes.Equal(link, field) {
+			if !bytes.HasPrefix(link, field[:len(field)-sha256.Size]) {
+				return fail("frame has no chain field")
+			}
+			return fail("hash does not match the frame or the one before it")
+		}
+
+		rec, err := decodeChained(body)
+		if err != nil {
+			return fail("%v", err)
+		}
+		if rec.Type == BinTypeCheckpoint {
+			v, _ := rec.Get(CheckpointSigKey)
+			sig, ok := v.([]byte)
+			if !ok {
+				return fail("checkpoint has no signature")
+			}
+			v, _ = rec.Get(CheckpointSeqKey)
+			if seq, _ := v.(uint64); seq != rep.Frames {
+				return fail("checkpoint counts %v frames, want %d", v, rep.Frames)
+			}
+			if pub != nil && !ed25519.Verify(pub, checkpointData(rep.Frames, rep.Last), sig) {
+				return fail("checkpoint signature is not valid")
+			}
+			rep.Checkpoints++
+			rep.Signed = rep.Frames + 1
+		}
+		rep.Last = want
+		off += int64(len(frame))
+	}
+}
+
+// decodeChained decodes body, a chained frame cut before its chain field.
+func decodeChained(body []byte) (*BinaryRecord, error) {
+	b := append([]byte(nil), body...)
+	binary.LittleEndian.PutUint32(b[2:6], uint32(len(b)-6))
+	return DecodeBinary(b)
+}
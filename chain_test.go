@@ -0,0 +1,150 @@
+package bark
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func chainedLog(t *testing.T, key ed25519.PrivateKey, records int) ([]byte, [][]byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	cw := NewChainWriter(&buf, key, 3)
+	l := NewBinaryLogger(cw)
+	for i := range records {
+		l.Info().Int("i", i).Msg("audit")
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	var frames [][]byte
+	r := NewBinaryReader(bytes.NewReader(buf.Bytes()))
+	for {
+		f, err := r.NextFrame()
+		if err != nil {
+			break
+		}
+		frames = append(frames, append([]byte(nil), f...))
+	}
+	return buf.Bytes(), frames
+}
+
+func TestChainVerify(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	log, frames := chainedLog(t, priv, 7)
+	// 7 records, checkpoints after 3, 3 more (7 frames) and on Close.
+	if len(frames) != 10 {
+		t.Fatalf("got %d frames", len(frames))
+	}
+	rep, err := VerifyChain(bytes.NewReader(log), pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Frames != 10 || rep.Checkpoints != 3 || rep.Signed != 10 {
+		t.Errorf("report %+v", rep)
+	}
+
+	rec, err := DecodeBinary(frames[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Type != BinTypeCheckpoint || rec.Level() != LevelInfo || rec.Message() != CheckpointMessage {
+		t.Errorf("frame 3 = %s", rec.AppendJSON(nil))
+	}
+	if v, _ := rec.Get(CheckpointSeqKey); v != uint64(3) {
+		t.Errorf("checkpoint seq = %v", v)
+	}
+	if v, _ := rec.Get(ChainKey); len(v.([]byte)) != 32 {
+		t.Errorf("chain field = %v", v)
+	}
+}
+
+func TestChainForgedCheckpoint(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	var buf bytes.Buffer
+	cw := NewChainWriter(&buf, priv, 0)
+	l := NewBinaryLogger(cw)
+	l.Info().Uint64(CheckpointSeqKey, 7).Bytes(CheckpointSigKey, []byte("forged")).Msg(CheckpointMessage)
+	l.Info().Msg("after")
+
+	var frame bytes.Buffer
+	NewBinaryLogger(&frame).Info().Msg(CheckpointMessage)
+	binary.LittleEndian.PutUint16(frame.Bytes(), BinTypeCheckpoint)
+	if _, err := cw.Write(frame.Bytes()); err == nil {
+		t.Error("checkpoint frame written through Write")
+	}
+	if err := cw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	rep, err := VerifyChain(bytes.NewReader(buf.Bytes()), pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep.Frames != 3 || rep.Checkpoints != 1 || rep.Signed != 3 {
+		t.Errorf("report %+v", rep)
+	}
+}
+
+func TestChainBroken(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	_, frames := chainedLog(t, priv, 7)
+	join := func(fs ...[]byte) []byte { return bytes.Join(fs, nil) }
+	offset := func(n int) int64 { return int64(len(join(frames[:n]...))) }
+
+	tampered := append([]byte(nil), frames[5]...)
+	tampered[20] ^= 1
+	otherPub, _, _ := ed25519.GenerateKey(nil)
+
+	tests := []struct {
+		name  string
+		log   []byte
+		pub   ed25519.PublicKey
+		frame uint64
+	}{
+		{"changed", join(append(append(frames[:5:5], tampered), frames[6:]...)...), pub, 5},
+		{"removed", join(append(frames[:2:2], frames[3:]...)...), pub, 2},
+		{"swapped", join(frames[0], frames[2], frames[1]), pub, 1},
+		{"truncated", join(frames...)[:offset(4)+10], pub, 4},
+		{"wrong key", join(frames...), otherPub, 3},
+	}
+	for _, tt := range tests {
+		rep, err := VerifyChain(bytes.NewReader(tt.log), tt.pub)
+		var ce *ChainError
+		if !errors.As(err, &ce) {
+			t.Errorf("%s: got %v", tt.name, err)
+			continue
+		}
+		if ce.Frame != tt.frame || rep.Frames != tt.frame || ce.Offset != offset(int(tt.frame)) {
+			t.Errorf("%s: broken at frame %d offset %d, want frame %d offset %d", tt.name, ce.Frame, ce.Offset, tt.frame, offset(int(tt.frame)))
+		}
+	}
+}
+
+func TestChainResume(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	log, _ := chainedLog(t, priv, 2)
+	rep, err := VerifyChain(bytes.NewReader(log), pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := bytes.NewBuffer(append([]byte(nil), log...))
+	cw := NewChainWriter(buf, priv, 0)
+	cw.Resume(rep.Last, rep.Frames)
+	NewBinaryLogger(cw).Warn().Msg("after restart")
+	cw.Close()
+	if _, err := cw.Write([]byte("not a frame")); !errors.Is(err, ErrMalformed) {
+		t.Errorf("partial write: %v", err)
+	}
+
+	rep2, err := VerifyChain(bytes.NewReader(buf.Bytes()), pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rep2.Frames != rep.Frames+2 || rep2.Signed != rep2.Frames {
+		t.Errorf("resumed report %+v after %+v", rep2, rep)
+	}
+}
@@ -0,0 +1,98 @@
+// Command barkcat prints binary bark logs as JSON lines.
+//
+// Usage:
+//
+//	barkcat [-keyring file] [file ...]
+//
+// It reads the named files in turn, or standard input if there are none,
+// decompressing block streams written by BlockWriter. With -keyring,
+// encrypted fields whose key is in the keyring, a JSON object mapping key IDs
+// to hex-encoded AES keys, are shown decrypted; the others are shown as
+// "[ENCRYPTED:<key ID>]".
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/banditmoscow1337/bark"
+)
+
+func main() {
+	keyringPath := flag.String("keyring", "", "decrypt fields with the keys in `file`")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: barkcat [-keyring file] [file ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var keyring bark.Keyring
+	if *keyringPath != "" {
+		data, err := os.ReadFile(*keyringPath)
+		if err != nil {
+			fatal(err)
+		}
+		if keyring, err = bark.ParseKeyring(data); err != nil {
+			fatal(err)
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	if flag.NArg() == 0 {
+		if err := cat(out, os.Stdin, keyring); err != nil {
+			out.Flush()
+			fatal(err)
+		}
+		return
+	}
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			out.Flush()
+			fatal(err)
+		}
+		err = cat(out, f, keyring)
+		f.Close()
+		if err != nil {
+			out.Flush()
+			fatal(fmt.Errorf("%s: %w", path, err))
+		}
+	}
+}
+
+// cat writes each record read from r to w as a JSON line.
+func cat(w io.Writer, r io.Reader, keyring bark.Keyring) error {
+	br := bark.NewBinaryReader(r)
+	br.Keyring = keyring
+	var buf []byte
+	for n := 1; ; n++ {
+		rec, err := br.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if rec == nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+		if err != nil {
+			// The field stays encrypted; the rest of the record is fine.
+			fmt.Fprintf(os.Stderr, "barkcat: record %d: %v\n", n, err)
+		}
+		buf = append(rec.AppendJSON(buf[:0]), '\n')
+		if _, err := w.Write(buf); err != nil {
+			return err
+		}
+	}
+}
+
+func fatal(err error) {
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		err = fmt.Errorf("%w: log ends inside a record", err)
+	}
+	fmt.Fprintf(os.Stderr, "barkcat: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,482 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/banditmoscow1337/bark"
+)
+
+// A filter is a boolean expression over the records of a log:
+//
+//	expr  = and { ("or" | "||") and }
+//	and   = unary { ("and" | "&&") unary }
+//	unary = ("not" | "!") unary | "(" expr ")" | field [ op value ]
+//	op    = "=" | "==" | "!=" | "<" | "<=" | ">" | ">=" | "~" | "!~" | "contains"
+//
+// The field level compares by severity, time by the record timestamp and msg
+// by the message; any other name is a record key, and a quoted name always
+// is. A field alone tests that the key is present. Values are bare words or
+// quoted strings. Numbers compare as numbers and durations such as 250ms as
+// durations; a duration and a number compare in milliseconds, the way JSON
+// writes durations. Times compare as times, written in RFC 3339, as a date or relative to
+// now, such as -1h. ~ matches a regular expression. A comparison with a key
+// the record does not have is false.
+type filter interface {
+	match(r *bark.BinaryRecord) bool
+}
+
+type (
+	orFilter  []filter
+	andFilter []filter
+	notFilter struct{ f filter }
+)
+
+func (f orFilter) match(r *bark.BinaryRecord) bool {
+	for _, g := range f {
+		if g.match(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f andFilter) match(r *bark.BinaryRecord) bool {
+	for _, g := range f {
+		if !g.match(r) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f notFilter) match(r *bark.BinaryRecord) bool { return !f.f.match(r) }
+
+// allFilter matches every record, for an empty expression.
+type allFilter struct{}
+
+func (allFilter) match(*bark.BinaryRecord) bool { return true }
+
+type levelFilter struct {
+	op    string
+	level bark.Level
+}
+
+func (f levelFilter) match(r *bark.BinaryRecord) bool {
+	return compare(f.op, cmp(int(r.Level()), int(f.level)))
+}
+
+type timeFilter struct {
+	op string
+	t  time.Time
+}
+
+func (f timeFilter) match(r *bark.BinaryRecord) bool {
+	return compare(f.op, r.Time.Compare(f.t))
+}
+
+// keyFilter compares the value of the field key with val.
+type keyFilter struct {
+	key string
+	op  string
+	val string
+	re  *regexp.Regexp
+	// The value parsed as a number, duration and time, where it is one.
+	n      float64
+	isNum  bool
+	dur    time.Duration
+	isDur  bool
+	t      time.Time
+	isTime bool
+}
+
+func (f *keyFilter) match(r *bark.BinaryRecord) bool {
+	v, ok := r.Get(f.key)
+	if !ok {
+		return false
+	}
+	switch f.op {
+	case "":
+		return true
+	case "~":
+		return f.re.MatchString(valueString(v))
+	case "!~":
+		return !f.re.MatchString(valueString(v))
+	case "contains":
+		return strings.Contains(valueString(v), f.val)
+	}
+	switch v := v.(type) {
+	case time.Duration:
+		if f.isDur {
+			return compare(f.op, cmp(v, f.dur))
+		}
+		if f.isNum {
+			// A plain number counts milliseconds, as JSON writes durations.
+			return compare(f.op, cmp(float64(v)/float64(time.Millisecond), f.n))
+		}
+	case time.Time:
+		if f.isTime {
+			return compare(f.op, v.Compare(f.t))
+		}
+	}
+	if n, ok := number(v); ok && f.isNum {
+		return compare(f.op, cmp(n, f.n))
+	} else if ok && f.isDur {
+		// JSON writes durations as milliseconds by default.
+		return compare(f.op, cmp(n, float64(f.dur)/float64(time.Millisecond)))
+	}
+	return compare(f.op, strings.Compare(valueString(v), f.val))
+}
+
+func cmp[T int | float64 | time.Duration](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compare reports whether c, the result of comparing a field with a value,
+// satisfies op.
+func compare(op string, c int) bool {
+	switch op {
+	case "=", "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// number returns v as a float64 if it is a number.
+func number(v any) (float64, bool) {
+	switch v := v.(type) {
+	case int:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case uintptr:
+		return float64(v), true
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// valueString returns the text that substring and regular expression
+// matches see for v.
+func valueString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	case []byte:
+		return hex.EncodeToString(v)
+	case json.RawMessage:
+		return string(v)
+	case [16]byte:
+		s := hex.EncodeToString(v[:])
+		return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+	case fmt.Stringer:
+		return v.String()
+	case nil:
+		return "null"
+	}
+	return fmt.Sprint(v)
+}
+
+// parseTime reads a time written in RFC 3339, as a date, as "now" or as a
+// duration relative to now.
+func parseTime(s string, now time.Time) (time.Time, bool) {
+	if s == "now" {
+		return now, true
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, true
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil {
+		return now.Add(d), true
+	}
+	return time.Time{}, false
+}
+
+type token struct {
+	text   string
+	quoted bool
+}
+
+// lex splits s into words, quoted strings, parentheses and operators.
+func lex(s string) ([]token, error) {
+	var toks []token
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case isSpace(c):
+			i++
+		case c == '(' || c == ')':
+			toks = append(toks, token{text: s[i : i+1]})
+			i++
+		case c == '"' || c == '\'' || c == '`':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' && c != '`' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("unterminated string at offset %d", i)
+			}
+			text := s[i+1 : j]
+			if c == '"' {
+				var err error
+				if text, err = strconv.Unquote(s[i : j+1]); err != nil {
+					return nil, fmt.Errorf("bad string at offset %d: %v", i, err)
+				}
+			} else if c == '\'' {
+				text = strings.ReplaceAll(text, `\'`, `'`)
+			}
+			toks = append(toks, token{text: text, quoted: true})
+			i = j + 1
+		case strings.ContainsRune("=!<>~&|", rune(c)):
+			j := i + 1
+			for j < len(s) && strings.ContainsRune("=!<>~&|", rune(s[j])) {
+				j++
+			}
+			toks = append(toks, token{text: s[i:j]})
+			i = j
+		default:
+			j := i
+			for j < len(s) && !isSpace(s[j]) && !strings.ContainsRune(`()"'`+"`=!<>~&|", rune(s[j])) {
+				j++
+			}
+			toks = append(toks, token{text: s[i:j]})
+			i = j
+		}
+	}
+	return toks, nil
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+type parser struct {
+	toks []token
+	now  time.Time
+}
+
+// parseFilter compiles the expression s. Relative times are taken from now.
+func parseFilter(s string, now time.Time) (filter, error) {
+	toks, err := lex(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(toks) == 0 {
+		return allFilter{}, nil
+	}
+	p := &parser{toks: toks, now: now}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if len(p.toks) > 0 {
+		return nil, fmt.Errorf("unexpected %q", p.toks[0].text)
+	}
+	return f, nil
+}
+
+// accept consumes the next token if it is one of words, ignoring case.
+func (p *parser) accept(words ...string) bool {
+	if len(p.toks) == 0 || p.toks[0].quoted {
+		return false
+	}
+	for _, w := range words {
+		if strings.EqualFold(p.toks[0].text, w) {
+			p.toks = p.toks[1:]
+			return true
+		}
+	}
+	return false
+}
+
+func (p *parser) or() (filter, error) {
+	var fs orFilter
+	for {
+		f, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+		if !p.accept("or", "||") {
+			break
+		}
+	}
+	if len(fs) == 1 {
+		return fs[0], nil
+	}
+	return fs, nil
+}
+
+func (p *parser) and() (filter, error) {
+	var fs andFilter
+	for {
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+		if !p.accept("and", "&&") {
+			break
+		}
+	}
+	if len(fs) == 1 {
+		return fs[0], nil
+	}
+	return fs, nil
+}
+
+func (p *parser) unary() (filter, error) {
+	if p.accept("not", "!") {
+		f, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{f}, nil
+	}
+	if p.accept("(") {
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(")") {
+			return nil, fmt.Errorf("missing )")
+		}
+		return f, nil
+	}
+	return p.comparison()
+}
+
+var operators = []string{"=", "==", "!=", "<", "<=", ">", ">=", "~", "!~", "contains"}
+
+func (p *parser) comparison() (filter, error) {
+	if len(p.toks) == 0 {
+		return nil, fmt.Errorf("expression ends early")
+	}
+	field := p.toks[0]
+	if !field.quoted && (field.text == ")" || strings.ContainsAny(field.text[:1], "=!<>~&|") || isKeyword(field.text)) {
+		return nil, fmt.Errorf("unexpected %q", field.text)
+	}
+	p.toks = p.toks[1:]
+
+	op := ""
+	for _, o := range operators {
+		if p.accept(o) {
+			op = strings.ToLower(o)
+			break
+		}
+	}
+	var val string
+	if op != "" {
+		if len(p.toks) == 0 {
+			return nil, fmt.Errorf("%s %s: missing value", field.text, op)
+		}
+		val = p.toks[0].text
+		p.toks = p.toks[1:]
+	}
+
+	switch {
+	case field.quoted:
+	case strings.EqualFold(field.text, "level"):
+		if op == "" {
+			return allFilter{}, nil
+		}
+		l, err := bark.ParseLevel(val)
+		if err != nil || !isComparison(op) {
+			return nil, fmt.Errorf("level %s %s: want a comparison with a level", op, val)
+		}
+		return levelFilter{op, l}, nil
+	case strings.EqualFold(field.text, "time"):
+		if op == "" {
+			return allFilter{}, nil
+		}
+		t, ok := parseTime(val, p.now)
+		if !ok || !isComparison(op) {
+			return nil, fmt.Errorf("time %s %s: want a comparison with a time", op, val)
+		}
+		return timeFilter{op, t}, nil
+	case strings.EqualFold(field.text, "msg"), strings.EqualFold(field.text, "message"):
+		field.text = "message"
+	}
+
+	f := &keyFilter{key: field.text, op: op, val: val}
+	if op == "~" || op == "!~" {
+		re, err := regexp.Compile(val)
+		if err != nil {
+			return nil, err
+		}
+		f.re = re
+	}
+	if n, err := strconv.ParseFloat(val, 64); err == nil && !math.IsNaN(n) {
+		f.n, f.isNum = n, true
+	}
+	if d, err := time.ParseDuration(val); err == nil {
+		f.dur, f.isDur = d, true
+	}
+	f.t, f.isTime = parseTime(val, p.now)
+	return f, nil
+}
+
+func isKeyword(s string) bool {
+	for _, k := range []string{"and", "or", "not", "contains"} {
+		if strings.EqualFold(s, k) {
+			return true
+		}
+	}
+	return false
+}
+
+func isComparison(op string) bool {
+	switch op {
+	case "=", "==", "!=", "<", "<=", ">", ">=":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/banditmoscow1337/bark"
+)
+
+func TestFilter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	l := bark.NewBinaryLogger(&buf)
+	l.Warn().Str("user", "alice").Int("status", 503).Dur("took", 300*time.Millisecond).
+		Error(errors.New("upstream timed out")).Msg("request failed")
+	rec, err := bark.DecodeBinary(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec.Time = now.Add(-10 * time.Minute)
+
+	for expr, want := range map[string]bool{
+		"":                                true,
+		"level >= warn":                   true,
+		"level = error":                   false,
+		"LEVEL < error AND user = alice":  true,
+		"user = bob or status >= 500":     true,
+		"user != alice || status < 500":   false,
+		"not user = bob":                  true,
+		"!(user = alice)":                 false,
+		"status = 503":                    true,
+		"status > 1e3":                    false,
+		"took > 250ms && took <= 1s":      true,
+		"took > 250 and took < 301":       true,
+		"took = 300":                      true,
+		"time > -15m":                     true,
+		"time >= '2024-05-01T11:55:00Z'":  false,
+		"time < 2024-05-02":               true,
+		`msg ~ "^request (failed|done)$"`: true,
+		`message !~ fail`:                 false,
+		`error contains "timed out"`:      true,
+		"user":                            true,
+		"retry":                           false,
+		"retry != 1":                      false,
+		`"level" = warn`:                  false,
+		"(user = bob or user = alice) and status": true,
+	} {
+		f, err := parseFilter(expr, now)
+		if err != nil {
+			t.Errorf("%q: %v", expr, err)
+			continue
+		}
+		if got := f.match(rec); got != want {
+			t.Errorf("%q = %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestFilterErrors(t *testing.T) {
+	for _, expr := range []string{
+		"level >= loud",
+		"level ~ warn",
+		"time > yesterday",
+		"user =",
+		"(user = alice",
+		"user = alice)",
+		"user = alice status",
+		`msg ~ "("`,
+		`user = "alice`,
+		"and",
+		"= 3",
+	} {
+		if _, err := parseFilter(expr, time.Now()); err == nil {
+			t.Errorf("%q: no error", expr)
+		}
+	}
+}
+
+func TestFilterJSONDurations(t *testing.T) {
+	rec, err := bark.DecodeJSON([]byte(`{"level":"info","time":1714564800,"took":1500,"message":"done"}`), bark.FieldNames{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for expr, want := range map[string]bool{
+		"took > 900ms":                true,
+		"took < 2s":                   true,
+		"took = 1500":                 true,
+		"time = 2024-05-01T12:00:00Z": true,
+	} {
+		f, err := parseFilter(expr, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := f.match(rec); got != want {
+			t.Errorf("%q = %v, want %v", expr, got, want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Command barkq prints the records of bark logs that match a filter.
+//
+// Usage:
+//
+//	barkq [-o format] [-keyring file] [-fields level,time,message] expr [file ...]
+//
+// It reads the named files in turn, or standard input if there are none, in
+// the JSON or binary format, decompressing block streams written by
+// BlockWriter. Matching records are written in the -o format: json, logfmt,
+// binary, cbor, msgpack or console. The filter is a boolean expression over
+// the level, time, message and keys of each record:
+//
+//	barkq 'level >= warn and time > -1h' app.log
+//	barkq 'status >= 500 or (msg ~ "time(d )?out" and not retry)' app.log
+//	barkq 'user = "alice" && took > 250ms' app.bin
+//
+// Comparisons are =, !=, <, <=, > and >=; ~ and !~ match a regular
+// expression and contains a substring. Numbers, durations and times compare
+// as such; times are written in RFC 3339, as a date or relative to now. A key
+// alone tests that it is present, and a comparison with a missing key is
+// false. With -keyring, fields encrypted with a key of the keyring are
+// decrypted before they are matched. Logs written with WithFieldNames need
+// -fields to name their level, time and message fields, of which binary logs
+// only use the message; an empty name keeps the default. Matches are written
+// with the same names.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/banditmoscow1337/bark"
+)
+
+func main() {
+	format := flag.String("o", "json", "write matches in `format`")
+	keyringPath := flag.String("keyring", "", "decrypt fields with the keys in `file`")
+	fields := flag.String("fields", "", "`names` of the level, time and message fields, comma-separated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: barkq [-o format] [-keyring file] [-fields level,time,message] expr [file ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("barkq: ")
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	f, err := parseFilter(flag.Arg(0), time.Now())
+	if err != nil {
+		log.Fatalf("filter: %v", err)
+	}
+	outFormat, err := bark.ParseFormat(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var keyring bark.Keyring
+	if *keyringPath != "" {
+		data, err := os.ReadFile(*keyringPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if keyring, err = bark.ParseKeyring(data); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	names, err := parseFieldNames(*fields)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	w := bark.NewRecordWriter(out, bark.WithFormat(outFormat), bark.WithFieldNames(names))
+	if flag.NArg() == 1 {
+		if err := query(w, os.Stdin, f, keyring, names); err != nil {
+			out.Flush()
+			log.Fatal(err)
+		}
+		return
+	}
+	for _, path := range flag.Args()[1:] {
+		file, err := os.Open(path)
+		if err != nil {
+			out.Flush()
+			log.Fatal(err)
+		}
+		err = query(w, file, f, keyring, names)
+		file.Close()
+		if err != nil {
+			out.Flush()
+			log.Fatalf("%s: %v", path, err)
+		}
+	}
+}
+
+// parseFieldNames reads the -fields flag.
+func parseFieldNames(s string) (bark.FieldNames, error) {
+	var n bark.FieldNames
+	if s == "" {
+		return n, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) > 3 {
+		return n, fmt.Errorf("-fields %q: want at most level,time,message", s)
+	}
+	dst := []*string{&n.Level, &n.Time, &n.Message}
+	for i, p := range parts {
+		*dst[i] = strings.TrimSpace(p)
+	}
+	return n, nil
+}
+
+// query writes the records of r that match f to w.
+func query(w *bark.RecordWriter, r io.Reader, f filter, keyring bark.Keyring, names bark.FieldNames) error {
+	lr := bark.NewLogReader(r)
+	lr.Keyring = keyring
+	lr.FieldNames = names
+	lr.OnError = func(err error) { log.Print(err) }
+	for {
+		rec, err := lr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !f.match(rec) {
+			continue
+		}
+		if err := w.WriteRecord(rec); err != nil {
+			return err
+		}
+	}
+}
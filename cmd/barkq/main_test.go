@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/banditmoscow1337/bark"
+)
+
+func TestQueryFieldNames(t *testing.T) {
+	names, err := parseFieldNames("lvl,ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names != (bark.FieldNames{Level: "lvl", Time: "ts"}) {
+		t.Errorf("parsed %+v", names)
+	}
+	if _, err := parseFieldNames("a,b,c,d"); err == nil {
+		t.Error("no error for four names")
+	}
+
+	var in, out bytes.Buffer
+	l := bark.NewLogger(&in, bark.WithFieldNames(names))
+	l.Info().Msg("skipped")
+	l.Warn().Msg("wanted")
+	f, err := parseFilter("level >= warn and time > -1h", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bark.NewRecordWriter(&out, bark.WithFieldNames(names))
+	if err := query(w, &in, f, nil, names); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); strings.Count(got, "\n") != 1 || !strings.Contains(got, `"lvl":"warn","ts":`) {
+		t.Errorf("got %q", got)
+	}
+}
@@ -0,0 +1,139 @@
+// Command barkstats reports what bark logs hold, to find noisy call sites
+// and keys logged with inconsistent types.
+//
+// Usage:
+//
+//	barkstats [-top n] [-bucket duration] [-json] [-keyring file] [-fields level,time,message] [file ...]
+//
+// It reads the named files in turn, or standard input if there are none, in
+// the JSON or binary format, decompressing block streams written by
+// BlockWriter, and reports on all of them together:
+//
+//   - the number of records per level;
+//   - the most frequent messages, with the bytes their records take;
+//   - the most frequent keys and the keys taking the most bytes, with the
+//     value types each was logged with;
+//   - the keys logged with more than one type;
+//   - a histogram of record times, in buckets of -bucket or of a width
+//     picked to suit the log.
+//
+// Value types come from the binary tags. JSON keeps fewer types, so JSON logs
+// only show strings, int64, uint64, float64, bool, null and rawjson. Sizes are
+// the bytes fields take in the log, key included. With -json, the report is
+// written as a JSON object. With -keyring, fields encrypted with a key of the
+// keyring are reported with the type of their decrypted value. Logs written
+// with WithFieldNames need -fields to name their level, time and message
+// fields, of which binary logs only use the message.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/banditmoscow1337/bark"
+)
+
+func main() {
+	top := flag.Int("top", 10, "list the `n` most frequent messages and keys")
+	bucket := flag.Duration("bucket", 0, "histogram bucket `width`, picked to suit the log if zero")
+	asJSON := flag.Bool("json", false, "write the report as JSON")
+	keyringPath := flag.String("keyring", "", "decrypt fields with the keys in `file`")
+	fields := flag.String("fields", "", "`names` of the level, time and message fields, comma-separated")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: barkstats [-top n] [-bucket duration] [-json] [-keyring file] [-fields level,time,message] [file ...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	log.SetFlags(0)
+	log.SetPrefix("barkstats: ")
+
+	names, err := parseFieldNames(*fields)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var keyring bark.Keyring
+	if *keyringPath != "" {
+		data, err := os.ReadFile(*keyringPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if keyring, err = bark.ParseKeyring(data); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	s := newStats()
+	if flag.NArg() == 0 {
+		if err := scan(s, os.Stdin, keyring, names); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, path := range flag.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		err = scan(s, f, keyring, names)
+		f.Close()
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+	}
+
+	out := bufio.NewWriter(os.Stdout)
+	defer out.Flush()
+	sum := s.summary(*top, *bucket)
+	if *asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(sum); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if err := writeText(out, sum); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseFieldNames reads the -fields flag.
+func parseFieldNames(s string) (bark.FieldNames, error) {
+	var n bark.FieldNames
+	if s == "" {
+		return n, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) > 3 {
+		return n, fmt.Errorf("-fields %q: want at most level,time,message", s)
+	}
+	dst := []*string{&n.Level, &n.Time, &n.Message}
+	for i, p := range parts {
+		*dst[i] = strings.TrimSpace(p)
+	}
+	return n, nil
+}
+
+// scan adds the records of r to s.
+func scan(s *stats, r io.Reader, keyring bark.Keyring, names bark.FieldNames) error {
+	lr := bark.NewLogReader(r)
+	lr.Keyring = keyring
+	lr.FieldNames = names
+	lr.OnError = func(err error) { log.Print(err) }
+	for {
+		rec, err := lr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.add(rec)
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/banditmoscow1337/bark"
+)
+
+// tagNames names the value types of binary fields. The long forms of strings,
+// bytes and errors are the same type as the short ones.
+var tagNames = map[uint8]string{
+	bark.BinTagString:     "string",
+	bark.BinTagStringLong: "string",
+	bark.BinTagInt:        "int",
+	bark.BinTagInt8:       "int8",
+	bark.BinTagInt16:      "int16",
+	bark.BinTagInt32:      "int32",
+	bark.BinTagInt64:      "int64",
+	bark.BinTagUint:       "uint",
+	bark.BinTagUint8:      "uint8",
+	bark.BinTagUint16:     "uint16",
+	bark.BinTagUint32:     "uint32",
+	bark.BinTagUint64:     "uint64",
+	bark.BinTagFloat32:    "float32",
+	bark.BinTagFloat64:    "float64",
+	bark.BinTagBool:       "bool",
+	bark.BinTagErr:        "error",
+	bark.BinTagErrLong:    "error",
+	bark.BinTagComplex64:  "complex64",
+	bark.BinTagComplex128: "complex128",
+	bark.BinTagUintptr:    "uintptr",
+	bark.BinTagBytes:      "bytes",
+	bark.BinTagBytesLong:  "bytes",
+	bark.BinTagTime:       "time",
+	bark.BinTagDuration:   "duration",
+	bark.BinTagAny:        "any",
+	bark.BinTagNull:       "null",
+	bark.BinTagHex:        "hex",
+	bark.BinTagIPAddr:     "ipaddr",
+	bark.BinTagIPPrefix:   "ipprefix",
+	bark.BinTagMAC:        "mac",
+	bark.BinTagUUID:       "uuid",
+	bark.BinTagRawJSON:    "rawjson",
+	bark.BinTagEncrypted:  "encrypted",
+}
+
+func tagName(tag uint8) string {
+	if name, ok := tagNames[tag]; ok {
+		return name
+	}
+	return fmt.Sprintf("tag%d", tag)
+}
+
+// resolutions are the widths timestamps are counted at, coarsened in turn
+// when a log spans too many of them.
+var resolutions = []time.Duration{time.Second, time.Minute, time.Hour, 24 * time.Hour}
+
+// maxTimeSlots bounds the number of slots timestamps are counted in.
+const maxTimeSlots = 1 << 17
+
+// bucketWidths are the histogram bucket widths picked from when none is
+// given, the smallest that gives at most maxBuckets buckets.
+var bucketWidths = []time.Duration{
+	time.Second, 5 * time.Second, 10 * time.Second, 30 * time.Second,
+	time.Minute, 5 * time.Minute, 10 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour,
+	24 * time.Hour, 7 * 24 * time.Hour,
+}
+
+const maxBuckets = 40
+
+type tally struct {
+	count int
+	size  int64
+}
+
+type keyStats struct {
+	tally
+	types map[string]int
+}
+
+// stats accumulates what a log holds.
+type stats struct {
+	records     int
+	size        int64
+	first, last time.Time
+	levels      map[bark.Level]int
+	messages    map[string]*tally
+	keys        map[string]*keyStats
+	res         int           // index in resolutions
+	slots       map[int64]int // records per slot of resolutions[res], by slot start
+}
+
+func newStats() *stats {
+	return &stats{
+		levels:   make(map[bark.Level]int),
+		messages: make(map[string]*tally),
+		keys:     make(map[string]*keyStats),
+		slots:    make(map[int64]int),
+	}
+}
+
+func (s *stats) add(r *bark.BinaryRecord) {
+	s.records++
+	s.size += int64(r.Size)
+	s.levels[r.Level()]++
+
+	msg := s.messages[r.Message()]
+	if msg == nil {
+		msg = new(tally)
+		s.messages[r.Message()] = msg
+	}
+	msg.count++
+	msg.size += int64(r.Size)
+
+	for i, f := range r.Fields {
+		k := s.keys[f.Key]
+		if k == nil {
+			k = &keyStats{types: make(map[string]int)}
+			s.keys[f.Key] = k
+		}
+		// A key repeated in a record counts once, with all its bytes.
+		if !slices.ContainsFunc(r.Fields[:i], func(g bark.BinaryField) bool { return g.Key == f.Key }) {
+			k.count++
+		}
+		if i < len(r.Sizes) {
+			k.size += int64(r.Sizes[i])
+		}
+		k.types[tagName(f.Tag)]++
+	}
+
+	if r.Time.IsZero() {
+		return
+	}
+	if s.first.IsZero() || r.Time.Before(s.first) {
+		s.first = r.Time
+	}
+	if r.Time.After(s.last) {
+		s.last = r.Time
+	}
+	s.slots[r.Time.Truncate(resolutions[s.res]).UnixNano()]++
+	if len(s.slots) > maxTimeSlots && s.res < len(resolutions)-1 {
+		s.res++
+		slots := make(map[int64]int)
+		for t, n := range s.slots {
+			slots[time.Unix(0, t).Truncate(resolutions[s.res]).UnixNano()] += n
+		}
+		s.slots = slots
+	}
+}
+
+// summary is the report on a log, as written with -json.
+type summary struct {
+	Records    int            `json:"records"`
+	Bytes      int64          `json:"bytes"`
+	First      time.Time      `json:"first,omitzero"`
+	Last       time.Time      `json:"last,omitzero"`
+	Levels     map[string]int `json:"levels"`
+	Messages   []messageCount `json:"messages"`
+	Keys       []keyCount     `json:"keys"`
+	LargestKey []keyCount     `json:"largest_keys"`
+	Conflicts  []keyCount     `json:"type_conflicts"`
+	Bucket     string         `json:"bucket,omitempty"`
+	Histogram  []bucketCount  `json:"histogram"`
+}
+
+type messageCount struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+	Bytes   int64  `json:"bytes"`
+}
+
+type keyCount struct {
+	Key   string         `json:"key"`
+	Count int            `json:"count"`
+	Bytes int64          `json:"bytes"`
+	Types map[string]int `json:"types"`
+}
+
+type bucketCount struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// summary reports the top messages and keys and the histogram of record
+// times in buckets of width, or of a width picked to suit the log if zero.
+func (s *stats) summary(top int, width time.Duration) summary {
+	sum := summary{
+		Records: s.records,
+		Bytes:   s.size,
+		First:   s.first,
+		Last:    s.last,
+		Levels:  make(map[string]int, len(s.levels)),
+	}
+	for l, n := range s.levels {
+		sum.Levels[l.String()] = n
+	}
+
+	for msg, t := range s.messages {
+		sum.Messages = append(sum.Messages, messageCount{msg, t.count, t.size})
+	}
+	slices.SortFunc(sum.Messages, func(a, b messageCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Message, b.Message))
+	})
+	sum.Messages = sum.Messages[:min(top, len(sum.Messages))]
+
+	var keys []keyCount
+	for key, k := range s.keys {
+		kc := keyCount{key, k.count, k.size, k.types}
+		keys = append(keys, kc)
+		if len(k.types) > 1 {
+			sum.Conflicts = append(sum.Conflicts, kc)
+		}
+	}
+	slices.SortFunc(keys, func(a, b keyCount) int {
+		return cmp.Or(cmp.Compare(b.Count, a.Count), cmp.Compare(a.Key, b.Key))
+	})
+	sum.Keys = keys[:min(top, len(keys))]
+	keys = slices.Clone(keys)
+	slices.SortStableFunc(keys, func(a, b keyCount) int { return cmp.Compare(b.Bytes, a.Bytes) })
+	sum.LargestKey = keys[:min(top, len(keys))]
+	slices.SortFunc(sum.Conflicts, func(a, b keyCount) int { return cmp.Compare(a.Key, b.Key) })
+
+	if len(s.slots) == 0 {
+		return sum
+	}
+	res := resolutions[s.res]
+	if width <= 0 {
+		span := s.last.Sub(s.first)
+		width = bucketWidths[len(bucketWidths)-1]
+		for _, w := range bucketWidths {
+			if w >= res && span/w < maxBuckets {
+				width = w
+				break
+			}
+		}
+	}
+	// Keep the histogram to a size worth printing.
+	width = max(width, s.last.Sub(s.first)/10000)
+	width = max(res, (width+res-1)/res*res)
+	sum.Bucket = width.String()
+	start := s.first.Truncate(width)
+	sum.Histogram = make([]bucketCount, s.last.Sub(start)/width+1)
+	for i := range sum.Histogram {
+		sum.Histogram[i].Start = start.Add(time.Duration(i) * width)
+	}
+	for t, n := range s.slots {
+		sum.Histogram[time.Unix(0, t).Sub(start)/width].Count += n
+	}
+	return sum
+}
+
+// writeText writes sum for people to read.
+func writeText(w io.Writer, sum summary) error {
+	fmt.Fprintf(w, "%d records, %s", sum.Records, formatBytes(sum.Bytes))
+	if !sum.First.IsZero() {
+		fmt.Fprintf(w, ", from %s to %s", sum.First.Format(time.RFC3339), sum.Last.Format(time.RFC3339))
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "\nlevel\trecords\tshare\n")
+	levels := slices.SortedFunc(maps.Keys(sum.Levels), func(a, b string) int {
+		la, _ := bark.ParseLevel(a)
+		lb, _ := bark.ParseLevel(b)
+		return cmp.Or(cmp.Compare(la, lb), cmp.Compare(a, b))
+	})
+	for _, l := range levels {
+		fmt.Fprintf(tw, "%s\t%d\t%s\n", l, sum.Levels[l], share(int64(sum.Levels[l]), int64(sum.Records)))
+	}
+
+	fmt.Fprintf(tw, "\nrecords\tshare\tbytes\tmessage\n")
+	for _, m := range sum.Messages {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", m.Count, share(int64(m.Count), int64(sum.Records)), formatBytes(m.Bytes), quote(m.Message))
+	}
+
+	fmt.Fprintf(tw, "\nkey\trecords\tshare\tbytes\tshare\ttypes\n")
+	for _, k := range sum.Keys {
+		writeKey(tw, k, sum)
+	}
+	fmt.Fprintf(tw, "\nlargest keys\trecords\tshare\tbytes\tshare\ttypes\n")
+	for _, k := range sum.LargestKey {
+		writeKey(tw, k, sum)
+	}
+	if len(sum.Conflicts) > 0 {
+		fmt.Fprintf(tw, "\ntype conflicts\trecords\tshare\tbytes\tshare\ttypes\n")
+		for _, k := range sum.Conflicts {
+			writeKey(tw, k, sum)
+		}
+	}
+
+	if len(sum.Histogram) > 0 {
+		most := 0
+		for _, b := range sum.Histogram {
+			most = max(most, b.Count)
+		}
+		layout := time.DateTime
+		if sum.First.Truncate(24 * time.Hour).Equal(sum.Last.Truncate(24 * time.Hour)) {
+			layout = time.TimeOnly
+		}
+		fmt.Fprintf(tw, "\n%s buckets\trecords\n", sum.Bucket)
+		for _, b := range sum.Histogram {
+			bar := strings.Repeat("#", (b.Count*50+most-1)/most)
+			fmt.Fprintf(tw, "%s\t%d\t%s\n", b.Start.Format(layout), b.Count, bar)
+		}
+	}
+	return tw.Flush()
+}
+
+func writeKey(w io.Writer, k keyCount, sum summary) {
+	types := slices.SortedFunc(maps.Keys(k.Types), func(a, b string) int {
+		return cmp.Or(cmp.Compare(k.Types[b], k.Types[a]), cmp.Compare(a, b))
+	})
+	for i, t := range types {
+		if len(types) > 1 {
+			types[i] = fmt.Sprintf("%s (%d)", t, k.Types[t])
+		}
+	}
+	fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\t%s\n", quote(k.Key), k.Count, share(int64(k.Count), int64(sum.Records)),
+		formatBytes(k.Bytes), share(k.Bytes, sum.Bytes), strings.Join(types, ", "))
+}
+
+func share(n, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(total))
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// quote quotes s if it is empty or holds control characters or quotes, and
+// shortens it to 60 runes.
+func quote(s string) string {
+	if r := []rune(s); len(r) > 60 {
+		s = string(r[:59]) + "…"
+	}
+	if s == "" || strings.ContainsFunc(s, func(r rune) bool { return r < ' ' || r == '"' || r == 0x7f }) {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
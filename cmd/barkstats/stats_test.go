@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/banditmoscow1337/bark"
+)
+
+func TestStats(t *testing.T) {
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	var buf bytes.Buffer
+	l := bark.NewBinaryLogger(&buf)
+	for i := range 30 {
+		e := l.Info().Str("user", "alice")
+		if i%10 == 9 {
+			e = e.Str("status", "bad")
+		} else {
+			e = e.Int("status", 200)
+		}
+		e.Msg("request handled")
+	}
+	l.Error().Str("user", "bob").Msg("db timed out")
+
+	s := newStats()
+	r := bark.NewBinaryReader(&buf)
+	for i := range 31 {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		rec.Time = base.Add(time.Duration(i) * time.Minute)
+		s.add(rec)
+	}
+
+	sum := s.summary(1, 0)
+	if sum.Records != 31 || sum.Levels["info"] != 30 || sum.Levels["error"] != 1 {
+		t.Errorf("records %d, levels %v", sum.Records, sum.Levels)
+	}
+	if len(sum.Messages) != 1 || sum.Messages[0].Message != "request handled" || sum.Messages[0].Count != 30 {
+		t.Errorf("messages %+v", sum.Messages)
+	}
+	if len(sum.Keys) != 1 || sum.Keys[0].Key != "message" || sum.Keys[0].Count != 31 {
+		t.Errorf("keys %+v", sum.Keys)
+	}
+	if len(sum.Conflicts) != 1 || sum.Conflicts[0].Key != "status" ||
+		sum.Conflicts[0].Types["int"] != 27 || sum.Conflicts[0].Types["string"] != 3 {
+		t.Errorf("conflicts %+v", sum.Conflicts)
+	}
+	var fields int64
+	for _, k := range s.keys {
+		fields += k.size
+	}
+	if fields != sum.Bytes-31*14 {
+		t.Errorf("fields take %d of %d bytes", fields, sum.Bytes)
+	}
+
+	if sum.Bucket != "1m0s" || len(sum.Histogram) != 31 || sum.Histogram[30].Count != 1 {
+		t.Errorf("bucket %s, %d buckets", sum.Bucket, len(sum.Histogram))
+	}
+	sum = s.summary(10, 10*time.Minute)
+	if len(sum.Histogram) != 4 || sum.Histogram[0].Count != 10 || sum.Histogram[3].Count != 1 {
+		t.Errorf("histogram %+v", sum.Histogram)
+	}
+
+	var out strings.Builder
+	if err := writeText(&out, sum); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"31 records", "request handled", "type conflicts", "int (27), string (3)", "10m0s buckets"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("report lacks %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestParseFieldNames(t *testing.T) {
+	for s, want := range map[string]bark.FieldNames{
+		"":               {},
+		"lvl, ts":        {Level: "lvl", Time: "ts"},
+		",,msg":          {Message: "msg"},
+		"lvl,ts,message": {Level: "lvl", Time: "ts", Message: "message"},
+	} {
+		if got, err := parseFieldNames(s); err != nil || got != want {
+			t.Errorf("%q: got %+v, %v", s, got, err)
+		}
+	}
+	if _, err := parseFieldNames("a,b,c,d"); err == nil {
+		t.Error("no error for four names")
+	}
+}
+
+func TestStatsCoarsens(t *testing.T) {
+	s := newStats()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := range maxTimeSlots + 10 {
+		s.add(&bark.BinaryRecord{Type: bark.BinTypeInfo, Time: base.Add(time.Duration(i) * time.Second)})
+	}
+	if resolutions[s.res] != time.Minute || len(s.slots) > maxTimeSlots {
+		t.Errorf("resolution %v with %d slots", resolutions[s.res], len(s.slots))
+	}
+	sum := s.summary(10, 0)
+	total := 0
+	for _, b := range sum.Histogram {
+		total += b.Count
+	}
+	if total != maxTimeSlots+10 || len(sum.Histogram) > maxBuckets {
+		t.Errorf("%d records in %d buckets", total, len(sum.Histogram))
+	}
+}
@@ -0,0 +1,193 @@
+package bark
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Codec compresses the blocks written by a BlockWriter. Its ID is stored in
+// each block header so that readers can pick the codec to decompress with.
+// IDs below 16 are reserved for the codecs of this package.
+type Codec interface {
+	ID() uint8
+	// Compress appends the compressed form of src to dst.
+	Compress(dst, src []byte) ([]byte, error)
+	// Decompress appends the decompressed form of src to dst. Blocks hold
+	// at most 64 MiB, so it should fail rather than produce more.
+	Decompress(dst, src []byte) ([]byte, error)
+}
+
+// limitedCodec is implemented by the built-in codecs, which decompress no
+// more than the limit given, so a corrupt block cannot inflate without end.
+type limitedCodec interface {
+	decompressLimit(dst, src []byte, limit int) ([]byte, error)
+}
+
+// Built-in codecs.
+var (
+	// CodecNone stores blocks as they are, which still gives readers the block
+	// index.
+	CodecNone Codec = noneCodec{}
+	// CodecFlate compresses blocks with DEFLATE at the default level.
+	CodecFlate Codec = newFlateCodec(flate.DefaultCompression)
+	// CodecGzip compresses blocks as gzip members, which other tools can
+	// decompress on their own.
+	CodecGzip Codec = &gzipCodec{}
+)
+
+// NewFlateCodec returns a DEFLATE codec at the given level, from
+// flate.HuffmanOnly to flate.BestCompression. Blocks it writes are read by
+// CodecFlate, whatever the level.
+func NewFlateCodec(level int) (Codec, error) {
+	if level < flate.HuffmanOnly || level > flate.BestCompression {
+		return nil, fmt.Errorf("bark: invalid flate level %d", level)
+	}
+	return newFlateCodec(level), nil
+}
+
+// builtinCodec returns the codec of this package with the given ID.
+func builtinCodec(id uint8) Codec {
+	switch id {
+	case 0:
+		return CodecNone
+	case 1:
+		return CodecFlate
+	case 2:
+		return CodecGzip
+	}
+	return nil
+}
+
+type noneCodec struct{}
+
+func (noneCodec) ID() uint8 { return 0 }
+
+func (noneCodec) Compress(dst, src []byte) ([]byte, error) {
+	return append(dst, src...), nil
+}
+
+func (noneCodec) Decompress(dst, src []byte) ([]byte, error) {
+	return append(dst, src...), nil
+}
+
+func (noneCodec) decompressLimit(dst, src []byte, limit int) ([]byte, error) {
+	if len(src) > limit {
+		return dst, errInflated
+	}
+	return append(dst, src...), nil
+}
+
+// appendWriter is an io.Writer appending to b.
+type appendWriter struct{ b []byte }
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	w.b = append(w.b, p...)
+	return len(p), nil
+}
+
+// flateCodec keeps its writers and readers in pools, since each holds
+// hundreds of kilobytes of state.
+type flateCodec struct {
+	level   int
+	writers sync.Pool
+	readers sync.Pool
+}
+
+func newFlateCodec(level int) *flateCodec {
+	c := &flateCodec{level: level}
+	c.writers.New = func() any {
+		w, _ := flate.NewWriter(nil, level)
+		return w
+	}
+	return c
+}
+
+func (*flateCodec) ID() uint8 { return 1 }
+
+func (c *flateCodec) Compress(dst, src []byte) ([]byte, error) {
+	out := &appendWriter{dst}
+	w := c.writers.Get().(*flate.Writer)
+	defer c.writers.Put(w)
+	w.Reset(out)
+	if _, err := w.Write(src); err != nil {
+		return dst, err
+	}
+	err := w.Close()
+	return out.b, err
+}
+
+func (c *flateCodec) Decompress(dst, src []byte) ([]byte, error) {
+	return c.decompressLimit(dst, src, maxBlockSize)
+}
+
+func (c *flateCodec) decompressLimit(dst, src []byte, limit int) ([]byte, error) {
+	var r io.ReadCloser
+	if v := c.readers.Get(); v != nil {
+		r = v.(io.ReadCloser)
+		r.(flate.Resetter).Reset(bytes.NewReader(src), nil)
+	} else {
+		r = flate.NewReader(bytes.NewReader(src))
+	}
+	defer c.readers.Put(r)
+	return readAll(dst, r, limit)
+}
+
+type gzipCodec struct {
+	writers sync.Pool
+	readers sync.Pool
+}
+
+func (*gzipCodec) ID() uint8 { return 2 }
+
+func (c *gzipCodec) Compress(dst, src []byte) ([]byte, error) {
+	out := &appendWriter{dst}
+	w, _ := c.writers.Get().(*gzip.Writer)
+	if w == nil {
+		w = gzip.NewWriter(out)
+	} else {
+		w.Reset(out)
+	}
+	defer c.writers.Put(w)
+	if _, err := w.Write(src); err != nil {
+		return dst, err
+	}
+	err := w.Close()
+	return out.b, err
+}
+
+func (c *gzipCodec) Decompress(dst, src []byte) ([]byte, error) {
+	return c.decompressLimit(dst, src, maxBlockSize)
+}
+
+func (c *gzipCodec) decompressLimit(dst, src []byte, limit int) ([]byte, error) {
+	r, _ := c.readers.Get().(*gzip.Reader)
+	var err error
+	if r == nil {
+		r, err = gzip.NewReader(bytes.NewReader(src))
+	} else {
+		err = r.Reset(bytes.NewReader(src))
+	}
+	if err != nil {
+		return dst, err
+	}
+	defer c.readers.Put(r)
+	return readAll(dst, r, limit)
+}
+
+var errInflated = errors.New("decompressed data exceeds the block size")
+
+// readAll appends what r yields to dst, failing if that is more than limit
+// bytes.
+func readAll(dst []byte, r io.Reader, limit int) ([]byte, error) {
+	out := &appendWriter{dst}
+	n, err := io.Copy(out, io.LimitReader(r, int64(limit)+1))
+	if err == nil && n > int64(limit) {
+		err = errInflated
+	}
+	return out.b, err
+}
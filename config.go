@@ -0,0 +1,260 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config describes a logger declaratively, so it can be loaded from a JSON
+// file with ParseConfig, from BARK_* environment variables with LoadEnv, or
+// both, and turned into a logger with Build.
+type Config struct {
+	// Format is json, logfmt, binary, cbor, msgpack or console.
+	Format Format `json:"format"`
+	// Level is the lowest level written. The zero value is info.
+	Level Level `json:"level"`
+	// Levels sets the levels of named loggers, as for Levels.Apply, e.g.
+	// "db.*=debug,http=warn".
+	Levels string `json:"levels,omitempty"`
+	// Outputs are "stdout", "stderr" or file paths, opened for appending.
+	// It defaults to stderr. Each record goes to every output.
+	Outputs []string `json:"outputs,omitempty"`
+	// Rotation applies to the file outputs.
+	Rotation RotationConfig `json:"rotation"`
+	// Sampling, if set, caps the records written per level.
+	Sampling *SamplingConfig `json:"sampling,omitempty"`
+	// FieldNames renames the level, time and message fields.
+	FieldNames FieldNames `json:"field_names"`
+	// AsyncBuffer, if positive, writes each output from its own goroutine
+	// with room for that many queued records.
+	AsyncBuffer int `json:"async_buffer,omitempty"`
+}
+
+// RotationConfig rotates file outputs once they reach MaxSizeMB megabytes,
+// keeping MaxBackups old files. A zero MaxSizeMB disables rotation.
+type RotationConfig struct {
+	MaxSizeMB  int `json:"max_size_mb,omitempty"`
+	MaxBackups int `json:"max_backups,omitempty"`
+}
+
+// SamplingConfig holds the arguments of WithSampling. In JSON, Tick is a Go
+// duration string such as "1s". A zero Tick means one second.
+type SamplingConfig struct {
+	First      int           `json:"first"`
+	Thereafter int           `json:"thereafter"`
+	Tick       time.Duration `json:"tick"`
+}
+
+func (s *SamplingConfig) UnmarshalJSON(b []byte) error {
+	type plain SamplingConfig
+	v := struct {
+		*plain
+		Tick string `json:"tick"`
+	}{plain: (*plain)(s)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v.Tick == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(v.Tick)
+	if err != nil {
+		return fmt.Errorf("bark: sampling tick: %w", err)
+	}
+	s.Tick = d
+	return nil
+}
+
+func (s SamplingConfig) MarshalJSON() ([]byte, error) {
+	type plain SamplingConfig
+	return json.Marshal(struct {
+		plain
+		Tick string `json:"tick"`
+	}{plain(s), s.Tick.String()})
+}
+
+// ParseConfig decodes a JSON configuration, rejecting unknown fields so that
+// typos do not go unnoticed.
+func ParseConfig(data []byte) (Config, error) {
+	var c Config
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil {
+		return Config{}, fmt.Errorf("bark: config: %w", err)
+	}
+	return c, nil
+}
+
+// envVars maps each environment variable read by LoadEnv to the field it
+// sets.
+var envVars = []struct {
+	name string
+	set  func(c *Config, v string) error
+}{
+	{"BARK_FORMAT", func(c *Config, v string) error { return c.Format.UnmarshalText([]byte(v)) }},
+	{"BARK_LEVEL", func(c *Config, v string) error { return c.Level.UnmarshalText([]byte(v)) }},
+	{"BARK_LEVELS", func(c *Config, v string) error { c.Levels = v; return nil }},
+	{"BARK_OUTPUTS", func(c *Config, v string) error { c.Outputs = splitList(v); return nil }},
+	{"BARK_ROTATION_MAX_SIZE_MB", func(c *Config, v string) error { return setInt(&c.Rotation.MaxSizeMB, v) }},
+	{"BARK_ROTATION_MAX_BACKUPS", func(c *Config, v string) error { return setInt(&c.Rotation.MaxBackups, v) }},
+	{"BARK_SAMPLING_FIRST", func(c *Config, v string) error { return setInt(&c.sampling().First, v) }},
+	{"BARK_SAMPLING_THEREAFTER", func(c *Config, v string) error { return setInt(&c.sampling().Thereafter, v) }},
+	{"BARK_SAMPLING_TICK", func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		c.sampling().Tick = d
+		return err
+	}},
+	{"BARK_LEVEL_KEY", func(c *Config, v string) error { c.FieldNames.Level = v; return nil }},
+	{"BARK_TIME_KEY", func(c *Config, v string) error { c.FieldNames.Time = v; return nil }},
+	{"BARK_MESSAGE_KEY", func(c *Config, v string) error { c.FieldNames.Message = v; return nil }},
+	{"BARK_ASYNC_BUFFER", func(c *Config, v string) error { return setInt(&c.AsyncBuffer, v) }},
+}
+
+// LoadEnv overrides c with the BARK_* environment variables that are set:
+// BARK_FORMAT, BARK_LEVEL, BARK_LEVELS, BARK_OUTPUTS (comma-separated),
+// BARK_ROTATION_MAX_SIZE_MB, BARK_ROTATION_MAX_BACKUPS, BARK_SAMPLING_FIRST,
+// BARK_SAMPLING_THEREAFTER, BARK_SAMPLING_TICK, BARK_LEVEL_KEY,
+// BARK_TIME_KEY, BARK_MESSAGE_KEY and BARK_ASYNC_BUFFER. Loading a file
+// first and then calling LoadEnv lets the environment override the file.
+func (c *Config) LoadEnv() error {
+	for _, ev := range envVars {
+		v, ok := os.LookupEnv(ev.name)
+		if !ok {
+			continue
+		}
+		if err := ev.set(c, strings.TrimSpace(v)); err != nil {
+			return fmt.Errorf("bark: %s: %w", ev.name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Config) sampling() *SamplingConfig {
+	if c.Sampling == nil {
+		c.Sampling = new(SamplingConfig)
+	}
+	return c.Sampling
+}
+
+func setInt(dst *int, s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	*dst = n
+	return nil
+}
+
+func splitList(s string) []string {
+	var list []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// Build opens the outputs and returns a logger configured by c. Options
+// given to Build are applied after the configuration and take precedence.
+// The logger owns the outputs it opened; call its Close to flush and close
+// them.
+func (c Config) Build(opts ...Option) (*Logger, error) {
+	options := []Option{
+		WithFormat(c.Format),
+		WithLevel(c.Level),
+		WithFieldNames(c.FieldNames),
+	}
+	if c.Levels != "" {
+		levels := NewLevels(c.Level)
+		if err := levels.Apply(c.Levels); err != nil {
+			return nil, err
+		}
+		options = append(options, WithLevels(levels))
+	}
+	if s := c.Sampling; s != nil {
+		tick := s.Tick
+		if tick == 0 {
+			tick = time.Second
+		}
+		options = append(options, WithSampling(s.First, s.Thereafter, tick))
+	}
+	options = append(options, opts...)
+
+	outputs := c.Outputs
+	if len(outputs) == 0 {
+		outputs = []string{"stderr"}
+	}
+	var owned closers
+	writers := make([]io.Writer, 0, len(outputs))
+	for _, path := range outputs {
+		w, err := c.open(path, &owned)
+		if err != nil {
+			owned.Close()
+			return nil, err
+		}
+		writers = append(writers, w)
+	}
+
+	var l *Logger
+	if len(writers) == 1 {
+		l = NewLogger(writers[0], options...)
+	} else {
+		sinks := make([]Sink, len(writers))
+		for i, w := range writers {
+			sinks[i] = Sink{Writer: w, Level: LevelDebug, Format: c.Format}
+		}
+		l = NewFanoutLogger(sinks, options...)
+	}
+	l.closer = owned
+	return l, nil
+}
+
+// open returns the writer for one output, adding what must be closed to
+// owned in the order it must be closed.
+func (c *Config) open(path string, owned *closers) (io.Writer, error) {
+	var w io.Writer
+	switch path {
+	case "stdout":
+		w = os.Stdout
+	case "stderr":
+		w = os.Stderr
+	default:
+		var f io.WriteCloser
+		var err error
+		if c.Rotation.MaxSizeMB > 0 {
+			f, err = OpenRotatingFile(path, int64(c.Rotation.MaxSizeMB)<<20, c.Rotation.MaxBackups)
+		} else {
+			f, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("bark: output: %w", err)
+		}
+		defer func() { *owned = append(*owned, f) }()
+		w = f
+	}
+	if c.AsyncBuffer > 0 {
+		a := NewAsyncWriter(w, c.AsyncBuffer)
+		*owned = append(*owned, a)
+		w = a
+	}
+	return w, nil
+}
+
+// closers closes each of its elements in order.
+type closers []io.Closer
+
+func (cs closers) Close() error {
+	var errs []error
+	for _, c := range cs {
+		errs = append(errs, c.Close())
+	}
+	return errors.Join(errs...)
+}
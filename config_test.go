@@ -0,0 +1,130 @@
+package bark
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	c, err := ParseConfig([]byte(`{
+		"format": "logfmt",
+		"level": "warn",
+		"levels": "db=debug",
+		"outputs": ["stdout", "/var/log/app.log"],
+		"rotation": {"max_size_mb": 10, "max_backups": 3},
+		"sampling": {"first": 100, "thereafter": 10, "tick": "2s"},
+		"field_names": {"message": "msg"},
+		"async_buffer": 64
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Config{
+		Format:      FormatLogfmt,
+		Level:       LevelWarn,
+		Levels:      "db=debug",
+		Outputs:     []string{"stdout", "/var/log/app.log"},
+		Rotation:    RotationConfig{MaxSizeMB: 10, MaxBackups: 3},
+		Sampling:    &SamplingConfig{First: 100, Thereafter: 10, Tick: 2 * time.Second},
+		FieldNames:  FieldNames{Message: "msg"},
+		AsyncBuffer: 64,
+	}
+	got, _ := json.Marshal(c)
+	exp, _ := json.Marshal(want)
+	if string(got) != string(exp) {
+		t.Errorf("got  %s\nwant %s", got, exp)
+	}
+
+	for _, bad := range []string{
+		`{"format": "xml"}`,
+		`{"level": "loud"}`,
+		`{"sampling": {"tick": "often"}}`,
+		`{"ouputs": ["stdout"]}`,
+	} {
+		if _, err := ParseConfig([]byte(bad)); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestConfigLoadEnv(t *testing.T) {
+	t.Setenv("BARK_FORMAT", "console")
+	t.Setenv("BARK_OUTPUTS", "stdout, app.log")
+	t.Setenv("BARK_SAMPLING_TICK", "5s")
+	t.Setenv("BARK_MESSAGE_KEY", "text")
+	c := Config{Level: LevelError, Format: FormatBinary}
+	if err := c.LoadEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Format != FormatConsole || c.Level != LevelError {
+		t.Errorf("format %v, level %v", c.Format, c.Level)
+	}
+	if len(c.Outputs) != 2 || c.Outputs[1] != "app.log" {
+		t.Errorf("outputs %q", c.Outputs)
+	}
+	if c.Sampling == nil || c.Sampling.Tick != 5*time.Second || c.FieldNames.Message != "text" {
+		t.Errorf("sampling %+v, names %+v", c.Sampling, c.FieldNames)
+	}
+
+	t.Setenv("BARK_ASYNC_BUFFER", "lots")
+	if err := c.LoadEnv(); err == nil || !strings.Contains(err.Error(), "BARK_ASYNC_BUFFER") {
+		t.Errorf("expected an error naming the variable, got %v", err)
+	}
+}
+
+func TestConfigBuild(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")
+	c := Config{
+		Level:       LevelWarn,
+		Levels:      "db=debug",
+		Outputs:     []string{a, b},
+		Rotation:    RotationConfig{MaxSizeMB: 1, MaxBackups: 1},
+		FieldNames:  FieldNames{Level: "severity"},
+		AsyncBuffer: 8,
+	}
+	l, err := c.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info().Msg("hidden")
+	l.Warn().Msg("shown")
+	l.Named("db").Debug().Msg("debug for db")
+	if err := l.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{a, b} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := `{"severity":"warn",` + "\n" + `{"severity":"debug",`
+		lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+		if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"severity":"warn",`) ||
+			!strings.HasPrefix(lines[1], `{"severity":"debug",`) || !strings.Contains(lines[1], `"logger":"db"`) {
+			t.Errorf("%s: got\n%s\nwant records starting with\n%s", path, data, want)
+		}
+	}
+}
+
+func TestConfigBuildErrors(t *testing.T) {
+	if _, err := (Config{Levels: "db=loud"}).Build(); err == nil {
+		t.Error("expected an error for a bad level spec")
+	}
+	missing := filepath.Join(t.TempDir(), "no", "such", "dir", "app.log")
+	if _, err := (Config{Outputs: []string{missing}}).Build(); err == nil {
+		t.Error("expected an error for an output that cannot be opened")
+	}
+	l, err := Config{}.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Close(); err != nil {
+		t.Errorf("closing a stderr logger: %v", err)
+	}
+}
@@ -0,0 +1,240 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[31m"
+	colorGreen  = "\x1b[32m"
+	colorYellow = "\x1b[33m"
+	colorBlue   = "\x1b[34m"
+	colorCyan   = "\x1b[36m"
+	colorGray   = "\x1b[90m"
+)
+
+// ConsoleWriter renders the JSON lines written by Logger as aligned,
+// colorized text for local development:
+//
+//	12:04:05 INF user login attempt attempt=3 success=true user_id=u123
+//
+// It is meant for humans, not throughput, and allocates freely. Lines that
+// are not JSON objects are passed through unchanged.
+type ConsoleWriter struct {
+	Out io.Writer
+
+	// NoColor disables ANSI colors.
+	NoColor bool
+
+	// TimeFormat is the layout for the timestamp. It defaults to
+	// "15:04:05.000".
+	TimeFormat string
+
+	// FieldOrder lists keys printed first, in order. The remaining fields
+	// follow sorted by key.
+	FieldOrder []string
+
+	// FieldNames must match the names the logger was configured with by
+	// WithFieldNames, if any.
+	FieldNames FieldNames
+
+	mu sync.Mutex
+}
+
+// NewConsoleWriter returns a ConsoleWriter writing to w.
+func NewConsoleWriter(w io.Writer) *ConsoleWriter {
+	return &ConsoleWriter{Out: w}
+}
+
+// Write renders each complete line in p. Logger hands over one record per
+// call, so lines are never split across calls.
+func (w *ConsoleWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var out []byte
+	for line := range bytes.Lines(p) {
+		out = w.appendLine(out, line)
+	}
+	if _, err := w.Out.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteRecord renders a decoded binary record the same way as a JSON line.
+func (w *ConsoleWriter) WriteRecord(r *BinaryRecord) error {
+	line := append(r.AppendJSON(nil), '\n')
+	_, err := w.Write(line)
+	return err
+}
+
+func (w *ConsoleWriter) appendLine(dst, line []byte) []byte {
+	var rec map[string]any
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	if err := dec.Decode(&rec); err != nil {
+		return append(dst, line...)
+	}
+
+	if ts, ok := rec[w.FieldNames.time()]; ok {
+		dst = w.appendColored(dst, colorGray, w.formatTime(ts))
+		dst = append(dst, ' ')
+	}
+	level, _ := rec[w.FieldNames.level()].(string)
+	dst = w.appendColored(dst, levelColor(level), levelAbbrev(level))
+	if msg, ok := rec[w.FieldNames.message()]; ok {
+		dst = append(dst, ' ')
+		dst = w.appendColored(dst, colorBold, consoleValue(msg, false))
+	}
+
+	for _, k := range w.fieldKeys(rec) {
+		dst = append(dst, ' ')
+		color := colorCyan
+		if k == "error" {
+			color = colorRed
+		}
+		name := k
+		if hasControl(k) {
+			name = strconv.Quote(k)
+		}
+		dst = w.appendColored(dst, color, name+"=")
+		dst = append(dst, consoleValue(rec[k], true)...)
+	}
+	return append(dst, '\n')
+}
+
+// fieldKeys returns the keys to print after the message: FieldOrder first,
+// then the rest sorted.
+func (w *ConsoleWriter) fieldKeys(rec map[string]any) []string {
+	keys := make([]string, 0, len(rec))
+	for _, k := range w.FieldOrder {
+		if _, ok := rec[k]; ok && !w.isHeader(k) && !slices.Contains(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+	first := len(keys)
+	for k := range rec {
+		if !w.isHeader(k) && !slices.Contains(keys[:first], k) {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys[first:])
+	return keys
+}
+
+func (w *ConsoleWriter) isHeader(k string) bool {
+	n := w.FieldNames
+	return k == n.time() || k == n.level() || k == n.message()
+}
+
+func (w *ConsoleWriter) appendColored(dst []byte, color, s string) []byte {
+	if w.NoColor {
+		return append(dst, s...)
+	}
+	dst = append(dst, color...)
+	dst = append(dst, s...)
+	return append(dst, colorReset...)
+}
+
+// formatTime renders a timestamp written in any TimeFormat.
+func (w *ConsoleWriter) formatTime(v any) string {
+	layout := w.TimeFormat
+	if layout == "" {
+		layout = "15:04:05.000"
+	}
+	if t, ok := jsonTime(v); ok {
+		return t.Format(layout)
+	}
+	return consoleValue(v, false)
+}
+
+func levelAbbrev(level string) string {
+	switch level {
+	case "debug":
+		return "DBG"
+	case "info":
+		return "INF"
+	case "warn":
+		return "WRN"
+	case "error":
+		return "ERR"
+	case "":
+		return "???"
+	}
+	if hasControl(level) {
+		return "???"
+	}
+	return strings.ToUpper(cutString(level, 3))
+}
+
+func levelColor(level string) string {
+	switch level {
+	case "debug":
+		return colorBlue
+	case "info":
+		return colorGreen
+	case "warn":
+		return colorYellow
+	case "error":
+		return colorRed
+	}
+	return colorBold
+}
+
+// consoleValue renders a decoded JSON value. Strings are quoted when quote is
+// set and they would otherwise be ambiguous in key=value form, and always when
+// they hold control characters, so that logged input cannot start lines of
+// its own or send escape sequences to the terminal.
+func consoleValue(v any, quote bool) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		if (quote && needsQuote(v)) || hasControl(v) {
+			return strconv.Quote(v)
+		}
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err.Error()
+	}
+	return string(b)
+}
+
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r == utf8.RuneError || unicode.IsControl(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasControl reports whether s holds control characters or invalid UTF-8.
+func hasControl(s string) bool {
+	for _, r := range s {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package bark
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConsoleWriter(t *testing.T) {
+	var out bytes.Buffer
+	cw := &ConsoleWriter{Out: &out, NoColor: true, TimeFormat: time.DateTime}
+	l := NewLogger(cw)
+
+	l.Info().
+		Str("user", "u123").
+		Int("attempt", 3).
+		Str("note", "two words").
+		RawJSON("obj", []byte(`{"a":1}`)).
+		Error(errors.New("boom")).
+		Msg("user login")
+
+	got := out.String()
+	year := time.Now().Format("2006-")
+	want := ` INF user login attempt=3 error=boom note="two words" obj={"a":1} user=u123` + "\n"
+	if !strings.HasPrefix(got, year) || !strings.HasSuffix(got, want) {
+		t.Errorf("unexpected output:\n%q\nwant suffix\n%q", got, want)
+	}
+
+	out.Reset()
+	cw.FieldOrder = []string{"user", "missing"}
+	l.Info().Int("b", 1).Str("user", "u").Int("a", 2).Msg("ordered")
+	if got := out.String(); !strings.HasSuffix(got, " INF ordered user=u a=2 b=1\n") {
+		t.Errorf("field order not applied: %q", got)
+	}
+
+	out.Reset()
+	cw.Write([]byte("not json\n"))
+	if out.String() != "not json\n" {
+		t.Errorf("non-JSON line not passed through: %q", out.String())
+	}
+}
+
+func TestConsoleWriterEscapes(t *testing.T) {
+	var out bytes.Buffer
+	l := NewLogger(&ConsoleWriter{Out: &out, NoColor: true})
+
+	l.Info().Str("user", "a\x1b[2J").Str("k\nx", "v").Msg("login failed\n12:00:00.000 INF login ok \x1b[31m")
+	got := out.String()
+	want := ` INF "login failed\n12:00:00.000 INF login ok \x1b[31m" "k\nx"=v user="a\x1b[2J"` + "\n"
+	if !strings.HasSuffix(got, want) || strings.Count(got, "\n") != 1 || strings.Contains(got, "\x1b") {
+		t.Errorf("control characters not escaped:\n%q\nwant suffix\n%q", got, want)
+	}
+
+	out.Reset()
+	(&ConsoleWriter{Out: &out, NoColor: true}).Write([]byte(`{"level":"\u001b[0m","message":"x"}` + "\n"))
+	if strings.Contains(out.String(), "\x1b[0m") {
+		t.Errorf("escape sequence in level: %q", out.String())
+	}
+}
+
+func TestConsoleWriterColorAndTime(t *testing.T) {
+	var out bytes.Buffer
+	cw := NewConsoleWriter(&out)
+	cw.TimeFormat = time.RFC3339
+
+	cw.Write([]byte(`{"level":"warn","time":1700000000000,"message":"slow","error":"e"}` + "\n"))
+	got := out.String()
+	ts := time.UnixMilli(1700000000000).Format(time.RFC3339)
+	for _, sub := range []string{
+		colorGray + ts + colorReset,
+		colorYellow + "WRN" + colorReset,
+		colorBold + "slow" + colorReset,
+		colorRed + "error=" + colorReset + "e",
+	} {
+		if !strings.Contains(got, sub) {
+			t.Errorf("missing %q in output: %q", sub, got)
+		}
+	}
+}
+
+func TestConsoleWriterRecord(t *testing.T) {
+	var buf, out bytes.Buffer
+	NewBinaryLogger(&buf).Info().Int("n", 1).Msg("from binary")
+
+	rec, err := NewBinaryReader(&buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw := &ConsoleWriter{Out: &out, NoColor: true}
+	if err := cw.WriteRecord(rec); err != nil {
+		t.Fatal(err)
+	}
+	if got := out.String(); !strings.HasSuffix(got, " INF from binary n=1\n") {
+		t.Errorf("unexpected output: %q", got)
+	}
+}
@@ -0,0 +1,146 @@
+package bark
+
+import (
+	"slices"
+	"strconv"
+)
+
+// DuplicatePolicy decides what happens when a record gets a key it already
+// has.
+type DuplicatePolicy uint8
+
+const (
+	// DuplicateAllow writes every field as given.
+	DuplicateAllow DuplicatePolicy = iota
+	// DuplicateDrop keeps the first field and drops later ones.
+	DuplicateDrop
+	// DuplicateRename writes later fields as key_1, key_2 and so on.
+	DuplicateRename
+	// DuplicateOverwrite removes the earlier field so the last one wins.
+	DuplicateOverwrite
+)
+
+// WithDuplicateKeys sets the policy for repeated keys within a record. The
+// message written by Msg always wins over a field of the same name. The level
+// and time keys of the text formats and the "logger" key of named loggers
+// count as already present: a field named
+// like one is renamed, or dropped under the other policies, since the
+// logger's own key cannot be removed. Renamed keys skip names already in the
+// record. The default, DuplicateAllow, skips the bookkeeping entirely.
+func WithDuplicateKeys(p DuplicatePolicy) Option {
+	return func(o *options) {
+		o.dupKeys = p
+	}
+}
+
+type keyMark struct {
+	key    string
+	start  int
+	fields int // encoded fields, counting a trailing truncation marker
+}
+
+// keyIndex records where each field of a record starts. Fields are
+// contiguous, so a field ends where the next one starts.
+type keyIndex struct {
+	marks    []keyMark
+	reserved []string // keys the logger writes as fields of its own
+	msgKey   string   // never a rename; Msg removes fields of that name
+	drop     bool     // the field being written is a duplicate to roll back
+}
+
+// check applies p to key, which is about to be written at the end of buf. It
+// returns buf with any overwritten fields removed, the key to write, renamed
+// if need be, and the number of encoded fields removed.
+func (x *keyIndex) check(buf []byte, key string, p DuplicatePolicy) ([]byte, string, int) {
+	written := x.written(key)
+	if written || slices.Contains(x.reserved, key) {
+		switch {
+		case p == DuplicateRename:
+			for n := 1; ; n++ {
+				if name := renameKey(key, n); !x.taken(name) {
+					key = name
+					break
+				}
+			}
+		case p == DuplicateDrop, !written:
+			x.drop = true
+			return buf, key, 0
+		}
+	}
+	removed := 0
+	if p == DuplicateOverwrite {
+		buf, removed = x.remove(buf, key)
+	}
+	x.marks = append(x.marks, keyMark{key, len(buf), 1})
+	return buf, key, removed
+}
+
+// written reports whether the record has a field named key.
+func (x *keyIndex) written(key string) bool {
+	for _, m := range x.marks {
+		if m.key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// taken reports whether a field named key would clash with the record.
+func (x *keyIndex) taken(key string) bool {
+	return key == x.msgKey || x.written(key) || slices.Contains(x.reserved, key)
+}
+
+// remove deletes every field named key from buf and returns the number of
+// encoded fields removed.
+func (x *keyIndex) remove(buf []byte, key string) ([]byte, int) {
+	removed := 0
+	for i := 0; i < len(x.marks); i++ {
+		if x.marks[i].key == key {
+			removed += x.marks[i].fields
+			buf = x.removeAt(buf, i)
+			i--
+		}
+	}
+	return buf, removed
+}
+
+func (x *keyIndex) removeAt(buf []byte, i int) []byte {
+	start, end := x.marks[i].start, len(buf)
+	if i+1 < len(x.marks) {
+		end = x.marks[i+1].start
+	}
+	buf = append(buf[:start], buf[end:]...)
+	for j := i + 1; j < len(x.marks); j++ {
+		x.marks[j].start -= end - start
+	}
+	x.marks = append(x.marks[:i], x.marks[i+1:]...)
+	return buf
+}
+
+// extend counts one more encoded field, such as a truncation marker, as part
+// of the last field.
+func (x *keyIndex) extend() {
+	if n := len(x.marks); n > 0 {
+		x.marks[n-1].fields++
+	}
+}
+
+// rollback forgets the field starting at start after it was rolled back.
+func (x *keyIndex) rollback(start int) {
+	if n := len(x.marks); n > 0 && x.marks[n-1].start == start {
+		x.marks = x.marks[:n-1]
+	}
+	x.drop = false
+}
+
+func (x *keyIndex) reset(reserved []string, msgKey string) {
+	clear(x.marks)
+	x.marks = x.marks[:0]
+	x.reserved, x.msgKey = reserved, msgKey
+	x.drop = false
+}
+
+// renameKey returns key with the "_n" suffix of a renamed duplicate.
+func renameKey(key string, n int) string {
+	return key + "_" + strconv.Itoa(n)
+}
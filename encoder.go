@@ -0,0 +1,157 @@
+package bark
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Encoder turns records into bytes for a Logger. Each method appends to dst
+// and returns the extended slice, like strconv.AppendInt.
+//
+// A record is written as Begin, then AppendKey followed by exactly one value
+// method per field, then End. The message and any markers the logger adds
+// are ordinary fields. The logger may cut dst back to the start of a field to
+// remove it, so each field must be self-contained: separators belong to
+// AppendKey, not to the previous value.
+type Encoder interface {
+	// Begin starts a record of the given level timestamped t.
+	Begin(dst []byte, t time.Time, level Level) []byte
+	// End completes a record holding n fields after those written by Begin.
+	End(dst []byte, n int) []byte
+
+	AppendKey(dst []byte, key string) []byte
+
+	AppendString(dst []byte, val string) []byte
+	AppendBytes(dst []byte, val []byte) []byte
+	AppendError(dst []byte, msg string) []byte
+	AppendInt(dst []byte, val int) []byte
+	AppendInt8(dst []byte, val int8) []byte
+	AppendInt16(dst []byte, val int16) []byte
+	AppendInt32(dst []byte, val int32) []byte
+	AppendInt64(dst []byte, val int64) []byte
+	AppendUint(dst []byte, val uint) []byte
+	AppendUint8(dst []byte, val uint8) []byte
+	AppendUint16(dst []byte, val uint16) []byte
+	AppendUint32(dst []byte, val uint32) []byte
+	AppendUint64(dst []byte, val uint64) []byte
+	AppendUintptr(dst []byte, val uintptr) []byte
+	AppendFloat32(dst []byte, val float32) []byte
+	AppendFloat64(dst []byte, val float64) []byte
+	AppendComplex64(dst []byte, val complex64) []byte
+	AppendComplex128(dst []byte, val complex128) []byte
+	AppendBool(dst []byte, val bool) []byte
+	AppendTime(dst []byte, val time.Time) []byte
+	AppendDuration(dst []byte, val time.Duration) []byte
+	AppendNull(dst []byte) []byte
+	AppendHex(dst []byte, val []byte) []byte
+	// AppendIPAddr writes val. The zone of an IPv6 address is arbitrary
+	// text, so an address with one must be escaped as a string would be.
+	AppendIPAddr(dst []byte, val netip.Addr) []byte
+	AppendIPPrefix(dst []byte, val netip.Prefix) []byte
+	AppendMAC(dst []byte, val net.HardwareAddr) []byte
+	AppendUUID(dst []byte, val [16]byte) []byte
+	// AppendRawJSON writes val, a compact encoded JSON value that is not
+	// empty.
+	AppendRawJSON(dst []byte, val []byte) []byte
+	// AppendAny writes a value none of the other methods cover, such as a
+	// struct, map or slice.
+	AppendAny(dst []byte, val any) []byte
+}
+
+// Format names a built-in Encoder.
+type Format uint8
+
+const (
+	FormatJSON Format = iota
+	FormatLogfmt
+	FormatBinary
+	FormatCBOR
+	FormatMsgpack
+	// FormatConsole writes JSON through a ConsoleWriter, for humans.
+	FormatConsole
+)
+
+var formatNames = [...]string{
+	FormatJSON:    "json",
+	FormatLogfmt:  "logfmt",
+	FormatBinary:  "binary",
+	FormatCBOR:    "cbor",
+	FormatMsgpack: "msgpack",
+	FormatConsole: "console",
+}
+
+func (f Format) String() string {
+	if int(f) < len(formatNames) {
+		return formatNames[f]
+	}
+	return fmt.Sprintf("Format(%d)", f)
+}
+
+// ParseFormat returns the Format named s, as returned by Format.String. Case
+// is ignored.
+func ParseFormat(s string) (Format, error) {
+	for f, name := range formatNames {
+		if strings.EqualFold(s, name) {
+			return Format(f), nil
+		}
+	}
+	return 0, fmt.Errorf("bark: unknown format %q", s)
+}
+
+func (f Format) MarshalText() ([]byte, error) {
+	return []byte(f.String()), nil
+}
+
+func (f *Format) UnmarshalText(b []byte) error {
+	v, err := ParseFormat(string(b))
+	if err != nil {
+		return err
+	}
+	*f = v
+	return nil
+}
+
+// WithFormat selects the built-in encoder for f. It is ignored when
+// WithEncoder is also given.
+func WithFormat(f Format) Option {
+	return func(o *options) {
+		o.format = f
+	}
+}
+
+// WithEncoder makes the logger write records with enc. Logger options that
+// describe how values are written, such as WithTimeFormat, only apply to the
+// built-in encoders.
+func WithEncoder(enc Encoder) Option {
+	return func(o *options) {
+		o.encoder = enc
+	}
+}
+
+// formatWriter wraps w as format f needs, for the formats that are an
+// encoder plus a rendering step.
+func formatWriter(w io.Writer, f Format, o *options) io.Writer {
+	if f == FormatConsole {
+		return &ConsoleWriter{Out: w, FieldNames: o.names}
+	}
+	return w
+}
+
+// newEncoder returns the built-in encoder for f, configured by o.
+func newEncoder(f Format, o *options) Encoder {
+	switch f {
+	case FormatLogfmt:
+		return logfmtEncoder{o}
+	case FormatBinary:
+		return binaryEncoder{}
+	case FormatCBOR:
+		return cborEncoder{o}
+	case FormatMsgpack:
+		return msgpackEncoder{o}
+	}
+	return jsonEncoder{o}
+}
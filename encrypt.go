@@ -0,0 +1,206 @@
+package bark
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	hexenc "encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrDecrypt is returned when an encrypted value fails authentication, either
+// because it was altered or because the key with its ID is not the one it was
+// encrypted with.
+var ErrDecrypt = errors.New("bark: cannot decrypt value")
+
+const gcmNonceSize = 12
+
+// FieldCipher encrypts and decrypts field values with an AES key. The key ID
+// is stored with each value so that readers can pick the right key, and keys
+// can be rotated by starting a new ID.
+type FieldCipher struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// NewFieldCipher returns a cipher for an AES-128, AES-192 or AES-256 key of
+// 16, 24 or 32 bytes. The key ID is at most 255 bytes long.
+func NewFieldCipher(keyID string, key []byte) (*FieldCipher, error) {
+	if len(keyID) > 255 {
+		return nil, fmt.Errorf("bark: key ID of %d bytes", len(keyID))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("bark: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("bark: %w", err)
+	}
+	return &FieldCipher{id: keyID, aead: aead}, nil
+}
+
+// KeyID returns the ID stored with the values c encrypts.
+func (c *FieldCipher) KeyID() string {
+	return c.id
+}
+
+// seal appends plain, an encoded [Tag][Value], to dst as a BinTagEncrypted
+// value under a random nonce.
+func (c *FieldCipher) seal(dst, plain, key []byte) []byte {
+	dst = append(dst, BinTagEncrypted, byte(len(c.id)))
+	dst = append(dst, c.id...)
+	size := gcmNonceSize + len(plain) + c.aead.Overhead()
+	dst = binary.LittleEndian.AppendUint32(dst, uint32(size))
+	dst = slices.Grow(dst, size)
+	nonce := dst[len(dst) : len(dst)+gcmNonceSize]
+	rand.Read(nonce)
+	return c.aead.Seal(dst[:len(dst)+gcmNonceSize], nonce, plain, key)
+}
+
+// open decrypts the value of the field named key.
+func (c *FieldCipher) open(key string, v EncryptedValue) (uint8, any, error) {
+	if len(v.Data) < gcmNonceSize {
+		return 0, nil, ErrDecrypt
+	}
+	plain, err := c.aead.Open(nil, v.Data[:gcmNonceSize], v.Data[gcmNonceSize:], []byte(key))
+	if err != nil || len(plain) == 0 {
+		return 0, nil, ErrDecrypt
+	}
+	val, n, err := decodeValue(plain[0], plain[1:], 0)
+	if err != nil {
+		return 0, nil, err
+	}
+	if n != len(plain)-1 {
+		return 0, nil, fmt.Errorf("%w: %d trailing bytes in encrypted value", ErrMalformed, len(plain)-1-n)
+	}
+	return plain[0], val, nil
+}
+
+// EncryptedValue is the value of an encrypted field decoded without its key.
+// It renders as "[ENCRYPTED:<key ID>]".
+type EncryptedValue struct {
+	KeyID string
+	Data  []byte // the nonce followed by the sealed value
+}
+
+func (v EncryptedValue) String() string {
+	return "[ENCRYPTED:" + v.KeyID + "]"
+}
+
+// WithEncryption encrypts the values of the fields matching keys with c. Keys
+// match as for Redaction.Keys. Only the binary format can carry encrypted
+// values: the other formats write the "[ENCRYPTED:<key ID>]" placeholder
+// instead, so the value is never written in clear. Encrypted values have no
+// truncation marker, since their length is not shown either.
+func WithEncryption(c *FieldCipher, keys ...string) Option {
+	return func(o *options) {
+		o.crypt = &encryptor{
+			cipher:      c,
+			keys:        newKeyMatcher(keys),
+			placeholder: EncryptedValue{KeyID: c.id}.String(),
+		}
+	}
+}
+
+type encryptor struct {
+	cipher      *FieldCipher
+	keys        *keyMatcher
+	placeholder string
+}
+
+// encrypt replaces the value of the last field, which starts at e.seal, with
+// its encryption.
+func (e *Event) encrypt() {
+	x := e.l.opts.crypt
+	start := e.seal
+	e.seal = 0
+	if _, ok := e.l.enc.(binaryEncoder); !ok {
+		e.buf = e.l.enc.AppendString(e.buf[:start], x.placeholder)
+		return
+	}
+	e.alt = append(e.alt[:0], e.sealKey...)
+	e.alt = append(e.alt, e.buf[start:]...)
+	n := len(e.sealKey)
+	e.buf = x.cipher.seal(e.buf[:start], e.alt[n:], e.alt[:n])
+}
+
+// Keyring holds the ciphers for decrypting fields, by key ID.
+type Keyring map[string]*FieldCipher
+
+// NewKeyring returns a keyring holding ciphers.
+func NewKeyring(ciphers ...*FieldCipher) Keyring {
+	k := make(Keyring, len(ciphers))
+	for _, c := range ciphers {
+		k[c.id] = c
+	}
+	return k
+}
+
+// ParseKeyring reads a keyring from a JSON object mapping key IDs to
+// hex-encoded AES keys:
+//
+//	{"2024-01": "6b9d...", "2024-07": "0f3a..."}
+func ParseKeyring(data []byte) (Keyring, error) {
+	var keys map[string]string
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, fmt.Errorf("bark: keyring: %w", err)
+	}
+	k := make(Keyring, len(keys))
+	for id, s := range keys {
+		key, err := hexenc.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("bark: keyring: key %q: %w", id, err)
+		}
+		if k[id], err = NewFieldCipher(id, key); err != nil {
+			return nil, fmt.Errorf("bark: keyring: key %q: %w", id, err)
+		}
+	}
+	return k, nil
+}
+
+// Decrypt replaces the encrypted fields of r whose key ID is in k with their
+// values. Fields whose key ID is missing stay encrypted. Fields that fail to
+// decrypt also stay encrypted, and the first failure is returned after the
+// other fields have been decrypted.
+func (r *BinaryRecord) Decrypt(k Keyring) error {
+	var first error
+	for i, f := range r.Fields {
+		v, ok := f.Value.(EncryptedValue)
+		if !ok {
+			continue
+		}
+		c := k[v.KeyID]
+		if c == nil {
+			continue
+		}
+		tag, val, err := c.open(f.Key, v)
+		if err != nil {
+			if first == nil {
+				first = fmt.Errorf("key %q: %w", f.Key, err)
+			}
+			continue
+		}
+		r.Fields[i].Tag, r.Fields[i].Value = tag, val
+	}
+	return first
+}
+
+// decodeEncrypted decodes the BinTagEncrypted value at the start of p.
+func decodeEncrypted(p []byte) (EncryptedValue, int, error) {
+	if len(p) < 1 || len(p) < 1+int(p[0])+4 {
+		return EncryptedValue{}, 0, fmt.Errorf("%w: truncated encrypted value", ErrMalformed)
+	}
+	off := 1 + int(p[0])
+	id := string(p[1:off])
+	n := int(binary.LittleEndian.Uint32(p[off:]))
+	off += 4
+	if len(p) < off+n {
+		return EncryptedValue{}, 0, fmt.Errorf("%w: truncated encrypted value", ErrMalformed)
+	}
+	return EncryptedValue{KeyID: id, Data: append([]byte(nil), p[off:off+n]...)}, off + n, nil
+}
@@ -0,0 +1,160 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testCipher(t *testing.T, id string, b byte) *FieldCipher {
+	t.Helper()
+	c, err := NewFieldCipher(id, bytes.Repeat([]byte{b}, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	c := testCipher(t, "k1", 1)
+	var buf bytes.Buffer
+	l := NewBinaryLogger(&buf, WithEncryption(c, "ssn", "*email*"), WithMaxValueSize(4))
+	l.Info().
+		Str("user", "alice").
+		Str("ssn", "123-45-6789").
+		Str("Email", "a@example.com").
+		Int("ssn", 42).
+		Msg("signup")
+
+	if bytes.Contains(buf.Bytes(), []byte("example")) || bytes.Contains(buf.Bytes(), []byte("123-")) {
+		t.Fatal("plaintext found in the frame")
+	}
+	rec, err := DecodeBinary(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := rec.Fields[2].Value.(EncryptedValue); !ok || v.KeyID != "k1" {
+		t.Errorf("ssn = %#v", rec.Fields[2].Value)
+	}
+	if js := string(rec.AppendJSON(nil)); !strings.Contains(js, `"ssn":"[ENCRYPTED:k1]"`) || strings.Contains(js, "ssn_truncated") || strings.Contains(js, "Email_truncated") {
+		t.Errorf("json = %s", js)
+	}
+
+	if err := rec.Decrypt(NewKeyring(c)); err != nil {
+		t.Fatal(err)
+	}
+	want := []BinaryField{
+		{"user", BinTagString, "alic"},
+		{"user_truncated", BinTagUint64, uint64(5)},
+		{"ssn", BinTagString, "123-"},
+		{"Email", BinTagString, "a@ex"},
+		{"ssn", BinTagInt, 42},
+		{"message", BinTagString, "signup"},
+	}
+	if len(rec.Fields) != len(want) {
+		t.Fatalf("got %d fields: %+v", len(rec.Fields), rec.Fields)
+	}
+	for i, f := range want {
+		if rec.Fields[i] != f {
+			t.Errorf("field %d = %+v, want %+v", i, rec.Fields[i], f)
+		}
+	}
+}
+
+func TestEncryptionRenamedDuplicates(t *testing.T) {
+	c := testCipher(t, "k1", 1)
+	for _, f := range []Format{FormatBinary, FormatJSON} {
+		var buf bytes.Buffer
+		l := NewLogger(&buf, WithFormat(f), WithEncryption(c, "ssn"), WithDuplicateKeys(DuplicateRename))
+		l.Info().Str("ssn", "111-11-1111").Str("ssn", "222-22-2222").Msg("")
+		if bytes.Contains(buf.Bytes(), []byte("-11-")) || bytes.Contains(buf.Bytes(), []byte("-22-")) {
+			t.Fatalf("%v: plaintext found in %q", f, buf.Bytes())
+		}
+		if f == FormatJSON {
+			if !strings.Contains(buf.String(), `"ssn_1":"[ENCRYPTED:k1]"`) {
+				t.Errorf("json = %s", buf.Bytes())
+			}
+			continue
+		}
+		rec, err := DecodeBinary(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rec.Decrypt(NewKeyring(c)); err != nil {
+			t.Fatal(err)
+		}
+		if v, _ := rec.Get("ssn_1"); v != "222-22-2222" {
+			t.Errorf("ssn_1 = %#v", v)
+		}
+	}
+}
+
+func TestEncryptionWrongKey(t *testing.T) {
+	var buf bytes.Buffer
+	NewBinaryLogger(&buf, WithEncryption(testCipher(t, "k1", 1), "ssn")).Info().Str("ssn", "x").Msg("")
+
+	r := NewBinaryReader(bytes.NewReader(buf.Bytes()))
+	r.Keyring = NewKeyring(testCipher(t, "k1", 2))
+	rec, err := r.Next()
+	if !errors.Is(err, ErrDecrypt) || rec == nil {
+		t.Fatalf("got %v, %v", rec, err)
+	}
+	if v, _ := rec.Get("ssn"); v.(EncryptedValue).KeyID != "k1" {
+		t.Errorf("ssn = %#v", v)
+	}
+
+	// The key is authenticated, so a value cannot be passed off as another.
+	frame := bytes.Replace(buf.Bytes(), []byte("\x03ssn"), []byte("\x03sSn"), 1)
+	rec, err = DecodeBinary(frame)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.Decrypt(NewKeyring(testCipher(t, "k1", 1))); !errors.Is(err, ErrDecrypt) {
+		t.Errorf("renamed field decrypted: %v", err)
+	}
+}
+
+func TestEncryptionOtherFormats(t *testing.T) {
+	c := testCipher(t, "k1", 1)
+	var j, bin, lf bytes.Buffer
+	NewLogger(&j, WithEncryption(c, "ssn")).Info().Str("ssn", "123").Int("n", 1).Msg("hi")
+	l := NewFanoutLogger([]Sink{{Writer: &bin, Format: FormatBinary}, {Writer: &lf, Format: FormatLogfmt}}, WithEncryption(c, "ssn"))
+	l.Info().Str("ssn", "123").Msg("hi")
+
+	var rec map[string]any
+	if err := json.Unmarshal(j.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["ssn"] != "[ENCRYPTED:k1]" || rec["n"] != 1.0 {
+		t.Errorf("json: %s", j.String())
+	}
+	if s := lf.String(); !strings.Contains(s, "ssn=[ENCRYPTED:k1]") || strings.Contains(s, "123") {
+		t.Errorf("logfmt: %s", s)
+	}
+	r := NewBinaryReader(&bin)
+	r.Keyring = NewKeyring(c)
+	br, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := br.Get("ssn"); v != "123" {
+		t.Errorf("binary ssn = %v", v)
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	k, err := ParseKeyring([]byte(`{"a": "000102030405060708090a0b0c0d0e0f"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k["a"] == nil || k["a"].KeyID() != "a" {
+		t.Errorf("keyring = %v", k)
+	}
+	for _, bad := range []string{`{"a": "zz"}`, `{"a": "0001"}`, `[]`} {
+		if _, err := ParseKeyring([]byte(bad)); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package bark
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+)
+
+// Sink is one destination of a fan-out logger.
+type Sink struct {
+	Writer io.Writer
+	// Level is the lowest level written to the sink.
+	Level Level
+	// Format selects the built-in encoder for the sink unless Encoder is set.
+	Format  Format
+	Encoder Encoder
+	// OnError, if set, is called with the errors returned by Writer and the
+	// panics it raises, and when a record cannot be transcoded for the sink.
+	// Either way the record still goes to the other sinks.
+	OnError func(error)
+}
+
+// NewFanoutLogger returns a Logger that writes each record to every sink
+// whose level it reaches, in the sink's own format. Each record is encoded
+// once per distinct format, not once per sink, and a record no sink wants is
+// not encoded at all.
+//
+// When the sinks use more than one format, records are first encoded in the
+// binary format and transcoded for the other sinks, so size limits apply to
+// the binary encoding. Transcoding decodes the record, which costs about one
+// allocation per field and several times the work of encoding it; the binary
+// sinks and a logger with a single format pay none of this. WithFormat and
+// WithEncoder are ignored; the other options apply to every sink.
+//
+// Sinks are written one after another by the logging goroutine, so a sink
+// that blocks holds up the others and the caller. Wrap slow or remote writers
+// in an AsyncWriter to keep them from stalling the rest.
+func NewFanoutLogger(sinks []Sink, opts ...Option) *Logger {
+	l := &Logger{opts: newOptions(opts)}
+	l.fan = newFanout(sinks, &l.opts)
+	l.opts.encoder = l.fan.enc
+	l.init()
+	l.floor = l.fan.level
+	return l
+}
+
+type fanout struct {
+	enc    Encoder // encodes records before they are handed out
+	level  Level   // lowest level of any sink
+	groups []sinkGroup
+	recs   sync.Pool // of *BinaryRecord, for transcoding
+}
+
+// sinkGroup holds the sinks sharing an encoder.
+type sinkGroup struct {
+	enc    Encoder // transcodes records for the group, or nil to write them as is
+	msgKey string
+	level  Level
+	sinks  []Sink
+}
+
+func newFanout(sinks []Sink, o *options) *fanout {
+	f := &fanout{level: LevelError + 1}
+	formats := make(map[Format]int)
+	for _, s := range sinks {
+		f.level = min(f.level, s.Level)
+		enc := s.Encoder
+		if enc == nil {
+			s.Writer = formatWriter(s.Writer, s.Format, o)
+			if i, ok := formats[s.Format]; ok {
+				g := &f.groups[i]
+				g.level = min(g.level, s.Level)
+				g.sinks = append(g.sinks, s)
+				continue
+			}
+			formats[s.Format] = len(f.groups)
+			enc = newEncoder(s.Format, o)
+		}
+		f.groups = append(f.groups, sinkGroup{enc: enc, level: s.Level, sinks: []Sink{s}})
+	}
+
+	switch len(f.groups) {
+	case 0:
+		f.enc = jsonEncoder{o}
+	case 1:
+		f.enc = f.groups[0].enc
+		f.groups[0].enc = nil
+	default:
+		f.enc = binaryEncoder{}
+	}
+	for i := range f.groups {
+		g := &f.groups[i]
+		if _, ok := g.enc.(binaryEncoder); ok {
+			g.enc = nil
+		}
+		g.msgKey = messageKey(g.enc, o)
+	}
+	return f
+}
+
+// write hands rec, a complete record of the given level, to the sinks that
+// want it. buf is scratch space for transcoding and is returned for reuse.
+func (f *fanout) write(rec []byte, level Level, buf []byte) []byte {
+	for i := range f.groups {
+		g := &f.groups[i]
+		if level < g.level {
+			continue
+		}
+		p := rec
+		if g.enc != nil {
+			var err error
+			if buf, err = f.transcode(buf[:0], g, rec); err != nil {
+				g.fail(level, fmt.Errorf("bark: transcoding record: %w", err))
+				continue
+			}
+			p = buf
+		}
+		for j := range g.sinks {
+			if s := &g.sinks[j]; level >= s.Level {
+				s.write(p)
+			}
+		}
+	}
+	return buf
+}
+
+// fail reports err to the sinks of g that want records of the given level.
+func (g *sinkGroup) fail(level Level, err error) {
+	for j := range g.sinks {
+		if s := &g.sinks[j]; level >= s.Level && s.OnError != nil {
+			s.OnError(err)
+		}
+	}
+}
+
+func (s *Sink) write(p []byte) {
+	defer func() {
+		if r := recover(); r != nil && s.OnError != nil {
+			s.OnError(fmt.Errorf("bark: sink panicked: %v", r))
+		}
+	}()
+	n, err := s.Writer.Write(p)
+	if err == nil && n < len(p) {
+		err = io.ErrShortWrite
+	}
+	if err != nil && s.OnError != nil {
+		s.OnError(err)
+	}
+}
+
+// transcode re-encodes a binary frame for the sinks of g.
+func (f *fanout) transcode(dst []byte, g *sinkGroup, frame []byte) ([]byte, error) {
+	r, _ := f.recs.Get().(*BinaryRecord)
+	if r == nil {
+		r = new(BinaryRecord)
+	}
+	defer func() {
+		clear(r.Fields)
+		f.recs.Put(r)
+	}()
+	if err := decodeBinaryTo(r, frame, false); err != nil {
+		return dst, err
+	}
+	return appendRecord(dst, g.enc, g.msgKey, r), nil
+}
+
+// appendRecord encodes the decoded record r with enc, writing the message
+// under msgKey.
+func appendRecord(dst []byte, enc Encoder, msgKey string, r *BinaryRecord) []byte {
+	msg := -1
+	for i, f := range r.Fields {
+		if f.Key == "message" {
+			msg = i
+		}
+	}
+
+	dst = enc.Begin(dst, r.Time, r.Level())
+	for i, f := range r.Fields {
+		if i == msg {
+			dst = enc.AppendKey(dst, msgKey)
+		} else {
+			dst = enc.AppendKey(dst, f.Key)
+		}
+		dst = appendFieldValue(dst, enc, f)
+	}
+	return enc.End(dst, len(r.Fields))
+}
+
+// appendFieldValue writes a decoded field value the way the matching Event
+// method would.
+func appendFieldValue(dst []byte, enc Encoder, f BinaryField) []byte {
+	switch v := f.Value.(type) {
+	case nil:
+		return enc.AppendNull(dst)
+	case string:
+		if f.Tag == BinTagErr || f.Tag == BinTagErrLong {
+			return enc.AppendError(dst, v)
+		}
+		return enc.AppendString(dst, v)
+	case []byte:
+		if f.Tag == BinTagHex {
+			return enc.AppendHex(dst, v)
+		}
+		return enc.AppendBytes(dst, v)
+	case int:
+		return enc.AppendInt(dst, v)
+	case int8:
+		return enc.AppendInt8(dst, v)
+	case int16:
+		return enc.AppendInt16(dst, v)
+	case int32:
+		return enc.AppendInt32(dst, v)
+	case int64:
+		return enc.AppendInt64(dst, v)
+	case uint:
+		return enc.AppendUint(dst, v)
+	case uint8:
+		return enc.AppendUint8(dst, v)
+	case uint16:
+		return enc.AppendUint16(dst, v)
+	case uint32:
+		return enc.AppendUint32(dst, v)
+	case uint64:
+		return enc.AppendUint64(dst, v)
+	case uintptr:
+		return enc.AppendUintptr(dst, v)
+	case float32:
+		return enc.AppendFloat32(dst, v)
+	case float64:
+		return enc.AppendFloat64(dst, v)
+	case complex64:
+		return enc.AppendComplex64(dst, v)
+	case complex128:
+		return enc.AppendComplex128(dst, v)
+	case bool:
+		return enc.AppendBool(dst, v)
+	case time.Time:
+		return enc.AppendTime(dst, v)
+	case time.Duration:
+		return enc.AppendDuration(dst, v)
+	case netip.Addr:
+		return enc.AppendIPAddr(dst, v)
+	case netip.Prefix:
+		return enc.AppendIPPrefix(dst, v)
+	case net.HardwareAddr:
+		return enc.AppendMAC(dst, v)
+	case [16]byte:
+		return enc.AppendUUID(dst, v)
+	case json.RawMessage:
+		return enc.AppendRawJSON(dst, v)
+	case EncryptedValue:
+		return enc.AppendString(dst, v.String())
+	}
+	return enc.AppendAny(dst, f.Value)
+}
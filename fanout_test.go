@@ -0,0 +1,210 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+type failWriter struct {
+	err   error
+	calls int
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	w.calls++
+	if w.err == nil {
+		panic("sink is broken")
+	}
+	return 0, w.err
+}
+
+func TestFanoutLogger(t *testing.T) {
+	var file, collector bytes.Buffer
+	l := NewFanoutLogger([]Sink{
+		{Writer: &file, Level: LevelError, Format: FormatJSON},
+		{Writer: &collector, Level: LevelInfo, Format: FormatBinary},
+	}, WithLevel(LevelDebug))
+
+	if e := l.Debug(); e != nil {
+		t.Error("expected a nil event for a level no sink wants")
+	}
+	l.Info().Str("user", "u123").Msg("login")
+	l.Error().Error(errors.New("disk full")).Uint64("free", 0).Msg("write failed")
+
+	lines := strings.Split(strings.TrimSpace(file.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("file got %d records, want 1: %q", len(lines), file.String())
+	}
+	var rec map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["level"] != "error" || rec["error"] != "disk full" || rec["free"] != 0.0 || rec["message"] != "write failed" {
+		t.Errorf("unexpected file record: %v", rec)
+	}
+
+	r := NewBinaryReader(&collector)
+	for _, want := range []struct {
+		level Level
+		msg   string
+	}{{LevelInfo, "login"}, {LevelError, "write failed"}} {
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Level() != want.level || rec.Message() != want.msg {
+			t.Errorf("collector: got %v %q, want %v %q", rec.Level(), rec.Message(), want.level, want.msg)
+		}
+	}
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected only two collector records, got %v", err)
+	}
+}
+
+func TestFanoutLoggerTranscode(t *testing.T) {
+	logAll := func(l *Logger) {
+		l.Warn().
+			Str("str", "a\"b").
+			Bytes("bytes", []byte{1, 2}).
+			Int8("int8", -8).
+			Uint16("uint16", 16).
+			Float32("f32", 1.5).
+			Complex128("c", 1-2i).
+			Dur("dur", 1500*time.Microsecond).
+			Time("at", time.Date(2024, 5, 1, 12, 4, 5, 0, time.UTC)).
+			Hex("hex", []byte{0xab}).
+			IPAddr("ip", netip.MustParseAddr("10.0.0.1")).
+			IPPrefix("net", netip.MustParsePrefix("10.0.0.0/8")).
+			MACAddr("mac", net.HardwareAddr{1, 2, 3, 4, 5, 6}).
+			UUID("id", [16]byte{1}).
+			RawJSON("raw", []byte(`{"a":[1,2]}`)).
+			Any("any", map[string]int{"x": 1}).
+			Stringer("nil", nil).
+			Str("message", "field").
+			Msg("done")
+	}
+	stripTime := func(b []byte) string {
+		s := string(b)
+		i := strings.Index(s, `"time":`)
+		j := strings.Index(s[i:], ",")
+		return s[:i] + s[i+j+1:]
+	}
+
+	var direct, fanned bytes.Buffer
+	logAll(NewLogger(&direct))
+	logAll(NewFanoutLogger([]Sink{{Writer: &fanned}, {Writer: io.Discard, Format: FormatBinary}}))
+	if got, want := stripTime(fanned.Bytes()), stripTime(direct.Bytes()); got != want {
+		t.Errorf("transcoded record differs:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestFanoutLoggerSharedFormat(t *testing.T) {
+	var a, b, c bytes.Buffer
+	l := NewFanoutLogger([]Sink{
+		{Writer: &a, Format: FormatLogfmt},
+		{Writer: &b, Format: FormatLogfmt, Level: LevelWarn},
+		{Writer: &c, Format: FormatCBOR},
+	}, WithDuplicateKeys(DuplicateOverwrite))
+
+	l.Warn().Int("n", 1).Int("n", 2).Str("message", "field").Msg("hello world")
+	if a.String() != b.String() || !strings.HasSuffix(a.String(), ` n=2 msg="hello world"`+"\n") {
+		t.Errorf("logfmt sinks: %q, %q", a.String(), b.String())
+	}
+	if rec := decodeCBORRecord(t, c.Bytes()); rec["n"] != uint64(2) || rec["message"] != "hello world" || rec["level"] != "warn" || len(rec) != 4 {
+		t.Errorf("cbor sink: %v", rec)
+	}
+
+	a.Reset()
+	b.Reset()
+	l.Info().Msg("info")
+	if a.Len() == 0 || b.Len() != 0 {
+		t.Errorf("sink levels not applied: %q, %q", a.String(), b.String())
+	}
+}
+
+func TestFanoutLoggerFailingSink(t *testing.T) {
+	var good bytes.Buffer
+	var errs []error
+	onError := func(err error) { errs = append(errs, err) }
+	failing := &failWriter{err: errors.New("connection reset")}
+	panicking := &failWriter{}
+
+	l := NewFanoutLogger([]Sink{
+		{Writer: failing, OnError: onError},
+		{Writer: panicking, Format: FormatMsgpack, OnError: onError},
+		{Writer: &good},
+	})
+	l.Info().Msg("one")
+	l.Info().Msg("two")
+
+	if n := strings.Count(good.String(), "\n"); n != 2 {
+		t.Errorf("healthy sink got %d records, want 2", n)
+	}
+	if failing.calls != 2 || panicking.calls != 2 || len(errs) != 4 {
+		t.Errorf("got %d and %d calls and errors %v", failing.calls, panicking.calls, errs)
+	}
+	if !strings.Contains(errs[1].Error(), "sink is broken") {
+		t.Errorf("unexpected panic error: %v", errs[1])
+	}
+}
+
+func TestFanoutLoggerTranscodeError(t *testing.T) {
+	var errs []error
+	onError := func(err error) { errs = append(errs, err) }
+	var js, bin bytes.Buffer
+	l := NewFanoutLogger([]Sink{
+		{Writer: &js, OnError: onError},
+		{Writer: io.Discard, Format: FormatLogfmt, Level: LevelError, OnError: onError},
+		{Writer: &js, Level: LevelWarn, OnError: onError},
+		{Writer: &bin, Format: FormatBinary, OnError: onError},
+	})
+	l.fan.write([]byte("not a frame"), LevelWarn, nil)
+
+	if len(errs) != 2 || !errors.Is(errs[0], ErrMalformed) || !errors.Is(errs[1], ErrMalformed) {
+		t.Errorf("expected ErrMalformed for both JSON sinks, got %v", errs)
+	}
+	if js.Len() != 0 || bin.String() != "not a frame" {
+		t.Errorf("JSON sinks got %q, binary sink %q", js.String(), bin.String())
+	}
+}
+
+func BenchmarkFanoutLogger(b *testing.B) {
+	l := NewFanoutLogger([]Sink{
+		{Writer: io.Discard, Level: LevelError, Format: FormatJSON},
+		{Writer: io.Discard, Format: FormatBinary},
+	})
+	b.ReportAllocs()
+
+	for b.Loop() {
+		l.Info().
+			Str("key", "value").
+			Int("id", 1234).
+			Float64("pi", 3.14).
+			Bool("enabled", true).
+			Msg("benchmark")
+	}
+}
+
+func BenchmarkFanoutLoggerTranscode(b *testing.B) {
+	l := NewFanoutLogger([]Sink{
+		{Writer: io.Discard, Format: FormatJSON},
+		{Writer: io.Discard, Format: FormatBinary},
+	})
+	b.ReportAllocs()
+
+	for b.Loop() {
+		l.Info().
+			Str("key", "value").
+			Int("id", 1234).
+			Float64("pi", 3.14).
+			Bool("enabled", true).
+			Msg("benchmark")
+	}
+}
@@ -0,0 +1,83 @@
+package bark
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"sync/atomic"
+)
+
+var defaultLogger atomic.Pointer[Logger]
+
+func init() {
+	defaultLogger.Store(NewLogger(os.Stderr))
+}
+
+// Default returns the process-wide logger used by the package-level
+// functions. Until SetDefault is called it writes JSON to os.Stderr.
+func Default() *Logger {
+	return defaultLogger.Load()
+}
+
+// SetDefault makes l the process-wide logger. It is safe to call while other
+// goroutines are logging; records already started finish on the old logger.
+func SetDefault(l *Logger) {
+	if l == nil {
+		panic("bark: SetDefault called with a nil logger")
+	}
+	defaultLogger.Store(l)
+}
+
+// Debug starts a record at LevelDebug on the default logger.
+func Debug() *Event {
+	return Default().Debug()
+}
+
+// Info starts a record at LevelInfo on the default logger.
+func Info() *Event {
+	return Default().Info()
+}
+
+// Warn starts a record at LevelWarn on the default logger.
+func Warn() *Event {
+	return Default().Warn()
+}
+
+// Error starts a record at LevelError on the default logger.
+func Error() *Event {
+	return Default().Error()
+}
+
+// StdLogWriter is an io.Writer that turns each line written to it into a
+// record, for use with log.SetOutput or log.New. The standard log package
+// writes a whole entry per call, so multi-line entries stay one record.
+type StdLogWriter struct {
+	// Logger receives the records. If nil, the default logger at the time of
+	// each write is used, so SetDefault takes effect immediately.
+	Logger *Logger
+	Level  Level
+}
+
+func (w *StdLogWriter) Write(p []byte) (int, error) {
+	l := w.Logger
+	if l == nil {
+		l = Default()
+	}
+	l.newEvent(w.Level).Msg(string(bytes.TrimSuffix(p, []byte{'\n'})))
+	return len(p), nil
+}
+
+// RedirectStdLog sends the output of the standard log package to the default
+// logger as records of the given level. The log package's date and time flags
+// are cleared since records carry their own timestamp; its prefix and file
+// flags are kept in the message. The returned function restores the previous
+// output and flags.
+func RedirectStdLog(level Level) (restore func()) {
+	out, flags := log.Writer(), log.Flags()
+	log.SetOutput(&StdLogWriter{Level: level})
+	log.SetFlags(flags &^ (log.Ldate | log.Ltime | log.Lmicroseconds | log.LUTC))
+	return func() {
+		log.SetOutput(out)
+		log.SetFlags(flags)
+	}
+}
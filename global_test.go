@@ -0,0 +1,99 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// swapDefault installs l as the default logger for the duration of a test.
+func swapDefault(t *testing.T, l *Logger) {
+	t.Helper()
+	old := Default()
+	SetDefault(l)
+	t.Cleanup(func() { SetDefault(old) })
+}
+
+func TestDefaultLogger(t *testing.T) {
+	var buf bytes.Buffer
+	swapDefault(t, NewLogger(&buf, WithLevel(LevelInfo)))
+
+	Debug().Msg("hidden")
+	Info().Str("k", "v").Msg("info")
+	Warn().Msg("warn")
+	Error().Msg("error")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d records, want 3: %q", len(lines), buf.String())
+	}
+	for i, want := range []string{"info", "warn", "error"} {
+		var rec map[string]any
+		if err := json.Unmarshal([]byte(lines[i]), &rec); err != nil {
+			t.Fatal(err)
+		}
+		if rec["level"] != want || rec["message"] != want {
+			t.Errorf("record %d: %v", i, rec)
+		}
+	}
+}
+
+func TestSetDefaultConcurrent(t *testing.T) {
+	var a, b bytes.Buffer
+	la, lb := NewLogger(&a), NewLogger(&b)
+	swapDefault(t, la)
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for range 100 {
+			SetDefault(lb)
+			SetDefault(la)
+		}
+	})
+	wg.Go(func() {
+		for range 100 {
+			Default()
+		}
+	})
+	wg.Wait()
+	if Default() != la {
+		t.Error("unexpected default logger")
+	}
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	var buf bytes.Buffer
+	swapDefault(t, NewLogger(&buf))
+
+	log.SetPrefix("app: ")
+	restore := RedirectStdLog(LevelWarn)
+	log.Printf("disk %d%% full", 91)
+	restore()
+	log.SetPrefix("")
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatalf("%v: %q", err, buf.String())
+	}
+	if rec["level"] != "warn" || rec["message"] != "app: disk 91% full" {
+		t.Errorf("unexpected record: %v", rec)
+	}
+	if log.Flags() != log.LstdFlags {
+		t.Errorf("flags not restored: %d", log.Flags())
+	}
+	if _, ok := log.Writer().(*StdLogWriter); ok {
+		t.Error("output not restored")
+	}
+}
+
+func TestStdLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	std := log.New(&StdLogWriter{Logger: NewLogfmtLogger(&buf), Level: LevelError}, "", 0)
+	std.Print("first line\nsecond line")
+	if got := buf.String(); !strings.HasPrefix(got, "level=error ") || !strings.HasSuffix(got, ` msg="first line\nsecond line"`+"\n") {
+		t.Errorf("unexpected record: %q", got)
+	}
+}
@@ -0,0 +1,281 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+// A sparse index describes a plain binary log in chunks of consecutive
+// frames. It is kept in a file of its own, next to the log, as a sequence of
+// entries appended as each chunk is complete:
+//
+//	entry: [Offset uint64][Length uint32][Frames uint32][First int64][Last int64]
+//
+// Offset and Length locate the chunk in the log, and First and Last are its
+// earliest and latest frame timestamps, in Unix nanoseconds. Parts of the log
+// that no entry covers, such as the frames written after the last entry, are
+// still read, only without the help of the index.
+const sparseEntrySize = 8 + 4 + 4 + 8 + 8
+
+// IndexWriter writes binary frames to a log unchanged and keeps a sparse
+// index of them in a second writer. Each Write must be one or more complete
+// frames, as a binary Logger writes them. An index entry is written once the
+// current chunk holds chunkSize bytes of frames, on Flush and on Close.
+type IndexWriter struct {
+	w     io.Writer
+	index io.Writer
+	size  int
+
+	mu          sync.Mutex
+	off         int64 // of the next frame in the log
+	start       int64 // of the current chunk
+	frames      int
+	first, last int64
+	buf         []byte
+	closed      bool
+}
+
+// NewIndexWriter returns an IndexWriter writing frames to w and the index to
+// index. The log is offset bytes long already, as when it is opened for
+// appending: the frames before offset stay unindexed. A chunkSize of zero
+// means 64 KiB.
+func NewIndexWriter(w, index io.Writer, offset int64, chunkSize int) *IndexWriter {
+	if chunkSize <= 0 {
+		chunkSize = defaultBlockSize
+	}
+	return &IndexWriter{w: w, index: index, size: chunkSize, off: offset, start: offset}
+}
+
+func (x *IndexWriter) Write(p []byte) (int, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.closed {
+		return 0, os.ErrClosed
+	}
+	frames, first, last, err := frameSpan(p)
+	if err != nil {
+		return 0, err
+	}
+	n, err := x.w.Write(p)
+	x.off += int64(n)
+	if err != nil {
+		// The chunk no longer ends on a frame boundary: leave it unindexed.
+		x.start, x.frames = x.off, 0
+		return n, err
+	}
+	if x.frames == 0 {
+		x.first, x.last = first, last
+	}
+	x.first, x.last = min(x.first, first), max(x.last, last)
+	x.frames += frames
+	if x.off-x.start >= int64(x.size) {
+		if err := x.flush(); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Flush writes the index entry of the frames written so far.
+func (x *IndexWriter) Flush() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	return x.flush()
+}
+
+// Close writes the last index entry. It closes neither of the underlying
+// writers.
+func (x *IndexWriter) Close() error {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.closed {
+		return nil
+	}
+	x.closed = true
+	return x.flush()
+}
+
+func (x *IndexWriter) flush() error {
+	if x.frames == 0 {
+		return nil
+	}
+	le := binary.LittleEndian
+	buf := le.AppendUint64(x.buf[:0], uint64(x.start))
+	buf = le.AppendUint32(buf, uint32(x.off-x.start))
+	buf = le.AppendUint32(buf, uint32(x.frames))
+	buf = le.AppendUint64(buf, uint64(x.first))
+	buf = le.AppendUint64(buf, uint64(x.last))
+	x.buf = buf
+	x.start, x.frames = x.off, 0
+	_, err := x.index.Write(buf)
+	return err
+}
+
+// span is a part of a log read as a whole. Spans that no index entry
+// describes have known set to false and are read for any time range.
+type span struct {
+	off, size   int64
+	first, last int64
+	known       bool
+}
+
+// overlaps reports whether s may hold frames from the time range [from, to).
+func (s span) overlaps(from, to int64) bool {
+	return !s.known || (s.last >= from && s.first < to)
+}
+
+// IndexedFile gives access by time range to a plain binary log with a sparse
+// index written by an IndexWriter.
+type IndexedFile struct {
+	r      io.ReaderAt
+	spans  []span
+	blocks []BlockInfo
+}
+
+// OpenIndexedFile reads the sparse index of the size-byte log r. An entry cut
+// short at the end of the index, as when its writer died, is ignored.
+func OpenIndexedFile(r io.ReaderAt, size int64, index []byte) (*IndexedFile, error) {
+	f := &IndexedFile{r: r}
+	le := binary.LittleEndian
+	var off int64
+	for ; len(index) >= sparseEntrySize; index = index[sparseEntrySize:] {
+		s := span{
+			off:   int64(le.Uint64(index[0:8])),
+			size:  int64(le.Uint32(index[8:12])),
+			first: int64(le.Uint64(index[16:24])),
+			last:  int64(le.Uint64(index[24:32])),
+			known: true,
+		}
+		if s.off < off || s.off+s.size > size {
+			return nil, fmt.Errorf("%w: index entry at offset %d does not fit the log", ErrMalformed, s.off)
+		}
+		if s.off > off {
+			f.spans = append(f.spans, span{off: off, size: s.off - off})
+		}
+		f.spans = append(f.spans, s)
+		f.blocks = append(f.blocks, BlockInfo{
+			Offset: s.off,
+			Frames: int(le.Uint32(index[12:16])),
+			First:  time.Unix(0, s.first).UTC(),
+			Last:   time.Unix(0, s.last).UTC(),
+		})
+		off = s.off + s.size
+	}
+	if off < size {
+		f.spans = append(f.spans, span{off: off, size: size - off})
+	}
+	return f, nil
+}
+
+// Blocks returns the chunks described by the index, in order.
+func (f *IndexedFile) Blocks() []BlockInfo {
+	return f.blocks
+}
+
+// Range returns a reader of the frames whose timestamps fall in [from, to),
+// reading only the chunks that may hold some. A zero from or to leaves that
+// end of the range open.
+func (f *IndexedFile) Range(from, to time.Time) *RangeReader {
+	rr := newRangeReader(from, to)
+	for i, s := range f.spans {
+		if s.overlaps(rr.from, rr.to) {
+			rr.chunks = append(rr.chunks, i)
+		}
+	}
+	rr.open = func(i int) (io.Reader, error) {
+		return io.NewSectionReader(f.r, f.spans[i].off, f.spans[i].size), nil
+	}
+	return rr
+}
+
+// Range returns a reader of the frames whose timestamps fall in [from, to),
+// decompressing only the blocks that may hold some. A zero from or to leaves
+// that end of the range open.
+func (f *BlockFile) Range(from, to time.Time) *RangeReader {
+	rr := newRangeReader(from, to)
+	for i, b := range f.blocks {
+		s := span{first: b.First.UnixNano(), last: b.Last.UnixNano(), known: true}
+		if s.overlaps(rr.from, rr.to) {
+			rr.chunks = append(rr.chunks, i)
+		}
+	}
+	var buf []byte
+	rr.open = func(i int) (io.Reader, error) {
+		var err error
+		buf, err = f.ReadBlock(buf[:0], i)
+		return bytes.NewReader(buf), err
+	}
+	return rr
+}
+
+// RangeReader reads the frames of an indexed log that fall in a time range,
+// in the order they were written.
+type RangeReader struct {
+	// Keyring, if set, decrypts the encrypted fields of the records returned
+	// by Next.
+	Keyring Keyring
+
+	from, to int64
+	chunks   []int
+	open     func(i int) (io.Reader, error)
+	cur      *BinaryReader
+}
+
+func newRangeReader(from, to time.Time) *RangeReader {
+	rr := &RangeReader{from: math.MinInt64, to: math.MaxInt64}
+	if !from.IsZero() {
+		rr.from = from.UnixNano()
+	}
+	if !to.IsZero() {
+		rr.to = to.UnixNano()
+	}
+	return rr
+}
+
+// NextFrame returns the raw bytes of the next frame in the range, as
+// BinaryReader.NextFrame does.
+func (r *RangeReader) NextFrame() ([]byte, error) {
+	for {
+		if r.cur == nil {
+			if len(r.chunks) == 0 {
+				return nil, io.EOF
+			}
+			chunk, err := r.open(r.chunks[0])
+			r.chunks = r.chunks[1:]
+			if err != nil {
+				return nil, err
+			}
+			r.cur = NewBinaryReader(chunk)
+		}
+		frame, err := r.cur.NextFrame()
+		if err == io.EOF {
+			r.cur = nil
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if t := int64(binary.LittleEndian.Uint64(frame[6:14])); t >= r.from && t < r.to {
+			return frame, nil
+		}
+	}
+}
+
+// Next decodes the next frame in the range, as BinaryReader.Next does.
+func (r *RangeReader) Next() (*BinaryRecord, error) {
+	frame, err := r.NextFrame()
+	if err != nil {
+		return nil, err
+	}
+	rec, err := DecodeBinary(frame)
+	if err != nil || r.Keyring == nil {
+		return rec, err
+	}
+	return rec, rec.Decrypt(r.Keyring)
+}
@@ -0,0 +1,133 @@
+package bark
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+var indexBase = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// timedFrame encodes a record with field i logged i seconds after indexBase.
+func timedFrame(i int) []byte {
+	enc := binaryEncoder{}
+	b := enc.Begin(nil, indexBase.Add(time.Duration(i)*time.Second), LevelInfo)
+	b = enc.AppendString(enc.AppendKey(b, "message"), "tick")
+	b = enc.AppendInt64(enc.AppendKey(b, "i"), int64(i))
+	return enc.End(b, 0)
+}
+
+// rangeIndexes reads the records of r and returns their i fields.
+func rangeIndexes(t *testing.T, r *RangeReader) []int64 {
+	t.Helper()
+	var got []int64
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			return got
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, _ := rec.Get("i")
+		got = append(got, v.(int64))
+	}
+}
+
+func checkRange(t *testing.T, name string, got []int64, from, to int) {
+	t.Helper()
+	if len(got) != to-from {
+		t.Fatalf("%s: got %d records, want %d", name, len(got), to-from)
+	}
+	for j, v := range got {
+		if v != int64(from+j) {
+			t.Fatalf("%s: record %d has i=%d, want %d", name, j, v, from+j)
+		}
+	}
+}
+
+func TestIndexedFileRange(t *testing.T) {
+	var log, idx bytes.Buffer
+	x := NewIndexWriter(&log, &idx, 0, 512)
+	for i := range 300 {
+		if _, err := x.Write(timedFrame(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Frames written after the last index entry are still found.
+	x.Flush()
+	for i := 300; i < 310; i++ {
+		log.Write(timedFrame(i))
+	}
+
+	f, err := OpenIndexedFile(bytes.NewReader(log.Bytes()), int64(log.Len()), idx.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Blocks()) < 10 {
+		t.Fatalf("%d chunks", len(f.Blocks()))
+	}
+	at := func(i int) time.Time { return indexBase.Add(time.Duration(i) * time.Second) }
+	checkRange(t, "middle", rangeIndexes(t, f.Range(at(100), at(150))), 100, 150)
+	checkRange(t, "open start", rangeIndexes(t, f.Range(time.Time{}, at(20))), 0, 20)
+	checkRange(t, "open end", rangeIndexes(t, f.Range(at(290), time.Time{})), 290, 310)
+	checkRange(t, "empty", rangeIndexes(t, f.Range(at(400), at(500))), 0, 0)
+
+	rr := f.Range(at(100), at(101))
+	if len(rr.chunks) != 2 {
+		t.Errorf("read %d chunks for one record, want it and the unindexed tail", len(rr.chunks))
+	}
+}
+
+func TestIndexedFileAppend(t *testing.T) {
+	var log, idx bytes.Buffer
+	for i := range 50 {
+		log.Write(timedFrame(i))
+	}
+	x := NewIndexWriter(&log, &idx, int64(log.Len()), 256)
+	for i := 50; i < 100; i++ {
+		x.Write(timedFrame(i))
+	}
+	if _, err := x.Write([]byte{1, 2, 3}); !errors.Is(err, ErrMalformed) {
+		t.Errorf("partial frame: got %v", err)
+	}
+	x.Close()
+	if _, err := x.Write(timedFrame(100)); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("write after Close: got %v", err)
+	}
+
+	// A torn last entry is ignored.
+	f, err := OpenIndexedFile(bytes.NewReader(log.Bytes()), int64(log.Len()), idx.Bytes()[:idx.Len()-3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(i int) time.Time { return indexBase.Add(time.Duration(i) * time.Second) }
+	checkRange(t, "unindexed head", rangeIndexes(t, f.Range(at(10), at(20))), 10, 20)
+	checkRange(t, "indexed", rangeIndexes(t, f.Range(at(60), at(99))), 60, 99)
+
+	if _, err := OpenIndexedFile(bytes.NewReader(log.Bytes()), 100, idx.Bytes()); !errors.Is(err, ErrMalformed) {
+		t.Errorf("index past the log: got %v", err)
+	}
+}
+
+func TestBlockFileRange(t *testing.T) {
+	var buf bytes.Buffer
+	bw := NewBlockWriter(&buf, CodecFlate, 512)
+	for i := range 300 {
+		bw.Write(timedFrame(i))
+	}
+	bw.Close()
+	f, err := OpenBlockFile(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := func(i int) time.Time { return indexBase.Add(time.Duration(i) * time.Second) }
+	rr := f.Range(at(120), at(140))
+	if len(rr.chunks) >= len(f.Blocks())/2 {
+		t.Errorf("reading %d of %d blocks", len(rr.chunks), len(f.Blocks()))
+	}
+	checkRange(t, "blocks", rangeIndexes(t, rr), 120, 140)
+}
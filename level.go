@@ -0,0 +1,118 @@
+package bark
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync/atomic"
+)
+
+// Level is the severity of a record.
+type Level int8
+
+const (
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = [...]string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l >= LevelDebug && l <= LevelError {
+		return levelNames[l-LevelDebug]
+	}
+	return fmt.Sprintf("Level(%d)", l)
+}
+
+// ParseLevel returns the Level named s, as returned by Level.String. Case is
+// ignored.
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return LevelDebug + Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("bark: unknown level %q", s)
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Level) UnmarshalText(b []byte) error {
+	v, err := ParseLevel(string(b))
+	if err != nil {
+		return err
+	}
+	*l = v
+	return nil
+}
+
+// WithLevel sets the lowest level a logger writes. Records below it are not
+// encoded at all: Debug, Info, Warn and Error return a nil *Event, whose
+// methods do nothing. The default, LevelDebug, writes everything.
+func WithLevel(l Level) Option {
+	return func(o *options) {
+		o.level = l
+	}
+}
+
+// levelUnset marks a LevelVar that follows its parent.
+const levelUnset = math.MinInt32
+
+// LevelVar is a Level that can be changed while loggers are using it. Loggers
+// configured with the same LevelVar share it, so one Set changes them all.
+// The zero value is LevelInfo.
+type LevelVar struct {
+	v      atomic.Int32
+	parent atomic.Pointer[LevelVar] // followed until the level is set
+}
+
+// Level returns the current level.
+func (v *LevelVar) Level() Level {
+	n := v.v.Load()
+	if n == levelUnset {
+		return v.parent.Load().Level()
+	}
+	return Level(n)
+}
+
+// Set changes the level.
+func (v *LevelVar) Set(l Level) {
+	v.v.Store(int32(l))
+}
+
+// Reset makes a LevelVar obtained from Levels.Var follow the pattern covering
+// its name, or the global level, again. It has no effect on other LevelVars.
+func (v *LevelVar) Reset() {
+	if v.parent.Load() != nil {
+		v.v.Store(levelUnset)
+	}
+}
+
+func (v *LevelVar) String() string {
+	return v.Level().String()
+}
+
+func (v *LevelVar) MarshalText() ([]byte, error) {
+	return v.Level().MarshalText()
+}
+
+func (v *LevelVar) UnmarshalText(b []byte) error {
+	l, err := ParseLevel(string(b))
+	if err != nil {
+		return err
+	}
+	v.Set(l)
+	return nil
+}
+
+// WithLevelVar makes the logger read its lowest level from v on every record,
+// so it can be changed at run time. It takes precedence over WithLevel.
+func WithLevelVar(v *LevelVar) Option {
+	return func(o *options) {
+		o.levelVar = v
+	}
+}
@@ -0,0 +1,227 @@
+package bark
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Levels holds a global level and the levels of named loggers so they can be
+// reported and changed at run time, for instance through its HTTP handler.
+//
+// Names are dot-separated paths such as "db.pool". Besides exact names, a set
+// holds patterns such as "db.*", which cover "db" and every name below it.
+// Until its level is set, a name follows the longest pattern covering it, and
+// a name or pattern with nothing covering it follows the global level.
+type Levels struct {
+	global LevelVar
+	mu     sync.Mutex
+	named  map[string]*LevelVar // names and patterns
+}
+
+// NewLevels returns a set whose global level starts at global.
+func NewLevels(global Level) *Levels {
+	s := &Levels{named: make(map[string]*LevelVar)}
+	s.global.Set(global)
+	return s
+}
+
+// ParseLevels returns a set configured by spec, as for Apply. The global level
+// is LevelInfo unless spec sets it.
+func ParseLevels(spec string) (*Levels, error) {
+	s := NewLevels(LevelInfo)
+	if err := s.Apply(spec); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Apply sets levels from a comma-separated spec, typically read from an
+// environment variable. A bare level sets the global level and name=level
+// the level of a name or pattern:
+//
+//	warn,db.*=debug,http.access=error
+//
+// The spec is checked in full before any level changes.
+func (s *Levels) Apply(spec string) error {
+	type entry struct {
+		name  string
+		level Level
+	}
+	var entries []entry
+	for item := range strings.SplitSeq(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, lvl, ok := strings.Cut(item, "=")
+		if !ok {
+			name, lvl = "", name
+		}
+		name = strings.TrimSpace(name)
+		level, err := ParseLevel(strings.TrimSpace(lvl))
+		if err != nil {
+			return fmt.Errorf("bark: level spec %q: %w", item, err)
+		}
+		if name == "*" {
+			name = ""
+		}
+		if strings.Contains(strings.TrimSuffix(name, ".*"), "*") || strings.HasPrefix(name, ".") {
+			return fmt.Errorf("bark: level spec %q: invalid name", item)
+		}
+		entries = append(entries, entry{name, level})
+	}
+	for _, e := range entries {
+		if e.name == "" {
+			s.global.Set(e.level)
+		} else {
+			s.Var(e.name).Set(e.level)
+		}
+	}
+	return nil
+}
+
+// WithLevels makes the logger take its level from s: the global level, or for
+// loggers returned by Named, the level of their name. WithLevelVar takes
+// precedence for the logger itself, but not for its named children.
+func WithLevels(s *Levels) Option {
+	return func(o *options) {
+		o.levels = s
+	}
+}
+
+// Global returns the global level, for loggers that have no name.
+func (s *Levels) Global() *LevelVar {
+	return &s.global
+}
+
+// Var returns the level of the logger called name, or of the pattern if name
+// ends in ".*", adding it to the set the first time.
+func (s *Levels) Var(name string) *LevelVar {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.named[name]
+	if ok {
+		return v
+	}
+	v = new(LevelVar)
+	v.v.Store(levelUnset)
+	s.named[name] = v
+	if strings.HasSuffix(name, ".*") {
+		// A new pattern may be more specific than the one a name follows.
+		for n, w := range s.named {
+			w.parent.Store(s.parentLocked(n))
+		}
+	} else {
+		v.parent.Store(s.parentLocked(name))
+	}
+	return v
+}
+
+// parentLocked returns the level followed by name: that of the longest
+// pattern covering it, or the global level.
+func (s *Levels) parentLocked(name string) *LevelVar {
+	base, isPattern := strings.CutSuffix(name, ".*")
+	for {
+		if !isPattern {
+			if v, ok := s.named[base+".*"]; ok {
+				return v
+			}
+		}
+		isPattern = false
+		i := strings.LastIndexByte(base, '.')
+		if i < 0 {
+			return &s.global
+		}
+		base = base[:i]
+	}
+}
+
+// levelsState is the JSON form of a Levels served by its HTTP handler.
+type levelsState struct {
+	Level   Level            `json:"level"`
+	Loggers map[string]Level `json:"loggers,omitempty"`
+}
+
+// levelsUpdate is the JSON body of a PUT request. A named logger whose level
+// is null goes back to following its pattern or the global level.
+type levelsUpdate struct {
+	Logger string `json:"logger"`
+	Level  *Level `json:"level"`
+}
+
+// ServeHTTP reports the levels on GET and changes one on PUT. Both respond
+// with the current levels:
+//
+//	{"level":"info","loggers":{"db":"debug","http":"info"}}
+//
+// A PUT body of {"level":"debug"} sets the global level and
+// {"logger":"db","level":"warn"} the level of a named logger, which must
+// already be in the set, or of a pattern such as "db.*", which is added if
+// needed. Setting a named level to null makes it follow the pattern covering
+// it, or the global level, again.
+func (s *Levels) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPut:
+		var u levelsUpdate
+		dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<16))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&u); err != nil {
+			http.Error(w, fmt.Sprintf("bark: invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if status, err := s.update(u); err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "bark: method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.state())
+}
+
+func (s *Levels) update(u levelsUpdate) (int, error) {
+	if u.Logger == "" {
+		if u.Level == nil {
+			return http.StatusBadRequest, fmt.Errorf("bark: missing level")
+		}
+		s.global.Set(*u.Level)
+		return 0, nil
+	}
+
+	s.mu.Lock()
+	v, ok := s.named[u.Logger]
+	s.mu.Unlock()
+	if !ok && strings.HasSuffix(u.Logger, ".*") && u.Level != nil {
+		v, ok = s.Var(u.Logger), true
+	}
+	if !ok {
+		return http.StatusNotFound, fmt.Errorf("bark: unknown logger %q", u.Logger)
+	}
+	if u.Level == nil {
+		v.Reset()
+	} else {
+		v.Set(*u.Level)
+	}
+	return 0, nil
+}
+
+func (s *Levels) state() levelsState {
+	st := levelsState{Level: s.global.Level()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.named) > 0 {
+		st.Loggers = make(map[string]Level, len(s.named))
+		for name, v := range s.named {
+			st.Loggers[name] = v.Level()
+		}
+	}
+	return st
+}
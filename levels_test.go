@@ -0,0 +1,183 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLevelVarShared(t *testing.T) {
+	var a, b bytes.Buffer
+	var lv LevelVar
+	la := NewLogger(&a, WithLevelVar(&lv))
+	lb := NewBinaryLogger(&b, WithLevelVar(&lv), WithLevel(LevelError))
+
+	la.Debug().Msg("hidden")
+	lb.Info().Msg("shown")
+	lv.Set(LevelDebug)
+	la.Debug().Msg("shown")
+	lb.Debug().Msg("shown")
+	if la.LevelVar() != &lv || lv.String() != "debug" {
+		t.Errorf("unexpected level var %v", la.LevelVar())
+	}
+
+	if n := strings.Count(a.String(), "\n"); n != 1 {
+		t.Errorf("json logger wrote %d records, want 1", n)
+	}
+	r := NewBinaryReader(&b)
+	for range 2 {
+		if _, err := r.Next(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLevelsVar(t *testing.T) {
+	s := NewLevels(LevelWarn)
+	db := s.Var("db")
+	if db != s.Var("db") || db.Level() != LevelWarn {
+		t.Fatal("expected the named level to follow the global one")
+	}
+	s.Global().Set(LevelError)
+	if db.Level() != LevelError {
+		t.Errorf("got %v, want error", db.Level())
+	}
+	db.Set(LevelDebug)
+	s.Global().Set(LevelInfo)
+	if db.Level() != LevelDebug {
+		t.Errorf("override lost: %v", db.Level())
+	}
+	db.Reset()
+	if db.Level() != LevelInfo {
+		t.Errorf("reset did not restore the global level: %v", db.Level())
+	}
+}
+
+func TestLevelsHandler(t *testing.T) {
+	s := NewLevels(LevelInfo)
+	var buf bytes.Buffer
+	l := NewLogger(&buf, WithLevelVar(s.Var("db")))
+
+	do := func(method, body string) (int, string) {
+		req := httptest.NewRequest(method, "/loglevel", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		s.ServeHTTP(rec, req)
+		return rec.Code, strings.TrimSpace(rec.Body.String())
+	}
+
+	if code, body := do(http.MethodGet, ""); code != 200 || body != `{"level":"info","loggers":{"db":"info"}}` {
+		t.Errorf("GET: %d %s", code, body)
+	}
+	if code, body := do(http.MethodPut, `{"logger":"db","level":"debug"}`); code != 200 || body != `{"level":"info","loggers":{"db":"debug"}}` {
+		t.Errorf("PUT named: %d %s", code, body)
+	}
+	l.Debug().Msg("now visible")
+	if buf.Len() == 0 {
+		t.Error("level change did not reach the logger")
+	}
+	if code, body := do(http.MethodPut, `{"level":"ERROR"}`); code != 200 || body != `{"level":"error","loggers":{"db":"debug"}}` {
+		t.Errorf("PUT global: %d %s", code, body)
+	}
+	if code, body := do(http.MethodPut, `{"logger":"db","level":null}`); code != 200 || body != `{"level":"error","loggers":{"db":"error"}}` {
+		t.Errorf("PUT reset: %d %s", code, body)
+	}
+
+	for _, c := range []struct {
+		method, body string
+		code         int
+	}{
+		{http.MethodPut, `{"level":"loud"}`, http.StatusBadRequest},
+		{http.MethodPut, `{"lvl":"info"}`, http.StatusBadRequest},
+		{http.MethodPut, `{}`, http.StatusBadRequest},
+		{http.MethodPut, `{"logger":"cache","level":"info"}`, http.StatusNotFound},
+		{http.MethodPost, `{"level":"info"}`, http.StatusMethodNotAllowed},
+	} {
+		if code, body := do(c.method, c.body); code != c.code {
+			t.Errorf("%s %s: got %d %s, want %d", c.method, c.body, code, body, c.code)
+		}
+	}
+
+	var st map[string]any
+	_, body := do(http.MethodGet, "")
+	if err := json.Unmarshal([]byte(body), &st); err != nil || st["level"] != "error" {
+		t.Errorf("failed requests changed the levels: %s", body)
+	}
+}
+
+func TestLevelsPatterns(t *testing.T) {
+	s, err := ParseLevels(" warn, db.*=debug ,db.pool.*=error,http.access=info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Level{
+		"":             LevelWarn,
+		"api":          LevelWarn,
+		"db":           LevelDebug,
+		"db.query":     LevelDebug,
+		"db.pool":      LevelError,
+		"db.pool.idle": LevelError,
+		"http":         LevelWarn,
+		"http.access":  LevelInfo,
+		"dbx":          LevelWarn,
+	}
+	for name, level := range want {
+		v := s.Global()
+		if name != "" {
+			v = s.Var(name)
+		}
+		if v.Level() != level {
+			t.Errorf("%q: got %v, want %v", name, v.Level(), level)
+		}
+	}
+
+	// A pattern added later takes over the names it covers.
+	idle := s.Var("db.pool.idle")
+	s.Var("db.pool.idle.*").Set(LevelInfo)
+	if idle.Level() != LevelInfo {
+		t.Errorf("got %v after adding a narrower pattern", idle.Level())
+	}
+	s.Var("db.*").Set(LevelWarn)
+	if q := s.Var("db.query"); q.Level() != LevelWarn {
+		t.Errorf("pattern change not followed: %v", q.Level())
+	}
+}
+
+func TestLevelsApplyErrors(t *testing.T) {
+	s := NewLevels(LevelInfo)
+	for _, spec := range []string{"loud", "db=", "d*b=info", ".db=info", "info,db=nope"} {
+		if err := s.Apply(spec); err == nil {
+			t.Errorf("%q: expected an error", spec)
+		}
+	}
+	if s.Global().Level() != LevelInfo || len(s.named) != 0 {
+		t.Error("a rejected spec changed the levels")
+	}
+	if err := s.Apply("*=error"); err != nil || s.Global().Level() != LevelError {
+		t.Errorf("*=error: %v, %v", err, s.Global().Level())
+	}
+}
+
+func TestLoggerWithLevels(t *testing.T) {
+	s, _ := ParseLevels("warn,db.*=debug")
+	var buf bytes.Buffer
+	root := NewLogger(&buf, WithLevels(s))
+	root.Info().Msg("hidden")
+	root.Named("db").Named("pool").Debug().Msg("shown")
+	root.Named("api").Info().Msg("hidden")
+	if n := strings.Count(buf.String(), "\n"); n != 1 || !strings.Contains(buf.String(), `"logger":"db.pool"`) {
+		t.Errorf("unexpected output: %q", buf.String())
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"logger":"api.*","level":"info"}`)))
+	if rec.Code != 200 {
+		t.Fatalf("PUT pattern: %d %s", rec.Code, rec.Body)
+	}
+	root.Named("api").Info().Msg("shown")
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("pattern set over HTTP not applied: %q", buf.String())
+	}
+}
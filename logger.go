@@ -0,0 +1,768 @@
+package bark
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// Logger writes records through an Encoder, JSON unless configured otherwise
+// with WithFormat or WithEncoder. The typed methods, size limits and duplicate
+// key handling behave the same for every encoder, so code can take a *Logger
+// and leave the output format to configuration.
+type Logger struct {
+	pool sync.Pool
+	out  io.Writer
+	opts options
+	enc  Encoder
+	fan  *fanout // set instead of out by NewFanoutLogger
+
+	closer io.Closer // outputs opened by Config.Build
+
+	level   *LevelVar
+	floor   Level // lowest level any fan-out sink wants
+	name    string
+	ctx     []byte // fields written after Begin, such as the logger name
+	ctxN    int
+	msgKey  string
+	fixed   []string // keys the encoder writes as fields besides the message
+	marker  []byte   // the encoded "_truncated" field
+	endLen  int      // bytes added by End
+	reserve int      // room kept for the message and marker under a record limit
+}
+
+type Event struct {
+	buf   []byte
+	l     *Logger
+	level Level
+	head  int // length of the record prefix: Begin and the context fields
+	mark  int // start of the last field
+	markN int // fields before the last one
+	n     int // fields after the prefix
+	lost  int // bytes of fields rolled back by the record limit
+	keys  keyIndex
+	alt   []byte // the record transcoded for fan-out sinks
+
+	seal    int    // start of the last field's value if it is to be encrypted
+	sealKey string // key of that field
+}
+
+// messageKeyer is implemented by built-in encoders whose format names the
+// message field differently.
+type messageKeyer interface {
+	messageKey() string
+}
+
+// messageKey returns the name of the message field written with enc.
+func messageKey(enc Encoder, o *options) string {
+	if o.names.Message != "" {
+		return o.names.Message
+	}
+	if mk, ok := enc.(messageKeyer); ok {
+		return mk.messageKey()
+	}
+	return "message"
+}
+
+func NewLogger(w io.Writer, opts ...Option) *Logger {
+	l := &Logger{opts: newOptions(opts)}
+	l.out = w
+	if l.opts.encoder == nil {
+		l.out = formatWriter(w, l.opts.format, &l.opts)
+	}
+	l.init()
+	return l
+}
+
+// init sets up the encoder and the event pool once the options are known.
+func (l *Logger) init() {
+	l.level = l.opts.levelVar
+	if l.level == nil && l.opts.levels != nil {
+		l.level = l.opts.levels.Global()
+	}
+	if l.level == nil {
+		l.level = new(LevelVar)
+		l.level.Set(l.opts.level)
+	}
+	l.floor = LevelDebug
+	l.enc = l.opts.encoder
+	if l.enc == nil {
+		l.enc = newEncoder(l.opts.format, &l.opts)
+	}
+	l.msgKey = messageKey(l.enc, &l.opts)
+	if l.fan != nil && len(l.fan.groups) > 1 {
+		// Records are transcoded, which finds the message by this name.
+		l.msgKey = "message"
+	}
+
+	if _, ok := l.enc.(binaryEncoder); !ok {
+		// Binary frames keep the level and time in their header.
+		l.fixed = []string{l.opts.names.level(), l.opts.names.time()}
+	}
+
+	l.marker = l.enc.AppendBool(l.enc.AppendKey(nil, "_truncated"), true)
+	head := l.enc.Begin(nil, time.Time{}, LevelInfo)
+	n := len(head)
+	l.endLen = len(l.enc.End(head, 0)) - n
+	l.reserve = len(l.enc.AppendString(l.enc.AppendKey(nil, l.msgKey), "")) + len(l.marker) + l.endLen
+
+	l.pool.New = func() any {
+		return &Event{
+			buf: make([]byte, 0, 512),
+			l:   l,
+		}
+	}
+}
+
+// Named returns a logger that adds a "logger" field holding its name to every
+// record and otherwise shares l's output and options. Names nest with dots,
+// so l.Named("db").Named("pool") is called "db.pool".
+//
+// If l was configured with WithLevels, the named logger takes its level from
+// the set under its name; otherwise it shares l's level.
+func (l *Logger) Named(name string) *Logger {
+	if l.name != "" {
+		name = l.name + "." + name
+	}
+	c := &Logger{
+		out:  l.out,
+		opts: l.opts,
+		fan:  l.fan,
+
+		closer: l.closer,
+	}
+	c.init()
+	c.floor = l.floor
+	c.level = l.level
+	if l.opts.levels != nil {
+		c.level = l.opts.levels.Var(name)
+	}
+	c.name = name
+	c.ctx = c.enc.AppendString(c.enc.AppendKey(nil, "logger"), name)
+	c.ctxN = 1
+	c.fixed = append(c.fixed, "logger")
+	return c
+}
+
+// Name returns the name given with Named, or "" for a root logger.
+func (l *Logger) Name() string {
+	return l.name
+}
+
+// Close flushes and closes the outputs opened by Config.Build and reports any
+// errors. Named loggers share the outputs of their parent, so closing any of
+// them closes all. Loggers from NewLogger and NewFanoutLogger do not own their
+// writers, and for them Close does nothing.
+func (l *Logger) Close() error {
+	if l.closer == nil {
+		return nil
+	}
+	return l.closer.Close()
+}
+
+// LevelVar returns the variable holding the logger's lowest level. Setting it
+// changes the level of every logger sharing it.
+func (l *Logger) LevelVar() *LevelVar {
+	return l.level
+}
+
+// Debug starts a record at LevelDebug. It returns nil, which every Event
+// method accepts, if the logger does not write that level.
+func (l *Logger) Debug() *Event {
+	return l.newEvent(LevelDebug)
+}
+
+// Info starts a record at LevelInfo.
+func (l *Logger) Info() *Event {
+	return l.newEvent(LevelInfo)
+}
+
+// Warn starts a record at LevelWarn.
+func (l *Logger) Warn() *Event {
+	return l.newEvent(LevelWarn)
+}
+
+// Error starts a record at LevelError.
+func (l *Logger) Error() *Event {
+	return l.newEvent(LevelError)
+}
+
+func (l *Logger) newEvent(level Level) *Event {
+	if level < l.floor || level < l.level.Level() {
+		return nil
+	}
+	now := time.Now()
+	if s := l.opts.sampler; s != nil && !s.allow(level, now) {
+		return nil
+	}
+	e := l.pool.Get().(*Event)
+	e.level = level
+	e.buf = l.enc.Begin(e.buf[:0], now, level)
+	e.buf = append(e.buf, l.ctx...)
+	e.head, e.mark, e.markN, e.n, e.lost = len(e.buf), len(e.buf), l.ctxN, l.ctxN, 0
+	e.keys.reset(l.fixed, l.msgKey)
+	e.seal = 0
+	return e
+}
+
+// settle rolls back the last field if it is a dropped duplicate or pushed the
+// record past the size limit. It runs lazily when the next field starts and
+// before the message.
+func (e *Event) settle() {
+	if e.keys.drop {
+		e.rollback()
+		return
+	}
+	if e.seal > 0 {
+		e.encrypt()
+	}
+	if limit := e.l.opts.fieldLimit(e.l.reserve); limit > 0 && len(e.buf) > limit && len(e.buf) > e.mark {
+		e.lost += len(e.buf) - e.mark
+		e.rollback()
+	}
+}
+
+// rollback removes the last field.
+func (e *Event) rollback() {
+	e.buf = e.buf[:e.mark]
+	e.keys.rollback(e.mark)
+	e.n = e.markN
+	e.seal = 0
+}
+
+func (e *Event) appendKey(key string) {
+	e.settle()
+	// Encryption goes by the key the caller gave, so a renamed duplicate is
+	// sealed too.
+	x := e.l.opts.crypt
+	seal := x != nil && x.keys.match(key)
+	if e.l.opts.dupKeys != DuplicateAllow {
+		var removed int
+		e.buf, key, removed = e.keys.check(e.buf, key, e.l.opts.dupKeys)
+		e.n -= removed
+	}
+	e.mark, e.markN = len(e.buf), e.n
+	e.n++
+	e.buf = e.l.enc.AppendKey(e.buf, key)
+	if seal {
+		e.seal, e.sealKey = len(e.buf), key
+	}
+}
+
+// skip rolls back the field just started if a value of at least size bytes
+// cannot fit the record limit, rather than growing the buffer for it.
+func (e *Event) skip(size int) bool {
+	if limit := e.l.opts.fieldLimit(e.l.reserve); limit > 0 && len(e.buf)+size > limit {
+		e.lost += len(e.buf) - e.mark + size
+		e.rollback()
+		return true
+	}
+	return false
+}
+
+// markTruncated follows a value cut short by the max value size with a
+// "<key>_truncated" field holding its original length. The marker belongs to
+// the same field, so it goes wherever the value goes.
+func (e *Event) markTruncated(key string, n, orig int) {
+	if n == orig || e.seal > 0 {
+		return
+	}
+	e.buf = e.l.enc.AppendKey(e.buf, key+"_truncated")
+	e.buf = e.l.enc.AppendUint64(e.buf, uint64(orig))
+	e.n++
+	e.keys.extend()
+}
+
+func (e *Event) Str(key, val string) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	val = e.scanned(val)
+	orig := len(val)
+	val = cutValue(val, e.l.opts.maxValueSize, true)
+	e.appendKey(key)
+	if e.skip(len(val)) {
+		return e
+	}
+	e.buf = e.l.enc.AppendString(e.buf, val)
+	e.markTruncated(key, len(val), orig)
+	return e
+}
+
+func (e *Event) Bytes(key string, val []byte) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	orig := len(val)
+	val = cutValue(val, e.l.opts.maxValueSize, false)
+	e.appendKey(key)
+	if e.skip(len(val)) {
+		return e
+	}
+	e.buf = e.l.enc.AppendBytes(e.buf, val)
+	e.markTruncated(key, len(val), orig)
+	return e
+}
+
+func (e *Event) Int(key string, val int) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendInt(e.buf, val)
+	return e
+}
+
+func (e *Event) Int8(key string, val int8) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendInt8(e.buf, val)
+	return e
+}
+
+func (e *Event) Int16(key string, val int16) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendInt16(e.buf, val)
+	return e
+}
+
+func (e *Event) Int32(key string, val int32) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendInt32(e.buf, val)
+	return e
+}
+
+func (e *Event) Int64(key string, val int64) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendInt64(e.buf, val)
+	return e
+}
+
+func (e *Event) Uint(key string, val uint) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendUint(e.buf, val)
+	return e
+}
+
+func (e *Event) Uint8(key string, val uint8) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendUint8(e.buf, val)
+	return e
+}
+
+func (e *Event) Uint16(key string, val uint16) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendUint16(e.buf, val)
+	return e
+}
+
+func (e *Event) Uint32(key string, val uint32) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendUint32(e.buf, val)
+	return e
+}
+
+func (e *Event) Uint64(key string, val uint64) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendUint64(e.buf, val)
+	return e
+}
+
+func (e *Event) Uintptr(key string, val uintptr) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendUintptr(e.buf, val)
+	return e
+}
+
+func (e *Event) Float32(key string, val float32) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendFloat32(e.buf, val)
+	return e
+}
+
+func (e *Event) Float64(key string, val float64) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendFloat64(e.buf, val)
+	return e
+}
+
+func (e *Event) Complex64(key string, val complex64) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendComplex64(e.buf, val)
+	return e
+}
+
+func (e *Event) Complex128(key string, val complex128) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendComplex128(e.buf, val)
+	return e
+}
+
+func (e *Event) Bool(key string, val bool) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendBool(e.buf, val)
+	return e
+}
+
+func (e *Event) Time(key string, val time.Time) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendTime(e.buf, val)
+	return e
+}
+
+func (e *Event) Dur(key string, val time.Duration) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendDuration(e.buf, val)
+	return e
+}
+
+// Stringer writes the result of val.String(), or null for a nil val.
+func (e *Event) Stringer(key string, val fmt.Stringer) *Event {
+	if e == nil {
+		return e
+	}
+	if val == nil || isNilPointer(val) {
+		e.appendKey(key)
+		e.buf = e.l.enc.AppendNull(e.buf)
+		return e
+	}
+	return e.Str(key, val.String())
+}
+
+// Hex writes val as lowercase hex in text formats and as raw bytes in binary
+// ones.
+func (e *Event) Hex(key string, val []byte) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	orig := len(val)
+	val = cutValue(val, e.l.opts.maxValueSize, false)
+	e.appendKey(key)
+	if e.skip(len(val)) {
+		return e
+	}
+	e.buf = e.l.enc.AppendHex(e.buf, val)
+	e.markTruncated(key, len(val), orig)
+	return e
+}
+
+// IPAddr writes val in its canonical text form, or null if it is the zero
+// Addr.
+func (e *Event) IPAddr(key string, val netip.Addr) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendIPAddr(e.buf, val)
+	return e
+}
+
+// IPPrefix writes val in CIDR notation, or null if it is invalid.
+func (e *Event) IPPrefix(key string, val netip.Prefix) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendIPPrefix(e.buf, val)
+	return e
+}
+
+// MACAddr writes val as colon-separated lowercase hex, e.g. "00:1a:2b:3c:4d:5e".
+func (e *Event) MACAddr(key string, val net.HardwareAddr) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendMAC(e.buf, val)
+	return e
+}
+
+// UUID writes val in the canonical 8-4-4-4-12 form.
+func (e *Event) UUID(key string, val [16]byte) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendUUID(e.buf, val)
+	return e
+}
+
+// RawJSON embeds val, an already encoded JSON value, as a nested value
+// rather than an escaped string. An empty val is written as null.
+func (e *Event) RawJSON(key string, val []byte) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	e.appendKey(key)
+	if len(val) == 0 {
+		e.buf = e.l.enc.AppendNull(e.buf)
+		return e
+	}
+	e.buf = e.l.enc.AppendRawJSON(e.buf, val)
+	return e
+}
+
+// Any writes val using the typed method matching its dynamic type. Errors are
+// written as errors, json.Marshaler and encoding.TextMarshaler values through
+// their marshalers, and everything else by the encoder's AppendAny.
+func (e *Event) Any(key string, val any) *Event {
+	if e == nil || redacted(e, key, val) {
+		return e
+	}
+	switch v := val.(type) {
+	case nil:
+		e.appendKey(key)
+		e.buf = e.l.enc.AppendNull(e.buf)
+		return e
+	case string:
+		return e.Str(key, v)
+	case []byte:
+		return e.Bytes(key, v)
+	case int:
+		return e.Int(key, v)
+	case int8:
+		return e.Int8(key, v)
+	case int16:
+		return e.Int16(key, v)
+	case int32:
+		return e.Int32(key, v)
+	case int64:
+		return e.Int64(key, v)
+	case uint:
+		return e.Uint(key, v)
+	case uint8:
+		return e.Uint8(key, v)
+	case uint16:
+		return e.Uint16(key, v)
+	case uint32:
+		return e.Uint32(key, v)
+	case uint64:
+		return e.Uint64(key, v)
+	case uintptr:
+		return e.Uintptr(key, v)
+	case float32:
+		return e.Float32(key, v)
+	case float64:
+		return e.Float64(key, v)
+	case complex64:
+		return e.Complex64(key, v)
+	case complex128:
+		return e.Complex128(key, v)
+	case bool:
+		return e.Bool(key, v)
+	case time.Time:
+		return e.Time(key, v)
+	case time.Duration:
+		return e.Dur(key, v)
+	case netip.Addr:
+		return e.IPAddr(key, v)
+	case netip.Prefix:
+		return e.IPPrefix(key, v)
+	case net.HardwareAddr:
+		return e.MACAddr(key, v)
+	case error:
+		if !isNilPointer(v) {
+			return e.appendError(key, v.Error())
+		}
+	case json.Marshaler:
+		if !isNilPointer(v) {
+			b, err := v.MarshalJSON()
+			if err != nil {
+				return e.Str(key, err.Error())
+			}
+			var buf bytes.Buffer
+			if err := json.Compact(&buf, b); err != nil {
+				return e.Str(key, err.Error())
+			}
+			return e.RawJSON(key, buf.Bytes())
+		}
+	case encoding.TextMarshaler:
+		if !isNilPointer(v) {
+			b, err := v.MarshalText()
+			if err != nil {
+				return e.Str(key, err.Error())
+			}
+			return e.Str(key, string(b))
+		}
+	}
+
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendAny(e.buf, val)
+	return e
+}
+
+// Interface is an alias for Any.
+func (e *Event) Interface(key string, val any) *Event {
+	return e.Any(key, val)
+}
+
+func (e *Event) Error(err error) *Event {
+	if e == nil {
+		return e
+	}
+	if err == nil {
+		return e
+	}
+	return e.appendError("error", err.Error())
+}
+
+func (e *Event) appendError(key, msg string) *Event {
+	if redacted(e, key, msg) {
+		return e
+	}
+	msg = e.scanned(msg)
+	orig := len(msg)
+	msg = cutValue(msg, e.l.opts.maxValueSize, true)
+	e.appendKey(key)
+	if e.skip(len(msg)) {
+		return e
+	}
+	e.buf = e.l.enc.AppendError(e.buf, msg)
+	e.markTruncated(key, len(msg), orig)
+	return e
+}
+
+func (e *Event) Msg(msg string) {
+	if e == nil {
+		return
+	}
+	e.settle()
+	if e.l.opts.dupKeys != DuplicateAllow {
+		var removed int
+		e.buf, removed = e.keys.remove(e.buf, e.l.msgKey)
+		e.n -= removed
+	}
+	msg = e.scanned(msg)
+	mark := len(e.buf)
+	e.appendMsg(msg)
+
+	if limit := e.l.opts.maxRecordSize; limit > 0 && (e.lost > 0 || len(e.buf)+e.l.endLen > limit) {
+		switch e.l.opts.overflow {
+		case OverflowDrop:
+			e.release()
+			return
+		case OverflowReplace:
+			e.replace(len(e.buf) + e.l.endLen + e.lost)
+			return
+		}
+		tail := len(e.l.marker) + e.l.endLen
+		for len(e.buf)+tail > limit && msg != "" {
+			msg = cutString(msg, len(msg)-(len(e.buf)+tail-limit))
+			e.buf = e.buf[:mark]
+			e.n--
+			e.appendMsg(msg)
+		}
+		e.buf = append(e.buf, e.l.marker...)
+		e.n++
+	}
+
+	e.write()
+}
+
+// appendMsg writes the message field. Unlike Str it is exempt from the value
+// and record limits, which Msg applies to the record as a whole.
+func (e *Event) appendMsg(msg string) {
+	e.buf = e.l.enc.AppendKey(e.buf, e.l.msgKey)
+	e.buf = e.l.enc.AppendString(e.buf, msg)
+	e.n++
+}
+
+// replace writes a warning in place of a record of size bytes that exceeded
+// the record limit, keeping its prefix.
+func (e *Event) replace(size int) {
+	e.buf = e.buf[:e.head]
+	e.buf = e.l.enc.AppendKey(e.buf, "record_size")
+	e.buf = e.l.enc.AppendUint64(e.buf, uint64(size))
+	e.buf = e.l.enc.AppendKey(e.buf, "size_limit")
+	e.buf = e.l.enc.AppendUint64(e.buf, uint64(e.l.opts.maxRecordSize))
+	e.n = e.l.ctxN + 2
+	e.appendMsg("record exceeded size limit")
+	e.write()
+}
+
+func (e *Event) write() {
+	e.buf = e.l.enc.End(e.buf, e.n)
+	if e.l.fan != nil {
+		e.alt = e.l.fan.write(e.buf, e.level, e.alt)
+	} else {
+		e.l.out.Write(e.buf)
+	}
+	e.release()
+}
+
+func (e *Event) release() {
+	if cap(e.buf) > maxPooledBuf || cap(e.alt) > maxPooledBuf {
+		return
+	}
+	e.l.pool.Put(e)
+}
+
+// cutValue shortens val to at most max bytes, backing up to a rune boundary
+// if runes is set. A max of zero leaves val as is.
+func cutValue[T string | []byte](val T, max int, runes bool) T {
+	if max <= 0 || len(val) <= max {
+		return val
+	}
+	n := max
+	for runes && n > 0 && !utf8.RuneStart(val[n]) {
+		n--
+	}
+	return val[:n]
+}
@@ -0,0 +1,265 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFormat(t *testing.T) {
+	for f := FormatJSON; f <= FormatConsole; f++ {
+		b, err := f.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got Format
+		if err := got.UnmarshalText(bytes.ToUpper(b)); err != nil || got != f {
+			t.Errorf("%s: round trip gave %v, %v", b, got, err)
+		}
+	}
+	if _, err := ParseFormat("yaml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+	if s := Format(99).String(); s != "Format(99)" {
+		t.Errorf("unexpected name %q", s)
+	}
+}
+
+// logRecord logs the same record through l, so the formats can be compared.
+func logRecord(l *Logger) {
+	l.Info().Str("user", "u123").Int("attempt", 3).Bool("ok", true).Msg("login")
+}
+
+func TestLoggerWithFormat(t *testing.T) {
+	var buf bytes.Buffer
+
+	logRecord(NewLogger(&buf, WithFormat(FormatJSON)))
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil || rec["user"] != "u123" || rec["message"] != "login" {
+		t.Errorf("json: %v %v", rec, err)
+	}
+
+	buf.Reset()
+	logRecord(NewLogger(&buf, WithFormat(FormatLogfmt)))
+	if got := buf.String(); !strings.HasSuffix(got, " user=u123 attempt=3 ok=true msg=login\n") {
+		t.Errorf("logfmt: %q", got)
+	}
+
+	buf.Reset()
+	logRecord(NewLogger(&buf, WithFormat(FormatBinary)))
+	r := NewBinaryReader(&buf)
+	if bin, err := r.Next(); err != nil || bin.Message() != "login" || len(bin.Fields) != 4 {
+		t.Errorf("binary: %+v %v", bin, err)
+	}
+
+	buf.Reset()
+	logRecord(NewLogger(&buf, WithFormat(FormatCBOR)))
+	if rec := decodeCBORRecord(t, buf.Bytes()); rec["attempt"] != uint64(3) || len(rec) != 6 {
+		t.Errorf("cbor: %v", rec)
+	}
+
+	buf.Reset()
+	logRecord(NewLogger(&buf, WithFormat(FormatMsgpack)))
+	if rec := decodeMsgpackRecord(t, buf.Bytes()); rec["attempt"] != int64(3) || len(rec) != 6 {
+		t.Errorf("msgpack: %v", rec)
+	}
+}
+
+// upperKeyEncoder is a custom encoder that writes JSON with upper-case keys.
+type upperKeyEncoder struct {
+	Encoder
+}
+
+func (enc upperKeyEncoder) Begin(dst []byte, t time.Time, level Level) []byte {
+	return append(dst, `{"LEVEL":"info"`...)
+}
+
+func (enc upperKeyEncoder) AppendKey(dst []byte, key string) []byte {
+	dst = append(dst, ',')
+	dst = appendString(dst, strings.ToUpper(key))
+	return append(dst, ':')
+}
+
+func TestLoggerWithEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := upperKeyEncoder{jsonEncoder{&defaultOptions}}
+	l := NewLogger(&buf,
+		WithEncoder(enc),
+		WithFormat(FormatCBOR), // ignored in favour of the encoder
+		WithDuplicateKeys(DuplicateOverwrite),
+		WithMaxValueSize(4),
+	)
+
+	l.Info().Str("a", "first").Int("b", 2).Str("a", "second").Msg("done")
+	want := `{"LEVEL":"info","B":2,"A":"seco","A_TRUNCATED":6,"MESSAGE":"done"}` + "\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
+
+func TestLoggerMaxValueSizeAllFormats(t *testing.T) {
+	for f := FormatJSON; f <= FormatConsole; f++ {
+		var buf bytes.Buffer
+		NewLogger(&buf, WithFormat(f), WithMaxValueSize(8)).Info().
+			Str("s", strings.Repeat("x", 100)).
+			Msg(strings.Repeat("m", 100))
+		if !bytes.Contains(buf.Bytes(), []byte("s_truncated")) {
+			t.Errorf("%v: value was not marked as truncated", f)
+		}
+		if bytes.Contains(buf.Bytes(), []byte(strings.Repeat("x", 9))) {
+			t.Errorf("%v: value was not cut", f)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for l := LevelDebug; l <= LevelError; l++ {
+		b, _ := l.MarshalText()
+		var got Level
+		if err := got.UnmarshalText(bytes.ToUpper(b)); err != nil || got != l {
+			t.Errorf("%s: round trip gave %v, %v", b, got, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("expected an error for an unknown level")
+	}
+}
+
+func TestLoggerLevels(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf, WithLevel(LevelWarn))
+
+	if e := l.Info(); e != nil {
+		t.Fatal("expected a nil event below the logger level")
+	}
+	l.Debug().Str("a", "b").Any("c", 1).Stringer("d", nil).Error(errors.New("x")).Msg("hidden")
+	l.Info().Msg("hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("records below the level were written: %q", buf.String())
+	}
+
+	l.Warn().Msg("w")
+	l.Error().Msg("e")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], `{"level":"warn",`) || !strings.HasPrefix(lines[1], `{"level":"error",`) {
+		t.Errorf("unexpected records: %q", lines)
+	}
+
+	buf.Reset()
+	NewBinaryLogger(&buf).Debug().Msg("d")
+	if rec, err := NewBinaryReader(&buf).Next(); err != nil || rec.Type != BinTypeDebug || rec.Level() != LevelDebug {
+		t.Errorf("binary: %+v %v", rec, err)
+	}
+
+	buf.Reset()
+	NewCBORLogger(&buf).Warn().Msg("w")
+	if rec := decodeCBORRecord(t, buf.Bytes()); rec["level"] != "warn" {
+		t.Errorf("cbor: %v", rec)
+	}
+}
+
+func TestLoggerNamed(t *testing.T) {
+	var buf bytes.Buffer
+	root := NewLogger(&buf, WithLevel(LevelInfo), WithMaxRecordSize(120, OverflowReplace))
+	pool := root.Named("db").Named("pool")
+	if pool.Name() != "db.pool" || root.Name() != "" {
+		t.Fatalf("unexpected names %q, %q", pool.Name(), root.Name())
+	}
+
+	pool.Debug().Msg("hidden")
+	pool.Info().Int("conns", 4).Msg("opened")
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["logger"] != "db.pool" || rec["conns"] != 4.0 || rec["message"] != "opened" {
+		t.Errorf("unexpected record: %v", rec)
+	}
+
+	buf.Reset()
+	pool.Info().Str("big", strings.Repeat("x", 200)).Msg("too big")
+	rec = nil
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["logger"] != "db.pool" || rec["message"] != "record exceeded size limit" {
+		t.Errorf("options not inherited: %v", rec)
+	}
+
+	root.LevelVar().Set(LevelDebug)
+	buf.Reset()
+	pool.Debug().Msg("shared level")
+	if buf.Len() == 0 {
+		t.Error("named logger does not share the parent level")
+	}
+}
+
+func TestLoggerNamedBinary(t *testing.T) {
+	var buf bytes.Buffer
+	NewMsgpackLogger(&buf).Named("api").Info().Msg("m")
+	if rec := decodeMsgpackRecord(t, buf.Bytes()); rec["logger"] != "api" || len(rec) != 4 {
+		t.Errorf("msgpack: %v", rec)
+	}
+
+	buf.Reset()
+	NewBinaryLogger(&buf).Named("api").Warn().Msg("m")
+	rec, err := NewBinaryReader(&buf).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := rec.Get("logger"); v != "api" || rec.Level() != LevelWarn {
+		t.Errorf("binary: %+v", rec)
+	}
+}
+
+func TestLoggerNamedDuplicateKeys(t *testing.T) {
+	for _, c := range []struct {
+		policy DuplicatePolicy
+		want   []string
+	}{
+		{DuplicateDrop, []string{"logger=api", "message=m"}},
+		{DuplicateRename, []string{"logger=api", "logger_1=x", "message=m"}},
+		{DuplicateOverwrite, []string{"logger=api", "message=m"}},
+	} {
+		var buf bytes.Buffer
+		NewBinaryLogger(&buf, WithDuplicateKeys(c.policy)).Named("api").Info().Str("logger", "x").Msg("m")
+		rec, err := DecodeBinary(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, f := range rec.Fields {
+			got = append(got, fmt.Sprint(f.Key, "=", f.Value))
+		}
+		if !slices.Equal(got, c.want) {
+			t.Errorf("policy %d: got %v, want %v", c.policy, got, c.want)
+		}
+	}
+}
+
+func TestLoggerFieldNames(t *testing.T) {
+	names := FieldNames{Level: "severity", Time: "ts", Message: "text"}
+	var j, lf, c bytes.Buffer
+	NewLogger(&j, WithFieldNames(names)).Warn().Int("n", 1).Msg("hi")
+	NewLogfmtLogger(&lf, WithFieldNames(names)).Warn().Msg("hi")
+	NewLogger(&c, WithFieldNames(names), WithFormat(FormatConsole)).Warn().Int("n", 1).Msg("hi")
+
+	var rec map[string]any
+	if err := json.Unmarshal(j.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec["severity"] != "warn" || rec["text"] != "hi" || rec["ts"] == nil || rec["level"] != nil {
+		t.Errorf("json: %s", j.String())
+	}
+	if s := lf.String(); !strings.HasPrefix(s, "severity=warn ts=") || !strings.Contains(s, " text=hi") {
+		t.Errorf("logfmt: %s", s)
+	}
+	if s := c.String(); !strings.Contains(s, "WRN") || !strings.Contains(s, "hi") || !strings.Contains(s, "n=") || strings.Contains(s, "severity") {
+		t.Errorf("console: %q", s)
+	}
+}
@@ -0,0 +1,246 @@
+package bark
+
+import "unicode/utf8"
+
+// Option configures a logger at construction time.
+type Option func(*options)
+
+// OverflowPolicy decides what happens to a record that grows past the size set
+// with WithMaxRecordSize.
+type OverflowPolicy uint8
+
+const (
+	// OverflowTruncate omits the fields that do not fit, shortens the message
+	// if needed and marks the record with a "_truncated" field.
+	OverflowTruncate OverflowPolicy = iota
+	// OverflowDrop discards the record.
+	OverflowDrop
+	// OverflowReplace writes a short warning record carrying the original
+	// size in place of the record.
+	OverflowReplace
+)
+
+// TimeFormat selects how JSON records write times, including the record
+// timestamp.
+type TimeFormat uint8
+
+const (
+	// TimeRFC3339 writes a quoted RFC 3339 string, to the second for the
+	// record time and with the fraction of a second for Time fields.
+	TimeRFC3339 TimeFormat = iota
+	// TimeUnix writes seconds since the Unix epoch.
+	TimeUnix
+	// TimeUnixMs writes milliseconds since the Unix epoch.
+	TimeUnixMs
+	// TimeUnixNano writes nanoseconds since the Unix epoch.
+	TimeUnixNano
+)
+
+// DurationFormat selects how JSON records write durations.
+type DurationFormat uint8
+
+const (
+	// DurationMs writes milliseconds as a number, e.g. 1.5.
+	DurationMs DurationFormat = iota
+	// DurationString writes the quoted Go representation, e.g. "1.5ms".
+	DurationString
+)
+
+// NonFiniteFormat selects how JSON records write NaN and infinities, which
+// JSON numbers cannot represent.
+type NonFiniteFormat uint8
+
+const (
+	// NonFiniteString writes "NaN", "+Inf" and "-Inf" as strings.
+	NonFiniteString NonFiniteFormat = iota
+	// NonFiniteNull writes null.
+	NonFiniteNull
+)
+
+// maxPooledBuf is the largest event buffer returned to the pool. Events that
+// grew past it are left to the garbage collector so one oversized record does
+// not pin its memory for the life of the process.
+const maxPooledBuf = 64 << 10
+
+type options struct {
+	maxValueSize  int
+	maxRecordSize int
+	overflow      OverflowPolicy
+	timeFormat    TimeFormat
+	durFormat     DurationFormat
+	validateRaw   bool
+	htmlSafe      bool
+	nonFinite     NonFiniteFormat
+	floatFmt      byte
+	floatPrec     int
+	complexObject bool
+	dupKeys       DuplicatePolicy
+	level         Level
+	levelVar      *LevelVar
+	levels        *Levels
+	sampler       *sampler
+	redact        *redactor
+	crypt         *encryptor
+	names         FieldNames
+	format        Format
+	encoder       Encoder
+}
+
+// defaultOptions is used where records are rendered outside a logger.
+var defaultOptions = newOptions(nil)
+
+func newOptions(opts []Option) options {
+	o := options{level: LevelDebug, floatPrec: -1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// fieldLimit returns the size fields may grow a record to, keeping reserve
+// bytes free for the message and the truncation marker. It returns 0 when no
+// record limit is set.
+func (o *options) fieldLimit(reserve int) int {
+	if o.maxRecordSize == 0 {
+		return 0
+	}
+	return max(o.maxRecordSize-reserve, 1)
+}
+
+// WithMaxValueSize caps string, byte, hex and error values at n bytes. Values
+// that are cut short are followed by a "<key>_truncated" field holding the
+// original length. Zero, the default, disables the cap.
+func WithMaxValueSize(n int) Option {
+	return func(o *options) {
+		o.maxValueSize = n
+	}
+}
+
+// WithMaxRecordSize limits encoded records to n bytes, resolving records that
+// grow past it according to p. Zero, the default, disables the limit.
+func WithMaxRecordSize(n int, p OverflowPolicy) Option {
+	return func(o *options) {
+		o.maxRecordSize = n
+		o.overflow = p
+	}
+}
+
+// WithTimeFormat sets how JSON records write the timestamp and Time fields.
+// Binary records always store nanoseconds.
+func WithTimeFormat(f TimeFormat) Option {
+	return func(o *options) {
+		o.timeFormat = f
+	}
+}
+
+// WithDurationFormat sets how JSON records write Dur fields. Binary records
+// always store nanoseconds.
+func WithDurationFormat(f DurationFormat) Option {
+	return func(o *options) {
+		o.durFormat = f
+	}
+}
+
+// WithRawJSONValidation makes RawJSON check and compact its input, writing
+// the validation error as a string when the input is not valid JSON. Without
+// it the bytes are embedded as given, except that input spanning several
+// lines is still compacted so it cannot split the record.
+func WithRawJSONValidation() Option {
+	return func(o *options) {
+		o.validateRaw = true
+	}
+}
+
+// WithHTMLSafe makes JSON records escape <, > and & as \u003c, \u003e and
+// \u0026 so they can be embedded in HTML.
+func WithHTMLSafe() Option {
+	return func(o *options) {
+		o.htmlSafe = true
+	}
+}
+
+// WithNonFinite sets how JSON records write NaN and infinite floats. Binary
+// records store the raw bits and are unaffected.
+func WithNonFinite(f NonFiniteFormat) Option {
+	return func(o *options) {
+		o.nonFinite = f
+	}
+}
+
+// WithFloatFormat sets the strconv format ('f', 'e', 'E', 'g' or 'G') and
+// precision used for floats in JSON and logfmt records. A precision of -1
+// writes the fewest digits that represent the value exactly. Other formats do
+// not write JSON numbers, and 'f' is used instead. By default floats are
+// written as encoding/json writes them: the fewest digits, with an exponent
+// only below 1e-6 and from 1e21 up.
+func WithFloatFormat(fmt byte, prec int) Option {
+	switch fmt {
+	case 'f', 'e', 'E', 'g', 'G':
+	default:
+		fmt = 'f'
+	}
+	return func(o *options) {
+		o.floatFmt = fmt
+		o.floatPrec = prec
+	}
+}
+
+// WithComplexObject makes JSON records write complex numbers as
+// {"real":a,"imag":b} objects instead of "(a+bi)" strings.
+func WithComplexObject() Option {
+	return func(o *options) {
+		o.complexObject = true
+	}
+}
+
+// cutString shortens s to at most n bytes without splitting a rune.
+func cutString(s string, n int) string {
+	if n >= len(s) {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// FieldNames renames the fields every record carries. Empty names keep the
+// defaults: "level", "time" and "message", or "msg" in logfmt.
+type FieldNames struct {
+	Level   string `json:"level,omitempty"`
+	Time    string `json:"time,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (n FieldNames) level() string {
+	if n.Level == "" {
+		return "level"
+	}
+	return n.Level
+}
+
+func (n FieldNames) time() string {
+	if n.Time == "" {
+		return "time"
+	}
+	return n.Time
+}
+
+func (n FieldNames) message() string {
+	if n.Message == "" {
+		return "message"
+	}
+	return n.Message
+}
+
+// WithFieldNames renames the level, time and message fields, for instance to
+// match what a log pipeline expects. Binary records keep the level and time
+// in the frame header and only use the message name.
+func WithFieldNames(n FieldNames) Option {
+	return func(o *options) {
+		o.names = n
+	}
+}
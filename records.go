@@ -0,0 +1,127 @@
+package bark
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// LogReader reads the records of a log written by Logger in the JSON or the
+// binary format, including block streams, telling them apart by the first
+// byte other than white space.
+type LogReader struct {
+	// Keyring, if set, decrypts the encrypted fields of binary records.
+	Keyring Keyring
+	// FieldNames must match the names the logger was configured with by
+	// WithFieldNames, if any. Binary records only use the message name.
+	FieldNames FieldNames
+	// OnError, if set, is called with the errors a log can be read past:
+	// records that do not decode, which Next then skips, and fields that do
+	// not decrypt, whose records Next returns without an error.
+	OnError func(error)
+
+	r    *bufio.Reader
+	next func() (*BinaryRecord, error)
+	n    int // records read
+}
+
+// NewLogReader returns a reader of the records in r.
+func NewLogReader(r io.Reader) *LogReader {
+	return &LogReader{r: bufio.NewReader(r)}
+}
+
+// Next returns the next record, as BinaryReader.Next and JSONReader.Next do
+// for their formats, with errors naming the record they occurred at. It
+// returns io.EOF at the end of the log.
+func (r *LogReader) Next() (*BinaryRecord, error) {
+	for {
+		rec, err := r.read()
+		if err == io.EOF {
+			return nil, err
+		}
+		r.n++
+		if err == nil {
+			return rec, nil
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			err = fmt.Errorf("log ends inside it: %w", err)
+		}
+		err = fmt.Errorf("record %d: %w", r.n, err)
+		switch {
+		case r.OnError == nil:
+			return rec, err
+		case rec != nil:
+			r.OnError(err)
+			return rec, nil
+		case errors.Is(err, ErrMalformed) || errors.Is(err, ErrMalformedJSON):
+			r.OnError(err)
+		default:
+			return nil, err
+		}
+	}
+}
+
+func (r *LogReader) read() (*BinaryRecord, error) {
+	if r.next == nil {
+		if isJSONLog(r.r) {
+			jr := NewJSONReader(r.r)
+			jr.FieldNames = r.FieldNames
+			r.next = jr.Next
+		} else {
+			br := NewBinaryReader(r.r)
+			br.Keyring = r.Keyring
+			br.FieldNames = r.FieldNames
+			r.next = br.Next
+		}
+	}
+	return r.next()
+}
+
+// isJSONLog reports whether the first byte of r other than JSON white space
+// opens an object. Binary frames start with a small frame type, whose bytes
+// are not white space.
+func isJSONLog(r *bufio.Reader) bool {
+	b, _ := r.Peek(r.Size())
+	for _, c := range b {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{':
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// RecordWriter writes decoded records in the format a Logger given the same
+// options would write them in. It is not safe for concurrent use.
+type RecordWriter struct {
+	w      io.Writer
+	enc    Encoder
+	msgKey string
+	buf    []byte
+}
+
+// NewRecordWriter returns a RecordWriter writing to w. Only the options that
+// describe how records are written apply, such as WithFormat, WithEncoder,
+// WithTimeFormat and WithFieldNames. Encrypted fields are written as their
+// "[ENCRYPTED:<key ID>]" placeholder, in every format.
+func NewRecordWriter(w io.Writer, opts ...Option) *RecordWriter {
+	o := newOptions(opts)
+	rw := &RecordWriter{w: w, enc: o.encoder}
+	if rw.enc == nil {
+		rw.w = formatWriter(w, o.format, &o)
+		rw.enc = newEncoder(o.format, &o)
+	}
+	rw.msgKey = messageKey(rw.enc, &o)
+	return rw
+}
+
+// WriteRecord encodes r and writes it.
+func (w *RecordWriter) WriteRecord(r *BinaryRecord) error {
+	w.buf = appendRecord(w.buf[:0], w.enc, w.msgKey, r)
+	_, err := w.w.Write(w.buf)
+	return err
+}
@@ -0,0 +1,148 @@
+package bark
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestLogReader(t *testing.T) {
+	for _, f := range []Format{FormatJSON, FormatBinary} {
+		var buf bytes.Buffer
+		l := NewLogger(&buf, WithFormat(f))
+		l.Info().Int("i", 1).Msg("one")
+		l.Error().Int("i", 2).Msg("two")
+
+		r := NewLogReader(&buf)
+		for i, want := range []string{"one", "two"} {
+			rec, err := r.Next()
+			if err != nil {
+				t.Fatalf("%v: %v", f, err)
+			}
+			if rec.Message() != want {
+				t.Errorf("%v: record %d is %q", f, i, rec.Message())
+			}
+		}
+		if _, err := r.Next(); err != io.EOF {
+			t.Errorf("%v: got %v at the end", f, err)
+		}
+	}
+}
+
+func TestLogReaderFieldNames(t *testing.T) {
+	names := FieldNames{Level: "lvl", Message: "msg"}
+	for _, f := range []Format{FormatJSON, FormatBinary} {
+		var buf bytes.Buffer
+		NewLogger(&buf, WithFormat(f), WithFieldNames(names)).Warn().Int("n", 1).Msg("renamed")
+		r := NewLogReader(&buf)
+		r.FieldNames = names
+		rec, err := r.Next()
+		if err != nil {
+			t.Fatalf("%v: %v", f, err)
+		}
+		if rec.Message() != "renamed" || rec.Level() != LevelWarn {
+			t.Errorf("%v: got %q at %v", f, rec.Message(), rec.Level())
+		}
+	}
+}
+
+func TestLogReaderSniffing(t *testing.T) {
+	var js bytes.Buffer
+	NewLogger(&js).Info().Msg("indented")
+	rec, err := NewLogReader(strings.NewReader("\n  \r\n\t" + js.String())).Next()
+	if err != nil || rec.Message() != "indented" {
+		t.Errorf("JSON after white space: %v, %v", rec, err)
+	}
+
+	for _, text := range []string{
+		"2024-05-01 12:00:00 INFO started\n",
+		"\n\nplain text log\n",
+		"\x01\x00\x03\x00\x00\x00short",
+	} {
+		if _, err := NewLogReader(strings.NewReader(text)).Next(); !errors.Is(err, ErrFrameHeader) {
+			t.Errorf("%q: got %v", text, err)
+		}
+	}
+
+	// A plausible header claiming far more than the input holds.
+	frame := []byte{1, 0, 0, 0, 0, 0x40, 1, 2, 3, 4, 5, 6, 7, 8}
+	if _, err := NewBinaryReader(bytes.NewReader(frame)).Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated 1 GiB frame: got %v", err)
+	}
+}
+
+func TestLogReaderOnError(t *testing.T) {
+	var js bytes.Buffer
+	l := NewLogger(&js)
+	l.Info().Msg("one")
+	js.WriteString("{broken\n")
+	l.Info().Msg("two")
+
+	var errs []error
+	r := NewLogReader(&js)
+	r.OnError = func(err error) { errs = append(errs, err) }
+	var msgs []string
+	for {
+		rec, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, rec.Message())
+	}
+	if strings.Join(msgs, ",") != "one,two" || len(errs) != 1 ||
+		!errors.Is(errs[0], ErrMalformedJSON) || !strings.HasPrefix(errs[0].Error(), "record 2: ") {
+		t.Errorf("read %v, errors %v", msgs, errs)
+	}
+
+	// A field that does not decrypt is reported, and its record returned.
+	var bin bytes.Buffer
+	NewBinaryLogger(&bin, WithEncryption(testCipher(t, "k1", 1), "ssn")).Info().Str("ssn", "x").Msg("sealed")
+	frame := bin.Bytes()
+	bin.Write(frame[:len(frame)-1])
+	errs = nil
+	r = NewLogReader(&bin)
+	r.Keyring = NewKeyring(testCipher(t, "k1", 2))
+	r.OnError = func(err error) { errs = append(errs, err) }
+	if rec, err := r.Next(); err != nil || rec.Message() != "sealed" || len(errs) != 1 {
+		t.Errorf("got %v, %v, errors %v", rec, err, errs)
+	}
+	if _, err := r.Next(); !errors.Is(err, io.ErrUnexpectedEOF) || !strings.HasPrefix(err.Error(), "record 2: log ends inside it") {
+		t.Errorf("partial record: %v", err)
+	}
+}
+
+func TestRecordWriter(t *testing.T) {
+	var src bytes.Buffer
+	NewBinaryLogger(&src).Warn().Str("user", "alice").Int("n", 3).Msg("hello")
+	rec, err := DecodeBinary(src.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []Format{FormatJSON, FormatLogfmt, FormatBinary, FormatCBOR, FormatMsgpack} {
+		var want, got bytes.Buffer
+		NewLogger(&want, WithFormat(f)).Warn().Str("user", "alice").Int("n", 3).Msg("hello")
+		if err := NewRecordWriter(&got, WithFormat(f)).WriteRecord(rec); err != nil {
+			t.Fatal(err)
+		}
+		if f == FormatBinary {
+			if !bytes.Equal(got.Bytes(), src.Bytes()) {
+				t.Errorf("binary: frames differ")
+			}
+			continue
+		}
+		// Records are logged at different times, so only compare lengths and the
+		// fields of the text formats.
+		if got.Len() != want.Len() {
+			t.Errorf("%v: got %q, want %q", f, got.Bytes(), want.Bytes())
+		}
+		if f == FormatLogfmt && !strings.Contains(got.String(), `user=alice n=3 msg=hello`) {
+			t.Errorf("logfmt: got %q", got.String())
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package bark
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Redacted replaces the values hidden by a Redaction policy.
+const Redacted = "[REDACTED]"
+
+// Redaction is a policy for keeping secrets out of the log. It is applied as
+// fields are added, before encoding, so every format gets the same result.
+type Redaction struct {
+	// Keys lists the keys whose values are always hidden, whatever their
+	// type. Keys match case-insensitively and may contain the wildcards * (any
+	// run of characters) and ? (one character), e.g. "*password*".
+	Keys []string
+
+	// Scanners find secrets inside string and error values under any key, and
+	// in the message. Only the matched text is replaced.
+	Scanners []Scanner
+
+	// Hash writes "[REDACTED:<hash>]" instead of Redacted, so that equal
+	// values can be matched up across records without being revealed. The
+	// hash is a truncated SHA-256 of the value's text, or an HMAC-SHA256 if
+	// HashKey is set, which stops anyone without the key from confirming
+	// guessed values.
+	Hash    bool
+	HashKey []byte
+}
+
+// Scanner finds sensitive text, returning the start and end offsets of up to
+// n matches, or all matches if n is negative. *regexp.Regexp implements it.
+type Scanner interface {
+	FindAllStringIndex(s string, n int) [][]int
+}
+
+var (
+	// ScanCreditCards finds payment card numbers: 13 to 19 digits, possibly
+	// grouped with spaces or dashes, that pass the Luhn check.
+	ScanCreditCards Scanner = luhnScanner{regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)}
+
+	// ScanBearerTokens finds the credentials following "Bearer", as in HTTP
+	// Authorization headers, leaving the scheme itself in place.
+	ScanBearerTokens Scanner = groupScanner{regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`)}
+)
+
+// WithRedaction hides the values described by r. Without it, fields cost no
+// redaction checks.
+func WithRedaction(r Redaction) Option {
+	return func(o *options) {
+		o.redact = newRedactor(r)
+	}
+}
+
+type redactor struct {
+	keys     *keyMatcher
+	scanners []Scanner
+	hash     bool
+	hashKey  []byte
+}
+
+func newRedactor(r Redaction) *redactor {
+	return &redactor{keys: newKeyMatcher(r.Keys), scanners: r.Scanners, hash: r.Hash, hashKey: r.HashKey}
+}
+
+// keyMatcher matches keys against case-insensitive glob patterns.
+type keyMatcher struct {
+	patterns []string // lowercased
+
+	matched sync.Map // key -> bool, so each key is matched once
+	size    atomic.Int32
+}
+
+// maxMatchedKeys bounds the cache of matched keys, in case keys are built at
+// run time.
+const maxMatchedKeys = 1024
+
+func newKeyMatcher(patterns []string) *keyMatcher {
+	m := &keyMatcher{}
+	for _, p := range patterns {
+		m.patterns = append(m.patterns, strings.ToLower(p))
+	}
+	return m
+}
+
+// match reports whether key matches any of the patterns.
+func (m *keyMatcher) match(key string) bool {
+	if len(m.patterns) == 0 {
+		return false
+	}
+	if v, ok := m.matched.Load(key); ok {
+		return v.(bool)
+	}
+	lower := strings.ToLower(key)
+	found := false
+	for _, p := range m.patterns {
+		if matchGlob(p, lower) {
+			found = true
+			break
+		}
+	}
+	if m.size.Load() < maxMatchedKeys {
+		m.size.Add(1)
+		m.matched.Store(key, found)
+	}
+	return found
+}
+
+// replacement returns the text written in place of a value whose text is s.
+func (x *redactor) replacement(s string) string {
+	if !x.hash {
+		return Redacted
+	}
+	var h hash.Hash
+	if x.hashKey != nil {
+		h = hmac.New(sha256.New, x.hashKey)
+	} else {
+		h = sha256.New()
+	}
+	h.Write([]byte(s))
+	b := append(make([]byte, 0, 28), "[REDACTED:"...)
+	for _, c := range h.Sum(nil)[:8] {
+		b = append(b, hex[c>>4], hex[c&0xf])
+	}
+	return string(append(b, ']'))
+}
+
+// scan replaces the text found by the scanners in s.
+func (x *redactor) scan(s string) string {
+	for _, sc := range x.scanners {
+		found := sc.FindAllStringIndex(s, -1)
+		if len(found) == 0 {
+			continue
+		}
+		var b strings.Builder
+		last := 0
+		for _, m := range found {
+			b.WriteString(s[last:m[0]])
+			b.WriteString(x.replacement(s[m[0]:m[1]]))
+			last = m[1]
+		}
+		b.WriteString(s[last:])
+		s = b.String()
+	}
+	return s
+}
+
+// redacted writes the field with its value hidden if the logger's policy
+// covers key, reporting whether it did.
+func redacted[T any](e *Event, key string, val T) bool {
+	x := e.l.opts.redact
+	if x == nil || !x.keys.match(key) {
+		return false
+	}
+	var s string
+	if x.hash {
+		switch v := any(val).(type) {
+		case string:
+			s = v
+		case []byte:
+			s = string(v)
+		default:
+			s = fmt.Sprint(v)
+		}
+	}
+	e.appendKey(key)
+	e.buf = e.l.enc.AppendString(e.buf, x.replacement(s))
+	return true
+}
+
+// scanned returns s with the text found by the logger's scanners replaced.
+func (e *Event) scanned(s string) string {
+	if x := e.l.opts.redact; x != nil && len(x.scanners) > 0 {
+		return x.scan(s)
+	}
+	return s
+}
+
+// matchGlob reports whether s matches pattern, in which * matches any run of
+// characters and ? a single one.
+func matchGlob(pattern, s string) bool {
+	star, next := -1, 0
+	p, i := 0, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			star, next = p, i
+			p++
+		case p < len(pattern) && (pattern[p] == '?' || pattern[p] == s[i]):
+			if pattern[p] == '?' {
+				i += runeLen(s[i:])
+			} else {
+				i++
+			}
+			p++
+		case star >= 0:
+			next += runeLen(s[next:])
+			p, i = star+1, next
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+func runeLen(s string) int {
+	for i := range s {
+		if i > 0 {
+			return i
+		}
+	}
+	return len(s)
+}
+
+// groupScanner reports the first submatch of each match, so that context
+// needed to find a secret is not itself replaced.
+type groupScanner struct{ re *regexp.Regexp }
+
+func (g groupScanner) FindAllStringIndex(s string, n int) [][]int {
+	found := g.re.FindAllStringSubmatchIndex(s, n)
+	for i, m := range found {
+		found[i] = m[2:4]
+	}
+	return found
+}
+
+// luhnScanner keeps the matches whose digits pass the Luhn check.
+type luhnScanner struct{ re *regexp.Regexp }
+
+func (l luhnScanner) FindAllStringIndex(s string, n int) [][]int {
+	found := l.re.FindAllStringIndex(s, n)
+	kept := found[:0]
+	for _, m := range found {
+		if luhn(s[m[0]:m[1]]) {
+			kept = append(kept, m)
+		}
+	}
+	return kept
+}
+
+func luhn(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
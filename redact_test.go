@@ -0,0 +1,113 @@
+package bark
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, s string
+		want       bool
+	}{
+		{"password", "password", true},
+		{"password", "passwords", false},
+		{"*password*", "db_password_hash", true},
+		{"*token", "access_token", true},
+		{"*token", "token_type", false},
+		{"api?key", "api_key", true},
+		{"api?key", "apikey", false},
+		{"*", "", true},
+		{"a*b*c", "axxbyyc", true},
+		{"a*b*c", "axxbyy", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.s); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v", tt.pattern, tt.s, got)
+		}
+	}
+}
+
+func TestRedactionKeys(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf, WithRedaction(Redaction{Keys: []string{"*password*", "Authorization", "pin"}}))
+	l.Info().
+		Str("user", "alice").
+		Str("Password", "hunter2").
+		Str("authorization", "Basic xyz").
+		Int("pin", 1234).
+		Any("db_password", []byte("secret")).
+		Msg("login")
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	for _, k := range []string{"Password", "authorization", "pin", "db_password"} {
+		if rec[k] != Redacted {
+			t.Errorf("%s = %v, want %s", k, rec[k], Redacted)
+		}
+	}
+	if rec["user"] != "alice" {
+		t.Errorf("user = %v", rec["user"])
+	}
+}
+
+func TestRedactionHash(t *testing.T) {
+	var a, b bytes.Buffer
+	r := Redaction{Keys: []string{"token"}, Hash: true}
+	NewLogger(&a, WithRedaction(r)).Info().Str("token", "abc").Msg("")
+	NewBinaryLogger(&b, WithRedaction(r)).Info().Str("token", "abc").Msg("")
+	keyed := Redaction{Keys: []string{"token"}, Hash: true, HashKey: []byte("k")}
+	hmacd := newRedactor(keyed).replacement("abc")
+
+	var rec map[string]any
+	if err := json.Unmarshal(a.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	got, _ := rec["token"].(string)
+	if !strings.HasPrefix(got, "[REDACTED:") || len(got) != len("[REDACTED:]")+16 || strings.Contains(got, "abc") {
+		t.Fatalf("token = %q", got)
+	}
+	if hmacd == got {
+		t.Error("keyed and unkeyed hashes should differ")
+	}
+	br, err := DecodeBinary(b.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := br.Fields[0].Value; v != got {
+		t.Errorf("binary token = %v, want %q", v, got)
+	}
+}
+
+func TestRedactionScanners(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf, WithRedaction(Redaction{Scanners: []Scanner{ScanCreditCards, ScanBearerTokens}}))
+	l.Info().
+		Str("card", "paid with 4111 1111 1111 1111 today").
+		Str("order", "1234567890123").
+		Str("header", "Authorization: Bearer eyJhbGciOi.J9-x_y").
+		Error(errors.New("charge failed for 4111-1111-1111-1111")).
+		Msg("card 4111111111111111 declined")
+
+	var rec map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"card":    "paid with [REDACTED] today",
+		"order":   "1234567890123",
+		"header":  "Authorization: Bearer [REDACTED]",
+		"error":   "charge failed for [REDACTED]",
+		"message": "card [REDACTED] declined",
+	}
+	for k, w := range want {
+		if rec[k] != w {
+			t.Errorf("%s = %q, want %q", k, rec[k], w)
+		}
+	}
+}
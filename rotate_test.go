@@ -0,0 +1,69 @@
+package bark
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	r, err := OpenRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rec := range []string{"aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeeeeeeeeeee\n"} {
+		if _, err := r.Write([]byte(rec)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{
+		path:        "eeeeeeeeeeee\n",
+		path + ".1": "cccc\ndddd\n",
+		path + ".2": "aaaa\nbbbb\n",
+	}
+	for p, w := range want {
+		got, err := os.ReadFile(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != w {
+			t.Errorf("%s = %q, want %q", p, got, w)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected at most 2 backups, got %v", err)
+	}
+	if _, err := r.Write([]byte("x")); !errors.Is(err, os.ErrClosed) {
+		t.Errorf("write after close: %v", err)
+	}
+}
+
+func TestRotatingFileNoBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenRotatingFile(path, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Write([]byte("new\n"))
+	if err := r.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	r.Write([]byte("newer\n"))
+	got, _ := os.ReadFile(path)
+	if string(got) != "newer\n" {
+		t.Errorf("got %q", got)
+	}
+	if _, err := os.Stat(path + ".1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("unexpected backup: %v", err)
+	}
+}
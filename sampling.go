@@ -0,0 +1,51 @@
+package bark
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// WithSampling caps how many records of each level are written per tick:
+// the first n, then every mth after that. Records left out are not encoded
+// at all. A thereafter of 0 drops every record past the first n until the
+// next tick. Named loggers share the counts of the logger they came from.
+func WithSampling(first, thereafter int, tick time.Duration) Option {
+	return func(o *options) {
+		o.sampler = &sampler{
+			first:      uint64(max(first, 0)),
+			thereafter: uint64(max(thereafter, 0)),
+			tick:       int64(tick),
+		}
+	}
+}
+
+type sampler struct {
+	first      uint64
+	thereafter uint64
+	tick       int64
+	counts     [LevelError - LevelDebug + 1]sampleCount
+}
+
+type sampleCount struct {
+	next atomic.Int64 // when the current tick ends, in Unix nanoseconds
+	n    atomic.Uint64
+}
+
+// allow counts a record of the given level at now and reports whether it is
+// written.
+func (s *sampler) allow(level Level, now time.Time) bool {
+	i := int(level - LevelDebug)
+	if i < 0 || i >= len(s.counts) {
+		return true
+	}
+	c := &s.counts[i]
+	t := now.UnixNano()
+	if next := c.next.Load(); t >= next && c.next.CompareAndSwap(next, t+s.tick) {
+		c.n.Store(0)
+	}
+	n := c.n.Add(1)
+	if n <= s.first {
+		return true
+	}
+	return s.thereafter > 0 && (n-s.first)%s.thereafter == 0
+}
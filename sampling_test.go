@@ -0,0 +1,41 @@
+package bark
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSampler(t *testing.T) {
+	s := &sampler{first: 2, thereafter: 3, tick: int64(time.Second)}
+	now := time.Unix(100, 0)
+	var got []bool
+	for range 8 {
+		got = append(got, s.allow(LevelInfo, now))
+	}
+	want := []bool{true, true, false, false, true, false, false, true}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if !s.allow(LevelWarn, now) {
+		t.Error("levels should be counted separately")
+	}
+	if !s.allow(LevelInfo, now.Add(time.Second)) {
+		t.Error("counts should reset on the next tick")
+	}
+}
+
+func TestWithSampling(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewLogger(&buf, WithSampling(1, 0, time.Hour))
+	for range 5 {
+		l.Info().Int("n", 1).Msg("repeated")
+	}
+	l.Error().Msg("other level")
+	if n := strings.Count(buf.String(), "\n"); n != 2 {
+		t.Errorf("wrote %d records, want 2:\n%s", n, buf.String())
+	}
+}